@@ -0,0 +1,102 @@
+// bmc.go
+// 有界モデル検査 (bounded model checking)
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+// --bmc=k を指定したときは、for 文を INV で切断せずに k 回まで展開して最弱事前条件を求める。
+// INV はなくてもよいが、k 回以内の繰り返しで起こる誤りしか見つけられないので証明にはならない。
+//
+//	for init; cond; post { body }
+//	=> init; if cond { body; post; if cond { body; post; ... 展開の上限 } }
+//
+// 展開の上限の地点では、まず cond が成り立たない (k 回以内にループを抜ける) と仮定して検証し、反例を探す。
+// 反例がなければ、次に上限の地点で cond が成り立たないことを証明すべき条件として検証し、
+// 反例があるときは展開の上限に達する実行があると報告する。main.go の processFunc 参照。
+
+// boundedCorrectness は有界モデル検査で反例が見つからなかったことを表す
+const boundedCorrectness = "bounded"
+
+// bmcExit は展開の上限の地点でループを抜けることを証明すべき条件とするかどうか
+var bmcExit bool
+
+// checkBound は関数 f の実行が展開の上限に達することがあるかどうか調べる関数
+func checkBound(f *ast.FuncDecl) (reached bool, err error) {
+	bmcExit = true
+	defer func() { bmcExit = false }()
+
+	var conds []ast.Expr
+	var vars map[string]ast.Expr
+	conds, vars, err = getCondTobeVerified(f)
+	if err != nil {
+		return
+	}
+	for _, cond := range conds {
+		var result string
+		result, _, err = checkCond(vars, cond)
+		if err != nil {
+			return
+		}
+		switch result {
+		case "sat":
+			reached = true
+			return
+		case "unsat":
+			// skip
+		default:
+			err = fmt.Errorf("something wrong")
+			return
+		}
+	}
+	return
+}
+
+// wpForUnroll は for 文を conf.BMC 回まで展開して事前条件を抽出する関数。
+// stmts は表明文を除いたループ本体の文のリスト。
+func wpForUnroll(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.ForStmt, stmts []ast.Stmt, q PostConds) (pre ast.Expr, err error) {
+	cond := s.Cond
+	if cond == nil {
+		cond = ast.NewIdent("true")
+	}
+
+	// 展開の上限の地点
+	if bmcExit {
+		// !cond && Q
+		pre = astAnd(astNot(cond), q.Normal)
+	} else {
+		// !cond ==> Q
+		pre = astImplies(astNot(cond), q.Normal)
+	}
+
+	// 内側の繰り返しから順に外側へ展開する
+	for i := 0; i < conf.BMC; i++ {
+		next := pre
+		if s.Post != nil {
+			next, err = wpStmt(acc, vars, s.Post, PostConds{Normal: next})
+			if err != nil {
+				return
+			}
+		}
+		bodyQ := q.withNormal(next)
+		bodyQ.Continue = next
+		bodyQ.Break = q.Normal
+
+		var body ast.Expr
+		body, err = wpBlock(acc, vars, stmts, bodyQ)
+		if err != nil {
+			return
+		}
+
+		// cond && wp(body, next) || !cond && Q
+		pre = astCases([]ast.Expr{cond}, []ast.Expr{body}, q.Normal)
+	}
+
+	if s.Init != nil {
+		pre, err = wpStmt(acc, vars, s.Init, PostConds{Normal: pre})
+	}
+	return
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// 有界モデル検査は INV のないループを k 回まで展開して反例を探し、上限に達する実行があるかも報告する。
+// ループは n 回まわるので、PRE で n を 3 以下に限ると 4 回の展開では上限に達しない。
+func TestBMC(t *testing.T) {
+	src := `package main
+
+func f(n int) (r int) {
+	PRE("n >= 0 && n <= 3")
+	r = 0
+	i := 0
+	for i < n {
+		i = i + 1
+		r = r + 1
+	}
+	POST("%s")
+	return
+}
+`
+	tests := []struct {
+		name    string
+		post    string
+		k       int
+		ok      bool
+		reached bool
+	}{
+		{name: "no counter-example, bound reached", post: "r == n", k: 2, ok: true, reached: true},
+		{name: "no counter-example, bound not reached", post: "r == n", k: 4, ok: true, reached: false},
+		{name: "counter-example within bound", post: "r <= 1", k: 2, ok: false},
+		{name: "counter-example beyond bound", post: "r <= 2", k: 2, ok: true, reached: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fileNode := setupSrc(t, strings.Replace(src, "%s", tt.post, 1)+specStubs)
+			conf.BMC = tt.k
+			err := processFunc(fileNode, "f")
+			if !tt.ok {
+				if err == nil || !strings.Contains(err.Error(), "counter-example") {
+					t.Errorf("want counter-example, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			data := funcTab["f"]
+			if data.Correctness != boundedCorrectness {
+				t.Errorf("Correctness: got %s, want %s", data.Correctness, boundedCorrectness)
+			}
+			if reached := strings.Contains(data.Note, "the bound is reached"); reached != tt.reached {
+				t.Errorf("Note: %s", data.Note)
+			}
+		})
+	}
+}
@@ -14,14 +14,21 @@ const (
 	defaultCmdExe     = "z3"
 	defaultCmdArg     = "-in"
 	defaultTimeOutSec = 60
+	defaultVCGen      = "wp"
+	defaultFloat      = "ieee"
 )
 
 // Config は設定情報の型
 type Config struct {
-	Cmd         []string `json:"cmd"`
-	TimeOutSec  int      `json:"time_out_sec"`
-	IgnoreFuncs []string `json:"ignore_funcs"`
-	Debug       bool     `json:"debug"`
+	Cmd          []string `json:"cmd"`
+	TimeOutSec   int      `json:"time_out_sec"`
+	IgnoreFuncs  []string `json:"ignore_funcs"`
+	Debug        bool     `json:"debug"`
+	VCGen        string   `json:"vcgen"`         // 検証条件の作成方法。"wp" (最弱事前条件)、"passive" (受動形) または "symexec" (記号実行)
+	WriteInv     bool     `json:"write_inv"`     // 推論したループ不変条件をソースファイルに書き込むかどうか
+	BMC          int      `json:"bmc"`           // 有界モデル検査でループを展開する回数。0 のときは INV を使う
+	AutoTriggers bool     `json:"auto_triggers"` // ForAllIn/ExistsIn の本体の配列の参照を SMT のパターンにするかどうか
+	Float        string   `json:"float"`         // 浮動小数点数のモード。"ieee" (FloatingPoint) または "real" (実数)。float.go 参照
 }
 
 // LoadConfig はファイルに保存された JSON オブジェクトを読み出す関数
@@ -47,6 +54,12 @@ func LoadConfig() (conf Config, err error) {
 	if conf.TimeOutSec == 0 {
 		conf.TimeOutSec = defaultTimeOutSec
 	}
+	if conf.VCGen == "" {
+		conf.VCGen = defaultVCGen
+	}
+	if conf.Float == "" {
+		conf.Float = defaultFloat
+	}
 	if len(conf.IgnoreFuncs) == 0 {
 		conf.IgnoreFuncs = []string{"Print", "Println", "Printf"}
 	}
@@ -0,0 +1,211 @@
+// const.go
+// パッケージレベルの定数と変数
+
+package main
+
+import (
+	"go/ast"
+	"go/constant"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// パッケージレベルで宣言されている定数と変数は、表明やコードの中でそのまま参照できる。
+//
+//	const MaxSize = 100      -> MaxSize は 100 に置き換える
+//	const (A = iota; B; C)   -> A、B、C は 0、1、2 に置き換える
+//	const Pi float64 = 3.14  -> Pi は float64 の値 (float.go 参照) に置き換える
+//	var limit int            -> (declare-const limit Int) の解釈されない定数とする
+//
+// 定数の値は go/types で求めるので、iota や定数式、型つきの定数も扱える。
+// 変数は関数の中では変更されないものとして、読むことだけができる。
+// 同名のパラメータや局所変数、束縛変数があるときはそちらを優先する。
+
+// pkgConst はパッケージレベルの定数の型と値
+type pkgConst struct {
+	typ ast.Expr       // 定数の型。型のない定数のときはその既定の型 (int、float64 など)
+	val constant.Value // 定数の値
+}
+
+// constTab はパッケージレベルの定数名とその型と値の表
+var constTab map[string]pkgConst
+
+// globalTab はパッケージレベルの変数名とその型の表
+var globalTab map[string]ast.Expr
+
+// loadPkgDecls は型検査したパッケージ specPkg のスコープから、
+// パッケージレベルの定数を constTab に、変数を globalTab に登録する関数。typecheck.go 参照。
+func loadPkgDecls() {
+	constTab = map[string]pkgConst{}
+	globalTab = map[string]ast.Expr{}
+	if specPkg == nil {
+		return
+	}
+	scope := specPkg.Scope()
+	for _, name := range scope.Names() {
+		switch scope.Lookup(name).(type) {
+		case *types.Const:
+			obj := scope.Lookup(name).(*types.Const)
+			typ := typeExpr(obj.Type())
+			if typ == nil || obj.Val().Kind() == constant.Unknown {
+				continue
+			}
+			constTab[name] = pkgConst{typ: typ, val: obj.Val()}
+		case *types.Var:
+			if typ := typeExpr(scope.Lookup(name).Type()); typ != nil {
+				globalTab[name] = typ
+			}
+		}
+	}
+}
+
+// typeExpr は go/types の型を AST の型の式に変換する関数。
+// 型のない定数の型はその既定の型とする。変換できないときは nil を返す。
+func typeExpr(t types.Type) (r ast.Expr) {
+	s := types.TypeString(types.Default(t), types.RelativeTo(specPkg))
+	r, err := parser.ParseExpr(s)
+	if err != nil {
+		r = nil
+	}
+	return
+}
+
+// lookupConst は変数名とその型 vars に含まれない名前 name が
+// パッケージレベルの定数のとき、その型と値を取得する関数
+func lookupConst(vars map[string]ast.Expr, name string) (c pkgConst, ok bool) {
+	if _, local := vars[name]; local {
+		return
+	}
+	c, ok = constTab[name]
+	return
+}
+
+// pkgType は変数名とその型 vars に含まれない名前 name が
+// パッケージレベルの定数または変数のとき、その型を取得する関数。それ以外は nil を返す。
+func pkgType(vars map[string]ast.Expr, name string) (r ast.Expr) {
+	if _, local := vars[name]; local {
+		return
+	}
+	if c, ok := constTab[name]; ok {
+		r = c.typ
+	} else {
+		r = globalTab[name]
+	}
+	return
+}
+
+// convConst はパッケージレベルの定数 c を SMT LIB Language の値に変換する関数
+func convConst(c pkgConst) (r string) {
+	if name := floatTypeName(c.typ); name != "" {
+		r = convFloatValue(c.val, name)
+		return
+	}
+	switch c.val.Kind() {
+	case constant.String:
+		r = convStringLit(c.val.ExactString())
+	case constant.Int:
+		r = c.val.ExactString()
+		if strings.HasPrefix(r, "-") {
+			r = "(- " + r[1:] + ")"
+		}
+	default:
+		// bool
+		r = c.val.ExactString()
+	}
+	return
+}
+
+// constExpr は定数の値 val を型 typ の値のリテラルの式にする関数。
+// 整数でない浮動小数点数の値のようにリテラルで表せないときは nil を返す。
+func constExpr(val constant.Value, typ ast.Expr) (r ast.Expr) {
+	switch val.Kind() {
+	case constant.Bool:
+		r = ast.NewIdent(val.ExactString())
+		return
+	case constant.String:
+		r = &ast.BasicLit{Kind: token.STRING, Value: val.ExactString()}
+		return
+	case constant.Int, constant.Float:
+	default:
+		return
+	}
+	abs := val
+	if constant.Sign(val) < 0 {
+		abs = constant.UnaryOp(token.SUB, val, 0)
+	}
+	if name := floatTypeName(typ); name != "" {
+		// float32(2.0) のように型を明示する
+		f := constant.ToFloat(abs)
+		if constant.Denom(f).ExactString() != "1" {
+			return
+		}
+		lit := &ast.BasicLit{Kind: token.FLOAT, Value: constant.Num(f).ExactString() + ".0"}
+		r = &ast.CallExpr{Fun: ast.NewIdent(name), Args: []ast.Expr{lit}}
+	} else {
+		i := constant.ToInt(abs)
+		if i.Kind() != constant.Int {
+			return
+		}
+		r = &ast.BasicLit{Kind: token.INT, Value: i.ExactString()}
+	}
+	if constant.Sign(val) < 0 {
+		r = &ast.UnaryExpr{Op: token.SUB, X: r}
+	}
+	return
+}
+
+// localConstExpr は関数の中で宣言された定数 name の値を型 typ の値のリテラルの式にする関数。
+// 型検査で値が求まらないときやリテラルで表せないときは nil を返す。
+func localConstExpr(name *ast.Ident, typ ast.Expr) (r ast.Expr) {
+	if obj, ok := declObjs[name].(*types.Const); ok {
+		r = constExpr(obj.Val(), typ)
+	}
+	return
+}
+
+// withGlobals は条件式 cond と、そこで使われる純粋関数と LEMMA の本体で参照される
+// パッケージレベルの変数を、変数名とその型 vars に加えたものを返す関数。
+// 加えた変数は解釈されない定数として宣言される。
+func withGlobals(vars map[string]ast.Expr, cond ast.Expr) (r map[string]ast.Expr) {
+	r = vars
+	roots := []ast.Node{cond}
+	pfs, lemmas := usedDefs(cond)
+	for _, pf := range pfs {
+		for _, stmt := range pf.stmts {
+			roots = append(roots, stmt)
+		}
+	}
+	for _, def := range lemmas {
+		roots = append(roots, def.body)
+	}
+	copied := false
+	var visit func(node ast.Node)
+	visit = func(node ast.Node) {
+		ast.Inspect(node, func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.SelectorExpr:
+				// フィールド名は変数ではない
+				visit(n.(*ast.SelectorExpr).X)
+				return false
+			case *ast.Ident:
+				name := n.(*ast.Ident).Name
+				if _, local := r[name]; local || globalTab[name] == nil {
+					return true
+				}
+				if !copied {
+					r = bindVar(vars, name, globalTab[name])
+					copied = true
+				} else {
+					r[name] = globalTab[name]
+				}
+			}
+			return true
+		})
+	}
+	for _, root := range roots {
+		visit(root)
+	}
+	return
+}
@@ -0,0 +1,89 @@
+package main
+
+import "testing"
+
+// パッケージレベルの定数と変数の宣言
+const pkgDeclSrc = `
+const MaxSize = 3
+
+const (
+	A = iota
+	B
+	C
+)
+
+type Size int
+
+const Two Size = 2
+
+var limit int
+`
+
+// パッケージレベルの定数は値に置き換え、変数は解釈されない定数とする
+func TestPkgDecls(t *testing.T) {
+	runVerdictTests(t, []verdictTest{
+		{name: "const", src: pkgDeclSrc + `
+func f(x int) (r int) {
+	PRE("x < MaxSize")
+	r = x + 1
+	POST("r <= MaxSize")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "iota", src: pkgDeclSrc + `
+func f(x int) (r int) {
+	PRE("true")
+	r = x + C - B
+	POST("r == x + 1 && A == 0 && int(Two) == C")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "iota ng", src: pkgDeclSrc + `
+func f(x int) (r int) {
+	PRE("true")
+	r = x + C
+	POST("r == x + 1")
+	return
+}
+`, funcs: []string{"f"}, ok: false},
+		{name: "var", src: pkgDeclSrc + `
+func f(x int) (r int) {
+	PRE("x < limit")
+	r = limit
+	POST("r > x")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "var ng", src: pkgDeclSrc + `
+func f(x int) (r int) {
+	PRE("true")
+	r = limit
+	POST("r > 0")
+	return
+}
+`, funcs: []string{"f"}, ok: false},
+		{name: "shadowed", src: pkgDeclSrc + `
+func f(MaxSize int) (r int) {
+	PRE("MaxSize == 0")
+	r = MaxSize
+	POST("r == 0")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+	})
+}
+
+func TestPkgDeclSMT(t *testing.T) {
+	src := "package main\n" + pkgDeclSrc + `
+func f(x int) (r int) {
+	PRE("x < MaxSize")
+	r = limit + B
+	POST("r > x")
+	return
+}
+`
+	expectSMT(t, src, []string{"f"},
+		"(declare-const limit Int)",
+		"(< x 3)",
+		"(+ limit 1)")
+}
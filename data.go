@@ -15,14 +15,23 @@ import (
 
 // Data は検証結果データ
 type Data struct {
-	Name    string      `json:"name"`    // 関数名
-	Inputs  [][2]string `json:"inputs"`  // 入力パラメータ
-	Outputs [][2]string `json:"outputs"` // 出力パラメータ
-	Pre     string      `json:"pre"`     // 事前条件
-	Post    string      `json:"post"`    // 事後条件
-	Conds   []string    `json:"conds"`   // 検証した条件式リスト
-	Date    string      `json:"date"`    // 検証日
-	Note    string      `json:"note"`    // ノート
+	Name        string      `json:"name"`        // 関数名 (メソッドのときは 型名.メソッド名)
+	Recv        [][2]string `json:"recv"`        // レシーバ
+	Inputs      [][2]string `json:"inputs"`      // 入力パラメータ
+	Outputs     [][2]string `json:"outputs"`     // 出力パラメータ
+	Unchanged   []string    `json:"unchanged"`   // 関数本体で代入されない入力パラメータ (レシーバを含む)
+	Pre         string      `json:"pre"`         // 事前条件
+	Post        string      `json:"post"`        // 事後条件
+	Modifies    string      `json:"modifies"`    // 変更してよいヒープの場所
+	Asserts     []string    `json:"asserts"`     // 関数本体の途中で検証した ASSERT の条件式リスト
+	Assumes     []string    `json:"assumes"`     // 関数本体の途中で仮定した ASSUME の条件式リスト
+	Decreases   string      `json:"decreases"`   // 再帰呼び出しの減少量
+	Invariants  []string    `json:"invariants"`  // INV のないループに推論したループ不変条件のリスト
+	Warnings    []string    `json:"warnings"`    // 表明の空虚さや到達しない分岐の警告のリスト
+	Correctness string      `json:"correctness"` // 全正当性 (total) か部分正当性 (partial) か
+	Conds       []string    `json:"conds"`       // 検証した条件式リスト
+	Date        string      `json:"date"`        // 検証日
+	Note        string      `json:"note"`        // ノート
 }
 
 // String は検証結果データの文字列を作成する関数
@@ -31,6 +40,13 @@ func (d Data) String() string {
 
 	fmt.Fprintf(out, "Function: %s\n", d.Name)
 	tmp := []string{}
+	for _, t := range d.Recv {
+		tmp = append(tmp, fmt.Sprintf("%s:%s", t[0], t[1]))
+	}
+	if len(tmp) > 0 {
+		fmt.Fprintf(out, "RECV: %s\n", strings.Join(tmp, ", "))
+	}
+	tmp = []string{}
 	for _, t := range d.Inputs {
 		tmp = append(tmp, fmt.Sprintf("%s:%s", t[0], t[1]))
 	}
@@ -43,11 +59,37 @@ func (d Data) String() string {
 
 	fmt.Fprintf(out, "PRE: %s\n", d.Pre)
 	fmt.Fprintf(out, "POST: %s\n", d.Post)
+	if d.Modifies != "" {
+		fmt.Fprintf(out, "MODIFIES: %s\n", d.Modifies)
+	}
+
+	if d.Decreases != "" {
+		fmt.Fprintf(out, "DECREASES: %s\n", d.Decreases)
+	}
+
+	for _, inv := range d.Invariants {
+		fmt.Fprintf(out, "INV (inferred): %s\n", inv)
+	}
+
+	for _, cond := range d.Asserts {
+		fmt.Fprintf(out, "ASSERT: %s\n", cond)
+	}
+	for _, cond := range d.Assumes {
+		fmt.Fprintf(out, "ASSUME: %s\n", cond)
+	}
 
 	for i, cond := range d.Conds {
 		fmt.Fprintf(out, "Cond[%d]: %s\n", i, cond)
 	}
 
+	for _, w := range d.Warnings {
+		fmt.Fprintf(out, "Warning: %s\n", w)
+	}
+
+	if d.Correctness != "" {
+		fmt.Fprintf(out, "Correctness: %s\n", d.Correctness)
+	}
+
 	if d.Date != "" {
 		fmt.Fprintf(out, "Date: %s\n", d.Date)
 	}
@@ -60,18 +102,29 @@ func (d Data) String() string {
 }
 
 // getParams は AST 形式で入出力パラメータを取得する関数。
+// メソッドのときはレシーバを入力パラメータの先頭に含める。
 func (d Data) getParams() (is, os, it, ot []ast.Expr) {
-	for _, vv := range d.Inputs {
+	inputs := append(append([][2]string{}, d.Recv...), d.Inputs...)
+	for _, vv := range inputs {
 		is = append(is, ast.NewIdent(vv[0]))
 	}
 	for _, vv := range d.Outputs {
 		os = append(os, ast.NewIdent(vv[0]))
 	}
-	for _, vv := range d.Inputs {
-		it = append(it, ast.NewIdent(vv[1]))
+	for _, vv := range inputs {
+		it = append(it, parseType(vv[1]))
 	}
 	for _, vv := range d.Outputs {
-		ot = append(ot, ast.NewIdent(vv[1]))
+		ot = append(ot, parseType(vv[1]))
+	}
+	return
+}
+
+// parseType は型の文字列を AST 形式に変換する関数。例："*Point"
+func parseType(s string) (r ast.Expr) {
+	r, err := parser.ParseExpr(s)
+	if err != nil {
+		r = ast.NewIdent(s)
 	}
 	return
 }
@@ -83,6 +136,145 @@ func (d Data) getAsserts() (pre, post ast.Expr) {
 	return
 }
 
+// paramTypes は入出力パラメータの名前とその型の表を取得する関数
+func (d Data) paramTypes() (r map[string]ast.Expr) {
+	is, os, it, ot := d.getParams()
+	r = map[string]ast.Expr{}
+	for i, v := range is {
+		r[v.(*ast.Ident).Name] = it[i]
+	}
+	for i, v := range os {
+		r[v.(*ast.Ident).Name] = ot[i]
+	}
+	return
+}
+
+// instAsserts は事前・事後条件の入力パラメータを実引数 args で、出力パラメータを outs で置換したものを取得する関数。
+// 入出力パラメータは同時に置換するので、実引数の中に出力パラメータと同じ名前の変数があっても取り違えない。
+// outs が nil のときは出力パラメータを置換しない。
+// ポインタの参照はヒープの配列の参照に直し、ヒープの変数は事前条件では olds で、事後条件では news で置換する。
+// olds や news が nil のときはヒープの変数を置換しない。
+// 事後条件の old(e) は呼び出し時点の値とし、入力パラメータは実引数で、ヒープの変数は olds で置換する。
+// 事後条件で old の外に現れる入力パラメータは呼び出し先の終了時の値なので、関数本体で代入されないもの (Unchanged) だけを
+// 実引数で置換し、それ以外は新しい変数 x$post にして存在量化する。
+//
+//	POST("x == old(x) + 1 && r == x"), r = inc(a) => Exists(x$post, int, x$post == a + 1 && r == x$post)
+func (d Data) instAsserts(args, outs []ast.Expr, olds, news map[string]ast.Expr) (pre, post ast.Expr, err error) {
+	iParams, oParams, iTypes, _ := d.getParams()
+	if len(iParams) != len(args) {
+		err = fmt.Errorf("instAsserts: %s: len(iParams) != len(args)", d.Name)
+		return
+	}
+	if outs != nil && len(oParams) != len(outs) {
+		err = fmt.Errorf("instAsserts: %s: len(oParams) != len(outs)", d.Name)
+		return
+	}
+
+	pre, post = d.getAsserts()
+	env := d.paramTypes()
+	pre, err = heapify(env, pre)
+	if err != nil {
+		return
+	}
+	post, err = heapify(env, post)
+	if err != nil {
+		return
+	}
+
+	vs, es := withHeap(iParams, args, olds)
+	pre, err = subst(pre, vs, es)
+	if err != nil {
+		return
+	}
+
+	post = elimOld(env, post)
+	unchanged := map[string]bool{}
+	for _, name := range d.Unchanged {
+		unchanged[name] = true
+	}
+	var finals []ast.Expr
+	for i, v := range iParams {
+		name := v.(*ast.Ident).Name
+		if unchanged[name] {
+			finals = append(finals, args[i])
+		} else {
+			finals = append(finals, postIdent(name))
+		}
+	}
+	vs, es = withHeap(iParams, finals, news)
+	for i, v := range iParams {
+		vs = append(vs, oldIdent(v.(*ast.Ident).Name))
+		es = append(es, args[i])
+	}
+	for _, name := range heapVarNames(olds) {
+		vs = append(vs, oldIdent(name))
+		es = append(es, olds[name])
+	}
+	if outs != nil {
+		vs = append(vs, oParams...)
+		es = append(es, outs...)
+	}
+	post, err = subst(post, vs, es)
+	if err != nil {
+		return
+	}
+	for i := len(iParams) - 1; i >= 0; i-- {
+		name := iParams[i].(*ast.Ident).Name
+		if x := postIdent(name); !unchanged[name] && usesIdent(post, x.Name) {
+			post = astExists(x, iTypes[i], post)
+		}
+	}
+	return
+}
+
+// usesIdent は式 expr の中に名前 name の Ident があるかどうかを調べる関数
+func usesIdent(expr ast.Expr, name string) (ok bool) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if ident, isIdent := n.(*ast.Ident); isIdent && ident.Name == name {
+			ok = true
+		}
+		return !ok
+	})
+	return
+}
+
+// withHeap は置換する変数のリスト vs と式のリスト es に、ヒープの変数とその式の表 hs を加えたものを作成する関数
+func withHeap(vs, es []ast.Expr, hs map[string]ast.Expr) (rvs, res []ast.Expr) {
+	rvs = append([]ast.Expr{}, vs...)
+	res = append([]ast.Expr{}, es...)
+	for _, name := range heapVarNames(hs) {
+		rvs = append(rvs, ast.NewIdent(name))
+		res = append(res, hs[name])
+	}
+	return
+}
+
+// heapFrame は関数呼び出しでヒープの変数が olds から news に変わるときに、
+// 呼び出し先の MODIFIES 以外の確保済みの場所が変わらないことを表す条件式を作成する関数。
+// types は呼び出し側の変数名とその型、args は実引数。
+func (d Data) heapFrame(types map[string]ast.Expr, args []ast.Expr, olds, news map[string]ast.Expr) (r ast.Expr, err error) {
+	iParams, _, _, _ := d.getParams()
+	var mods []ast.Expr
+	mods, err = parseModifies(d.Modifies)
+	if err != nil {
+		return
+	}
+	var items []modItem
+	items, err = modItems(d.paramTypes(), mods)
+	if err != nil {
+		return
+	}
+	vs, es := withHeap(iParams, args, olds)
+	for i, item := range items {
+		items[i].ptr, err = subst(item.ptr, vs, es)
+		if err != nil {
+			return
+		}
+	}
+	r = heapFrame(types, items, olds, news)
+	return
+}
+
 // LoadData はファイルに保存された検証結果データを読みだす関数
 func LoadData(inFile string) (d Data, err error) {
 	err = LoadJSON(inFile, &d)
@@ -0,0 +1,200 @@
+package main
+
+import "testing"
+
+// 関数の中の var と const の宣言は、すべての Spec、初期値、ゼロ値を扱う
+func TestDeclStmt(t *testing.T) {
+	runVerdictTests(t, []verdictTest{
+		{name: "zero value", src: `
+func f(x int) (r int) {
+	PRE("true")
+	var y int
+	var b bool
+	r = y
+	if b {
+		r = x
+	}
+	POST("r == 0")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "zero value ng", src: `
+func f(x int) (r int) {
+	PRE("true")
+	var y int
+	r = y
+	POST("r == 1")
+	return
+}
+`, funcs: []string{"f"}, ok: false},
+		{name: "initial values", src: `
+func f(x int) (r int) {
+	PRE("true")
+	var a, b = 1, 2
+	var c int = 3
+	r = x + a + b - c
+	POST("r == x")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "group", src: `
+func f(x int) (r int) {
+	PRE("true")
+	var (
+		p = 1
+		q bool
+		s, t int
+	)
+	r = x + p + s + t
+	if q {
+		r = 0
+	}
+	POST("r == x + 1")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "const", src: `
+func f(x int) (r int) {
+	PRE("true")
+	const (
+		k0 = iota
+		k1
+		k2
+	)
+	const d = k2 << 1
+	r = x + k1 + d - 4
+	POST("r == x + 1")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "call", src: `
+func g(x int) (u, v int) {
+	PRE("true")
+	u = x
+	v = x + 1
+	POST("u == x && v == x + 1")
+	return
+}
+
+func f(x int) (r int) {
+	PRE("true")
+	var a, b = g(x)
+	r = b - a
+	POST("r == 1")
+	return
+}
+`, funcs: []string{"g", "f"}, ok: true},
+	})
+}
+
+// ブロックの中で宣言した変数は外側の同名の変数を隠し、外側の変数の値を変えない
+func TestDeclShadowing(t *testing.T) {
+	runVerdictTests(t, []verdictTest{
+		{name: "block", src: `
+func f(x int) (r int) {
+	PRE("true")
+	var y = 3
+	{
+		var y = 7
+		y = y + 1
+	}
+	r = y
+	POST("r == 3")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "block ng", src: `
+func f(x int) (r int) {
+	PRE("true")
+	var y = 3
+	{
+		var y = 7
+		y = y + 1
+	}
+	r = y
+	POST("r == 8")
+	return
+}
+`, funcs: []string{"f"}, ok: false},
+		{name: "if body", src: `
+func f(x int) (r int) {
+	PRE("true")
+	y := 1
+	if x > 0 {
+		y := y + 1
+		y = y + x
+	} else {
+		var y int
+		y = x
+	}
+	r = y
+	POST("r == 1")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "switch clause", src: `
+func f(x int) (r int) {
+	PRE("true")
+	y := 1
+	switch x {
+	case 0:
+		y := 2
+		r = y
+	default:
+		r = 0
+	}
+	r = r + y
+	POST("r == 1 || r == 3")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "loop body", src: `
+func f(n int) (r int) {
+	PRE("n >= 0 && n <= 3")
+	x := 1
+	i := 0
+	for i < n {
+		INV("i >= 0 && x == 1")
+		var x int
+		x = i
+		i = x + 1
+	}
+	r = x
+	POST("r == 1")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+	})
+
+	// 受動形と記号実行では、ループの中で宣言した同名の変数への代入でループの外側の変数の値を失わない。
+	// 最弱事前条件ではループを抜けたあとの外側の変数の値は INV で表す必要がある。
+	src := `package main
+
+func f(n int) (r int) {
+	PRE("n >= 0 && n <= 3")
+	i := 2
+	for i := 0; i < n; i++ {
+		INV("i >= 0")
+	}
+	r = i
+	POST("r == 2")
+	return
+}
+
+func g(n int) (r int) {
+	PRE("n >= 0 && n <= 3")
+	x := 1
+	i := 0
+	for i < n {
+		INV("i >= 0")
+		x := i
+		i = x + 1
+	}
+	r = x
+	POST("r == 1")
+	return
+}
+`
+	expectVerdictWith(t, []string{"passive", "symexec"}, src, true, "f")
+	expectVerdictWith(t, []string{"passive", "symexec"}, src, true, "g")
+}
@@ -0,0 +1,457 @@
+// float.go
+// 浮動小数点数の式。SMT の FloatingPoint または Real への変換
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// 浮動小数点数 (float32、float64) は関数ごとに次のどちらかのモードで変換する。
+//
+//	ieee  IEEE 754 の (_ FloatingPoint 11 53) と (_ FloatingPoint 8 24)。NaN、±Inf、-0 を含む。
+//	real  実数 Real。丸め誤差、NaN、Inf のない理想化したモデル。速く検証できるが、IEEE 754 の意味とは異なる。
+//
+// モードは関数の直前のコメントの //hl:float ieee または //hl:float real で選ぶ。
+// 書かないときは設定の float (既定は ieee) とする。
+//
+//	//hl:float real
+//	func mean(x, y float64) (r float64) {
+//
+// ieee では Golang と同じ最近接偶数丸め (RNE) で演算し、== は fp.eq (NaN は自身と等しくなく、+0 と -0 は等しい) とする。
+//
+//	x + y            -> (fp.add RNE x y)          real: (+ x y)
+//	x / y            -> (fp.div RNE x y)          real: (/ x y)
+//	x < y            -> (fp.lt x y)               real: (< x y)
+//	0.1              -> ((_ to_fp 11 53) RNE (/ 1.0 10.0))   real: (/ 1.0 10.0)
+//	0.1 + 0.2        -> ((_ to_fp 11 53) RNE (/ 3.0 10.0))   定数の式は正確な値で畳み込む
+//	float64(i)       -> ((_ to_fp 11 53) RNE (to_real i))     real: (to_real i)
+//	int(x)           -> (to_int (fp.to_real (fp.roundToIntegral RTZ x)))
+//	math.IsNaN(x)    -> (fp.isNaN x)              real: false
+//	math.IsInf(x, 1) -> (and (fp.isInfinite x) (fp.isPositive x))
+//	math.Inf(-1)     -> (_ -oo 11 53)
+//	math.NaN()       -> (_ NaN 11 53)
+//
+// 変数が同じ値であることを表す Identical(x, y) は NaN どうしでも成り立つ (= x y) とする。
+
+const (
+	floatIEEE      = "ieee"
+	floatReal      = "real"
+	floatDirective = "//hl:float"
+	roundingMode   = "RNE" // Golang の浮動小数点数の演算の丸めモード
+)
+
+// floatMode は検証中の関数の浮動小数点数のモード
+var floatMode = floatIEEE
+
+// floatLits はファイルの中の浮動小数点数の型をもつ数値リテラルとその型名 ("float64" または "float32") の表。
+// x = 0 の 0 のように、型のない定数の型を go/types で求めたもの。loadTypes で作成する。
+var floatLits = map[*ast.BasicLit]string{}
+
+// floatConsts は関数本体の中の浮動小数点数の型をもつ定数の式を置き換えた数値リテラルとその値の表。
+// 0.1 + 0.2 のような型のない定数の式は Golang では正確な値で計算されるので、演算ごとに丸めずに
+// go/types で求めた値とする。foldFloatConsts で作成する。
+var floatConsts = map[*ast.BasicLit]constant.Value{}
+
+// funcFloatMode は関数宣言 fd の浮動小数点数のモードを取得する関数
+func funcFloatMode(fd *ast.FuncDecl) (r string, err error) {
+	r = conf.Float
+	if fd.Doc != nil {
+		for _, c := range fd.Doc.List {
+			if fields := strings.Fields(c.Text); len(fields) == 2 && fields[0] == floatDirective {
+				r = fields[1]
+			}
+		}
+	}
+	switch r {
+	case floatIEEE, floatReal:
+	default:
+		err = fmt.Errorf("%s: unknown float mode %q (ieee or real)", funcDeclName(fd), r)
+	}
+	return
+}
+
+// recordFloatLits は型検査の結果 info から浮動小数点数の型をもつ数値リテラルを floatLits に登録する関数
+func recordFloatLits(info *types.Info) {
+	for expr, tv := range info.Types {
+		bl, ok := expr.(*ast.BasicLit)
+		if !ok || tv.Type == nil {
+			continue
+		}
+		if basic, ok := tv.Type.Underlying().(*types.Basic); ok && basic.Info()&types.IsFloat != 0 {
+			switch basic.Kind() {
+			case types.Float32:
+				floatLits[bl] = "float32"
+			case types.Float64, types.UntypedFloat:
+				floatLits[bl] = "float64"
+			}
+		}
+	}
+}
+
+// foldFloatConsts はファイル file の関数本体の中の浮動小数点数の型をもつ定数の式を、
+// 型検査の結果 info で求めた値をもつ数値リテラルに置き換える関数。
+// リテラルの表記は元の式とし、値は floatConsts に登録する。
+func foldFloatConsts(file *ast.File, info *types.Info) {
+	fold := func(exprs ...*ast.Expr) {
+		for _, p := range exprs {
+			if bl := floatConstLit(info, *p); bl != nil {
+				*p = bl
+			}
+		}
+	}
+	foldList := func(exprs []ast.Expr) {
+		for i := range exprs {
+			fold(&exprs[i])
+		}
+	}
+	for _, decl := range file.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || fd.Body == nil {
+			continue
+		}
+		ast.Inspect(fd.Body, func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.AssignStmt:
+				foldList(n.(*ast.AssignStmt).Rhs)
+			case *ast.ValueSpec:
+				foldList(n.(*ast.ValueSpec).Values)
+			case *ast.ReturnStmt:
+				foldList(n.(*ast.ReturnStmt).Results)
+			case *ast.CallExpr:
+				foldList(n.(*ast.CallExpr).Args)
+			case *ast.CompositeLit:
+				foldList(n.(*ast.CompositeLit).Elts)
+			case *ast.CaseClause:
+				foldList(n.(*ast.CaseClause).List)
+			case *ast.BinaryExpr:
+				be := n.(*ast.BinaryExpr)
+				fold(&be.X, &be.Y)
+			case *ast.UnaryExpr:
+				fold(&n.(*ast.UnaryExpr).X)
+			case *ast.ParenExpr:
+				fold(&n.(*ast.ParenExpr).X)
+			case *ast.KeyValueExpr:
+				kv := n.(*ast.KeyValueExpr)
+				fold(&kv.Key, &kv.Value)
+			case *ast.IndexExpr:
+				fold(&n.(*ast.IndexExpr).Index)
+			case *ast.SwitchStmt:
+				fold(&n.(*ast.SwitchStmt).Tag)
+			}
+			return true
+		})
+	}
+}
+
+// floatConstLit は式 expr が浮動小数点数の型をもつ定数の式のとき、その値をもつ数値リテラルを作成する関数。
+// 数値リテラルと名前の付いた定数はそのままにして nil を返す。
+func floatConstLit(info *types.Info, expr ast.Expr) (r *ast.BasicLit) {
+	switch expr.(type) {
+	case *ast.BinaryExpr, *ast.UnaryExpr, *ast.ParenExpr, *ast.CallExpr:
+	default:
+		return
+	}
+	tv, ok := info.Types[expr]
+	if !ok || tv.Value == nil || tv.Type == nil {
+		return
+	}
+	basic, ok := tv.Type.Underlying().(*types.Basic)
+	if !ok || basic.Info()&types.IsFloat == 0 {
+		return
+	}
+	r = &ast.BasicLit{ValuePos: expr.Pos(), Kind: token.FLOAT, Value: nodeString(expr)}
+	floatLits[r] = "float64"
+	if basic.Kind() == types.Float32 {
+		floatLits[r] = "float32"
+	}
+	floatConsts[r] = tv.Value
+	return
+}
+
+// floatTypeName は型が浮動小数点数の型のときその型名 ("float64" または "float32") を返す関数
+func floatTypeName(typ ast.Expr) (r string) {
+	if ident, ok := underlying(typ).(*ast.Ident); ok {
+		switch ident.Name {
+		case "float64", "float32":
+			r = ident.Name
+		}
+	}
+	return
+}
+
+// floatBits は浮動小数点数の型名の指数部と仮数部のビット数を返す関数
+func floatBits(name string) (eb, sb int) {
+	if name == "float32" {
+		return 8, 24
+	}
+	return 11, 53
+}
+
+// floatSort は浮動小数点数の型名 name の SMT のソートを返す関数
+func floatSort(name string) (r string) {
+	if floatMode == floatReal {
+		r = "Real"
+		return
+	}
+	eb, sb := floatBits(name)
+	r = fmt.Sprintf("(_ FloatingPoint %d %d)", eb, sb)
+	return
+}
+
+// floatZero は浮動小数点数の型名 name のゼロ値の SMT の式を返す関数
+func floatZero(name string) (r string) {
+	if floatMode == floatReal {
+		r = "0.0"
+		return
+	}
+	eb, sb := floatBits(name)
+	r = fmt.Sprintf("(_ +zero %d %d)", eb, sb)
+	return
+}
+
+// floatOperandType は二項演算 be のオペランドが浮動小数点数のとき、その型名を返す関数。
+// 型のない定数でないオペランドの型を優先する。
+func floatOperandType(vars map[string]ast.Expr, be *ast.BinaryExpr) (r string) {
+	var lits []string
+	for _, x := range []ast.Expr{be.X, be.Y} {
+		name := floatTypeName(typeOf(vars, x))
+		if name == "" {
+			continue
+		}
+		if isNumLit(x) {
+			lits = append(lits, name)
+			continue
+		}
+		r = name
+		return
+	}
+	if len(lits) > 0 {
+		r = lits[0]
+	}
+	return
+}
+
+// isNumLit は式が数値リテラル (符号つきを含む) かどうか調べる関数
+func isNumLit(expr ast.Expr) bool {
+	switch expr.(type) {
+	case *ast.BasicLit:
+		return expr.(*ast.BasicLit).Kind != token.STRING
+	case *ast.ParenExpr:
+		return isNumLit(expr.(*ast.ParenExpr).X)
+	case *ast.UnaryExpr:
+		ue := expr.(*ast.UnaryExpr)
+		return (ue.Op == token.SUB || ue.Op == token.ADD) && isNumLit(ue.X)
+	}
+	return false
+}
+
+// convFloatLit は数値リテラル bl を浮動小数点数の型名 name の値に変換する関数。
+// リテラルの値は正確な有理数とし、ieee ではそれを丸めた値とする。
+func convFloatLit(bl *ast.BasicLit, name string) (r string) {
+	if v, ok := floatConsts[bl]; ok {
+		// 畳み込んだ定数の式
+		r = convFloatValue(v, name)
+		return
+	}
+	v := constant.ToFloat(constant.MakeFromLiteral(bl.Value, bl.Kind, 0))
+	if v.Kind() == constant.Unknown {
+		r = bl.Value
+		return
+	}
+	r = convFloatValue(v, name)
+	return
+}
+
+// convFloatValue は定数の値 v を浮動小数点数の型名 name の値に変換する関数。
+// 負の値は正の値を変換してから符号を反転する。
+func convFloatValue(v constant.Value, name string) (r string) {
+	if constant.Sign(v) < 0 {
+		r = convFloatNeg(convFloatValue(constant.UnaryOp(token.SUB, v, 0), name))
+		return
+	}
+	v = constant.ToFloat(v)
+	num, den := constant.Num(v).ExactString(), constant.Denom(v).ExactString()
+	r = num + ".0"
+	if den != "1" {
+		r = fmt.Sprintf("(/ %s.0 %s.0)", num, den)
+	}
+	if floatMode == floatIEEE {
+		eb, sb := floatBits(name)
+		r = fmt.Sprintf("((_ to_fp %d %d) %s %s)", eb, sb, roundingMode, r)
+	}
+	return
+}
+
+// convFloatOperand は浮動小数点数の型名 name の演算のオペランド expr を変換する関数。
+// 数値リテラルはその型の値とする。
+func convFloatOperand(expr ast.Expr, name string) (r string) {
+	switch expr.(type) {
+	case *ast.BasicLit:
+		r = convFloatLit(expr.(*ast.BasicLit), name)
+		return
+	case *ast.ParenExpr:
+		r = convFloatOperand(expr.(*ast.ParenExpr).X, name)
+		return
+	case *ast.UnaryExpr:
+		if ue := expr.(*ast.UnaryExpr); isNumLit(ue) {
+			r = convFloatOperand(ue.X, name)
+			if ue.Op == token.SUB {
+				r = convFloatNeg(r)
+			}
+			return
+		}
+	}
+	r = convExpr(expr)
+	return
+}
+
+// convFloatNeg は浮動小数点数の符号を反転する式を作成する関数
+func convFloatNeg(x string) string {
+	if floatMode == floatReal {
+		return fmt.Sprintf("(- %s)", x)
+	}
+	return fmt.Sprintf("(fp.neg %s)", x)
+}
+
+// floatOps は浮動小数点数の二項演算子と ieee、real での SMT の関数
+var floatOps = map[token.Token][2]string{
+	token.ADD: {"fp.add", "+"},
+	token.SUB: {"fp.sub", "-"},
+	token.MUL: {"fp.mul", "*"},
+	token.QUO: {"fp.div", "/"},
+	token.EQL: {"fp.eq", "="},
+	token.NEQ: {"fp.eq", "="},
+	token.LSS: {"fp.lt", "<"},
+	token.GTR: {"fp.gt", ">"},
+	token.LEQ: {"fp.leq", "<="},
+	token.GEQ: {"fp.geq", ">="},
+}
+
+// convFloatBinary はオペランドが浮動小数点数の型名 name の二項演算 be を変換する関数
+func convFloatBinary(be *ast.BinaryExpr, name string) (r string) {
+	ops, ok := floatOps[be.Op]
+	if !ok {
+		printNode(be)
+		panic("unknown float operator " + be.Op.String())
+	}
+	x, y := convFloatOperand(be.X, name), convFloatOperand(be.Y, name)
+	switch {
+	case floatMode == floatReal:
+		r = fmt.Sprintf("(%s %s %s)", ops[1], x, y)
+	case be.Op == token.ADD || be.Op == token.SUB || be.Op == token.MUL || be.Op == token.QUO:
+		r = fmt.Sprintf("(%s %s %s %s)", ops[0], roundingMode, x, y)
+	default:
+		r = fmt.Sprintf("(%s %s %s)", ops[0], x, y)
+	}
+	if be.Op == token.NEQ {
+		r = fmt.Sprintf("(not %s)", r)
+	}
+	return
+}
+
+// convConversion は数値の型の変換 T(x) を変換する関数。T は int、byte、rune、float64 または float32。
+func convConversion(name string, arg ast.Expr) (r string) {
+	from := floatTypeName(typeOf(convEnv, arg))
+	to := floatTypeName(ast.NewIdent(name))
+	switch {
+	case to != "" && isNumLit(arg):
+		r = convFloatOperand(arg, to)
+	case to != "" && from == "":
+		// 整数から浮動小数点数へ
+		r = fmt.Sprintf("(to_real %s)", convExpr(arg))
+		if floatMode == floatIEEE {
+			eb, sb := floatBits(to)
+			r = fmt.Sprintf("((_ to_fp %d %d) %s %s)", eb, sb, roundingMode, r)
+		}
+	case to != "" && from != to && floatMode == floatIEEE:
+		// 浮動小数点数の精度の変換
+		eb, sb := floatBits(to)
+		r = fmt.Sprintf("((_ to_fp %d %d) %s %s)", eb, sb, roundingMode, convExpr(arg))
+	case to == "" && from != "":
+		// 浮動小数点数から整数へ。0 の方向に切り捨てる。
+		x := convExpr(arg)
+		if floatMode == floatIEEE {
+			r = fmt.Sprintf("(to_int (fp.to_real (fp.roundToIntegral RTZ %s)))", x)
+		} else {
+			r = fmt.Sprintf("(ite (>= %s 0.0) (to_int %s) (- (to_int (- %s))))", x, x, x)
+		}
+	default:
+		r = convExpr(arg)
+	}
+	return
+}
+
+// mathFuncs は SMT の式に変換できる math パッケージの関数と結果の型の表
+var mathFuncs = map[string]string{
+	"IsNaN": "bool",
+	"IsInf": "bool",
+	"Inf":   "float64",
+	"NaN":   "float64",
+}
+
+// isMathCall は呼び出しが mathFuncs の math パッケージの関数の呼び出しかどうか調べる関数。
+// 呼び出しのときは関数名を name に返す。
+func isMathCall(ce *ast.CallExpr) (name string, ok bool) {
+	se, isSel := ce.Fun.(*ast.SelectorExpr)
+	if !isSel {
+		return
+	}
+	if pkg, isIdent := se.X.(*ast.Ident); !isIdent || pkg.Name != "math" {
+		return
+	}
+	if _, ok = mathFuncs[se.Sel.Name]; ok {
+		name = se.Sel.Name
+	}
+	return
+}
+
+// convMathCall は math パッケージの関数 name の呼び出しを変換する関数。
+// math.IsInf と math.Inf の符号は定数とする。定数でないときや、real で実数でない値を作るときは convFail で記録する。
+func convMathCall(name string, ce *ast.CallExpr) (r string) {
+	sign := 0
+	if name == "IsInf" || name == "Inf" {
+		tv, err := types.Eval(token.NewFileSet(), specPkg, token.NoPos, nodeString(ce.Args[len(ce.Args)-1]))
+		if err != nil || tv.Value == nil {
+			r = convFail(ce, "math."+name+" with non-constant sign")
+			return
+		}
+		sign = constant.Sign(tv.Value)
+	}
+	if floatMode == floatReal {
+		switch name {
+		case "IsNaN", "IsInf":
+			r = "false"
+		default:
+			r = convFail(ce, "math."+name+" in real mode")
+		}
+		return
+	}
+	eb, sb := floatBits("float64")
+	switch name {
+	case "IsNaN":
+		r = fmt.Sprintf("(fp.isNaN %s)", convExpr(ce.Args[0]))
+	case "IsInf":
+		x := convExpr(ce.Args[0])
+		r = fmt.Sprintf("(fp.isInfinite %s)", x)
+		switch {
+		case sign > 0:
+			r = fmt.Sprintf("(and %s (fp.isPositive %s))", r, x)
+		case sign < 0:
+			r = fmt.Sprintf("(and %s (fp.isNegative %s))", r, x)
+		}
+	case "Inf":
+		r = fmt.Sprintf("(_ +oo %d %d)", eb, sb)
+		if sign < 0 {
+			r = fmt.Sprintf("(_ -oo %d %d)", eb, sb)
+		}
+	case "NaN":
+		r = fmt.Sprintf("(_ NaN %d %d)", eb, sb)
+	}
+	return
+}
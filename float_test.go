@@ -0,0 +1,139 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// 浮動小数点数の式のソース。f は既定の ieee、g は real のモードで変換する
+const floatSrc = `package main
+
+import "math"
+
+func f(x, y float64, i int, z float32) (r float64) {
+	PRE("!math.IsNaN(x) && x < y && z > 0")
+	r = (x+y)/2 + 0.1 + float64(i)
+	POST("r == r || math.IsInf(r, 1)")
+	return
+}
+
+//hl:float real
+func g(x, y float64) (r float64) {
+	PRE("x < y")
+	r = (x + y) / 2
+	POST("x <= r && r <= y && !math.IsNaN(r)")
+	return
+}
+`
+
+func TestFloatSMT(t *testing.T) {
+	expectSMT(t, floatSrc, []string{"f"},
+		"(declare-const x (_ FloatingPoint 11 53))",
+		"(declare-const z (_ FloatingPoint 8 24))",
+		"(not (fp.isNaN x))",
+		"(fp.lt x y)",
+		"(fp.add RNE x y)",
+		"(fp.div RNE ",
+		"((_ to_fp 11 53) RNE (/ 1.0 10.0))",
+		"((_ to_fp 11 53) RNE (to_real i))",
+		"(fp.eq ",
+		"(fp.isInfinite ")
+}
+
+func TestFloatRealSMT(t *testing.T) {
+	expectSMT(t, floatSrc, []string{"g"},
+		"(declare-const x Real)",
+		"(< x y)",
+		"(+ x y)")
+	for _, vcgen := range vcgens {
+		for _, script := range smtScripts(t, vcgen, floatSrc, "g") {
+			if strings.Contains(script, "fp.") || strings.Contains(script, "FloatingPoint") {
+				t.Errorf("%s: FloatingPoint in real mode:\n%s", vcgen, script)
+			}
+		}
+	}
+}
+
+// 定数の式は Golang と同じく正確な値で計算してから丸める。0.1 + 0.2 は 0.3 と同じ値になる
+func TestFloatConstFold(t *testing.T) {
+	src := `package main
+
+func h() (r bool) {
+	PRE("true")
+	x := 0.1 + 0.2
+	r = x != 0.3
+	POST("r")
+	return
+}
+`
+	expectSMT(t, src, []string{"h"}, "((_ to_fp 11 53) RNE (/ 3.0 10.0))")
+	for _, vcgen := range vcgens {
+		for _, script := range smtScripts(t, vcgen, src, "h") {
+			if strings.Contains(script, "fp.add") || strings.Contains(script, "(/ 1.0 10.0)") {
+				t.Errorf("%s: constant expression is not folded:\n%s", vcgen, script)
+			}
+		}
+	}
+}
+
+// real で実数でない値を作る math の関数と、符号が定数でない math.IsInf はパニックせずにエラーにする
+func TestMathCallErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		mode string
+		post string
+		want string
+	}{
+		{"Inf in real", "real", "r < math.Inf(1)", "math.Inf in real mode"},
+		{"NaN in real", "real", "r != math.NaN()", "math.NaN in real mode"},
+		{"IsInf with variable sign", "ieee", "!math.IsInf(r, n)", "math.IsInf with non-constant sign"},
+	}
+	for _, tt := range tests {
+		src := `package main
+
+import "math"
+
+//hl:float ` + tt.mode + `
+func f(x float64, n int) (r float64) {
+	PRE("x > 0")
+	r = x
+	POST("` + tt.post + `")
+	return
+}
+`
+		for _, vcgen := range vcgens {
+			t.Run(tt.name+"/"+vcgen, func(t *testing.T) {
+				err := verifyFuncs(t, vcgen, src, "f")
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("want error %q, got %v", tt.want, err)
+				}
+			})
+		}
+	}
+}
+
+// 関数ごとの //hl:float の指示は ieee か real に限る
+func TestFuncFloatMode(t *testing.T) {
+	src := `package main
+
+//hl:float real
+func g(x float64) (r float64) {
+	r = x
+	return
+}
+
+//hl:float double
+func h(x float64) (r float64) {
+	r = x
+	return
+}
+`
+	fileNode := setupSrc(t, src+specStubs)
+	if mode, err := funcFloatMode(pickupFuncDecl(fileNode, "g")); err != nil || mode != floatReal {
+		t.Errorf("g: got %s, %v", mode, err)
+	}
+	_, err := funcFloatMode(pickupFuncDecl(fileNode, "h"))
+	if err == nil || !strings.Contains(err.Error(), `unknown float mode "double"`) {
+		t.Errorf("h: got %v", err)
+	}
+}
@@ -0,0 +1,883 @@
+// heap.go
+// ポインタとヒープのモデル
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// ポインタの値は位置を表す整数とし、nil は 0 とする。
+// ポインタが指す先の値は、指す先の型 T ごとに位置から値への配列 heap$T で表し、
+// 確保済みの位置は位置から真偽値への配列 alloc$ で表す。
+//
+//   *p               => heap$T[p]
+//   p.x              => heap$T[p].x  (p が *T のとき)
+//   *p = e           => heap$T = Store(heap$T, p, e)
+//   p = &T{...}      => 未確保の位置 l を選び、alloc$[l] を true に、heap$T[l] を初期値にして p = l
+//
+// 関数の MODIFIES("p.x, q") は関数が変更してよいヒープの場所を表す。
+// p.x はポインタ p の指す先のフィールド x、q はポインタ q の指す先の値全体である。
+// 呼び出しの前から確保済みの場所のうち MODIFIES にないものは、呼び出しの前後で変わらない。
+
+// allocName は確保済みの位置を表す配列の名前
+const allocName = "alloc$"
+
+// heapPrefix は指す先の型ごとのヒープを表す配列の名前の接頭辞
+const heapPrefix = "heap$"
+
+// modItem は MODIFIES で指定された変更してよいヒープの場所
+type modItem struct {
+	typ   ast.Expr // ポインタの指す先の型
+	ptr   ast.Expr // ポインタの式
+	field string   // フィールド名。指す先の値全体のときは ""
+}
+
+// pointee はポインタ型の指す先の型を取得する関数。ポインタ型でないときは nil を返す。
+func pointee(typ ast.Expr) (r ast.Expr) {
+	if se, ok := underlying(typ).(*ast.StarExpr); ok {
+		r = se.X
+	}
+	return
+}
+
+// isHeapVar はヒープのモデルのための変数名かどうか調べる関数。入口での値を表す変数は含めない。
+func isHeapVar(name string) bool {
+	if strings.HasSuffix(name, oldSuffix) {
+		return false
+	}
+	return name == allocName || strings.HasPrefix(name, heapPrefix)
+}
+
+// heapVarNames は変数名の表の中のヒープのモデルのための変数名を名前の順に取得する関数
+func heapVarNames(vars map[string]ast.Expr) (r []string) {
+	for name := range vars {
+		if isHeapVar(name) {
+			r = append(r, name)
+		}
+	}
+	sort.Strings(r)
+	return
+}
+
+// heapRef は型 typ の値を指すポインタのヒープの変数を取得する関数。
+// ヒープの変数と alloc$ は変数名の表 vars に登録する。
+func heapRef(vars map[string]ast.Expr, typ ast.Expr) (r *ast.Ident, err error) {
+	ident, ok := typ.(*ast.Ident)
+	if !ok {
+		err = fmt.Errorf("heap: pointer to %s is not supported", typeString(typ))
+		return
+	}
+	r = ast.NewIdent(heapPrefix + ident.Name)
+	if vars[r.Name] == nil {
+		vars[r.Name] = &ast.ArrayType{Elt: typ}
+	}
+	if vars[allocName] == nil {
+		vars[allocName] = &ast.ArrayType{Elt: ast.NewIdent("bool")}
+	}
+	return
+}
+
+// addHeapVars は型 typ の値からたどれるポインタのヒープの変数を変数名の表 vars に登録する関数。
+// 構造体のフィールドのポインタもたどる。
+func addHeapVars(vars map[string]ast.Expr, typ ast.Expr) (err error) {
+	seen := map[string]bool{}
+	var visit func(typ ast.Expr) error
+	visit = func(typ ast.Expr) (err error) {
+		if t := pointee(typ); t != nil {
+			var h *ast.Ident
+			h, err = heapRef(vars, t)
+			if err != nil || seen[h.Name] {
+				return
+			}
+			seen[h.Name] = true
+			typ = t
+		}
+		if _, st := structOf(typ); st != nil {
+			_, types := structFields(st)
+			for _, t := range types {
+				if err = visit(t); err != nil {
+					return
+				}
+			}
+		}
+		return
+	}
+	err = visit(typ)
+	return
+}
+
+// allocated はポインタ型の変数 xs が nil でなければ確保済みであることを表す条件式を作成する関数。
+// types は xs の型、alloc は確保済みの位置を表す配列の式。ポインタ型の変数がないときは true とする。
+func allocated(xs, types []ast.Expr, alloc ast.Expr) (r ast.Expr) {
+	var conds []ast.Expr
+	for i, x := range xs {
+		if pointee(types[i]) == nil {
+			continue
+		}
+		conds = append(conds, astImplies(
+			&ast.BinaryExpr{X: x, Op: token.NEQ, Y: &ast.BasicLit{Kind: token.INT, Value: "0"}},
+			&ast.IndexExpr{X: alloc, Index: x}))
+	}
+	if len(conds) == 0 {
+		r = ast.NewIdent("true")
+		return
+	}
+	r = astAnds(conds...)
+	return
+}
+
+// allocOf は式がポインタの確保 &T{...} もしくは new(T) かどうか調べる関数。
+// 確保のときは指す先の型と初期値を返す。
+func allocOf(expr ast.Expr) (typ, init ast.Expr, ok bool) {
+	switch expr.(type) {
+	case *ast.UnaryExpr:
+		ue := expr.(*ast.UnaryExpr)
+		cl, isLit := ue.X.(*ast.CompositeLit)
+		if ue.Op == token.AND && isLit {
+			typ, init, ok = cl.Type, cl, true
+		}
+	case *ast.CallExpr:
+		ce := expr.(*ast.CallExpr)
+		ident, isIdent := ce.Fun.(*ast.Ident)
+		if isIdent && ident.Name == "new" && len(ce.Args) == 1 {
+			typ, init = ce.Args[0], zeroExpr(ce.Args[0])
+			ok = init != nil
+		}
+	}
+	return
+}
+
+// zeroExpr は型のゼロ値の式を作成する関数。ゼロ値を式で表せない型のときは nil を返す。
+func zeroExpr(typ ast.Expr) (r ast.Expr) {
+	if _, st := structOf(typ); st != nil {
+		r = &ast.CompositeLit{Type: typ}
+		return
+	}
+	if mapTypeOf(typ) != nil {
+		r = &ast.CallExpr{Fun: ast.NewIdent("make"), Args: []ast.Expr{typ}}
+		return
+	}
+	if name := floatTypeName(typ); name != "" {
+		// float32(0.0) のように型を明示する
+		r = &ast.CallExpr{Fun: ast.NewIdent(name), Args: []ast.Expr{&ast.BasicLit{Kind: token.FLOAT, Value: "0.0"}}}
+		return
+	}
+	switch convType(typ) {
+	case "Int":
+		r = &ast.BasicLit{Kind: token.INT, Value: "0"}
+	case "Bool":
+		r = ast.NewIdent("false")
+	case "String":
+		r = &ast.BasicLit{Kind: token.STRING, Value: `""`}
+	}
+	return
+}
+
+// heapify は式の中のポインタの参照をヒープの配列の参照に直す関数。
+// 使われたヒープの変数は変数名の表 vars に登録する。
+func heapify(vars map[string]ast.Expr, expr ast.Expr) (r ast.Expr, err error) {
+	r = expr
+	switch expr.(type) {
+	case *ast.Ident:
+		if expr.(*ast.Ident).Name == "nil" {
+			r = &ast.BasicLit{Kind: token.INT, Value: "0"}
+		}
+	case *ast.StarExpr:
+		// *p => heap$T[p]
+		var x ast.Expr
+		x, err = heapify(vars, expr.(*ast.StarExpr).X)
+		if err != nil {
+			return
+		}
+		r, err = deref(vars, x)
+	case *ast.SelectorExpr:
+		// p.x => heap$T[p].x
+		se := expr.(*ast.SelectorExpr)
+		var x ast.Expr
+		x, err = heapify(vars, se.X)
+		if err != nil {
+			return
+		}
+		if pointee(typeOf(vars, x)) != nil {
+			x, err = deref(vars, x)
+			if err != nil {
+				return
+			}
+		}
+		r = &ast.SelectorExpr{X: x, Sel: se.Sel}
+	case *ast.IndexExpr:
+		ie := expr.(*ast.IndexExpr)
+		var x, index ast.Expr
+		x, err = heapify(vars, ie.X)
+		if err != nil {
+			return
+		}
+		index, err = heapify(vars, ie.Index)
+		if err != nil {
+			return
+		}
+		r = &ast.IndexExpr{X: x, Index: index}
+	case *ast.ParenExpr:
+		var x ast.Expr
+		x, err = heapify(vars, expr.(*ast.ParenExpr).X)
+		r = &ast.ParenExpr{X: x}
+	case *ast.BinaryExpr:
+		be := expr.(*ast.BinaryExpr)
+		var x, y ast.Expr
+		x, err = heapify(vars, be.X)
+		if err != nil {
+			return
+		}
+		y, err = heapify(vars, be.Y)
+		r = &ast.BinaryExpr{X: x, Op: be.Op, Y: y}
+	case *ast.UnaryExpr:
+		ue := expr.(*ast.UnaryExpr)
+		if ue.Op == token.AND {
+			err = fmt.Errorf("heap: address of %s is only supported in assignment", typeString(ue.X))
+			return
+		}
+		var x ast.Expr
+		x, err = heapify(vars, ue.X)
+		r = &ast.UnaryExpr{Op: ue.Op, X: x}
+	case *ast.CompositeLit:
+		cl := expr.(*ast.CompositeLit)
+		var elts []ast.Expr
+		for _, elt := range cl.Elts {
+			var x ast.Expr
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				x, err = heapify(vars, kv.Value)
+				x = &ast.KeyValueExpr{Key: kv.Key, Value: x}
+			} else {
+				x, err = heapify(vars, elt)
+			}
+			if err != nil {
+				return
+			}
+			elts = append(elts, x)
+		}
+		r = &ast.CompositeLit{Type: cl.Type, Elts: elts}
+	case *ast.CallExpr:
+		r, err = heapifyCall(vars, expr.(*ast.CallExpr))
+	}
+	return
+}
+
+// heapifyCall は関数呼び出しの引数の中のポインタの参照をヒープの配列の参照に直す関数。
+// 限量子と Let の束縛変数はその型で参照する。
+func heapifyCall(vars map[string]ast.Expr, ce *ast.CallExpr) (r ast.Expr, err error) {
+	if _, _, ok := allocOf(ce); ok {
+		err = fmt.Errorf("heap: new is only supported in assignment")
+		return
+	}
+
+	// 限量子の範囲 lo と hi は束縛変数の外側の式。quant.go 参照。
+	if q, ok, e := quantOf(ce); ok {
+		if e != nil {
+			err = e
+			return
+		}
+		q, err = q.mapQuant(func(x ast.Expr) (ast.Expr, error) {
+			return heapify(vars, x)
+		}, func(x ast.Expr) (ast.Expr, error) {
+			return heapifyBound(vars, q.names, q.types, x)
+		})
+		if err != nil {
+			return
+		}
+		r = q.call()
+		return
+	}
+
+	args := append([]ast.Expr{}, ce.Args...)
+	if ident, ok := ce.Fun.(*ast.Ident); ok && ident.Name == "Let" && len(args) == 3 {
+		args[1], err = heapify(vars, args[1])
+		if err != nil {
+			return
+		}
+		if name := binderName(args[0]); name != "" {
+			x := ast.NewIdent(name)
+			args[2], err = heapifyBound(vars, []*ast.Ident{x}, []ast.Expr{typeOf(vars, args[1])}, args[2])
+			r = &ast.CallExpr{Fun: ce.Fun, Args: args}
+			return
+		}
+	}
+	for i, arg := range args {
+		args[i], err = heapify(vars, arg)
+		if err != nil {
+			return
+		}
+	}
+	r = &ast.CallExpr{Fun: ce.Fun, Args: args}
+	return
+}
+
+// heapifyBound は束縛変数 names をその型 types で一時的に変数名の表 vars に登録して式 expr を変換する関数。
+// ヒープの変数の登録は残す。
+func heapifyBound(vars map[string]ast.Expr, names []*ast.Ident, types []ast.Expr, expr ast.Expr) (r ast.Expr, err error) {
+	saved := map[string]ast.Expr{}
+	for i, x := range names {
+		if typ, found := vars[x.Name]; found {
+			saved[x.Name] = typ
+		}
+		vars[x.Name] = types[i]
+	}
+	r, err = heapify(vars, expr)
+	for _, x := range names {
+		if typ, found := saved[x.Name]; found {
+			vars[x.Name] = typ
+		} else {
+			delete(vars, x.Name)
+		}
+	}
+	return
+}
+
+// binderName は Let の束縛変数の名前を取得する関数。
+// 束縛変数は文字列リテラルで書かれることもある。
+func binderName(expr ast.Expr) (r string) {
+	switch expr.(type) {
+	case *ast.Ident:
+		r = expr.(*ast.Ident).Name
+	case *ast.BasicLit:
+		bl := expr.(*ast.BasicLit)
+		if bl.Kind == token.STRING {
+			r = bl.Value[1 : len(bl.Value)-1]
+		}
+	}
+	return
+}
+
+// deref はヒープの変換済みのポインタの式 x の指す先 heap$T[x] を作成する関数
+func deref(vars map[string]ast.Expr, x ast.Expr) (r ast.Expr, err error) {
+	t := pointee(typeOf(vars, x))
+	if t == nil {
+		err = fmt.Errorf("heap: %s is not a pointer", typeString(x))
+		return
+	}
+	var h *ast.Ident
+	h, err = heapRef(vars, t)
+	if err != nil {
+		return
+	}
+	r = &ast.IndexExpr{X: h, Index: x}
+	return
+}
+
+// heapifyStmts は文のリストの中のポインタの参照をヒープの配列の参照に直す関数。
+// := で宣言されたローカル変数の型も変数名の表 vars に登録する。
+func heapifyStmts(vars map[string]ast.Expr, stmts []ast.Stmt) (r []ast.Stmt, err error) {
+	for _, stmt := range stmts {
+		var ss []ast.Stmt
+		ss, err = heapifyStmt(vars, stmt)
+		if err != nil {
+			return
+		}
+		r = append(r, ss...)
+	}
+	return
+}
+
+// heapifyStmt は文の中のポインタの参照をヒープの配列の参照に直す関数。
+// フィールドへの確保の代入 n.next = &Node{} は一時変数への確保と代入のふたつの文に分ける。
+func heapifyStmt(vars map[string]ast.Expr, stmt ast.Stmt) (r []ast.Stmt, err error) {
+	if stmt == nil {
+		r = []ast.Stmt{nil}
+		return
+	}
+	switch stmt.(type) {
+	case *ast.AssignStmt:
+		r, err = heapifyAssign(vars, stmt.(*ast.AssignStmt))
+		return
+	case *ast.IncDecStmt:
+		s := stmt.(*ast.IncDecStmt)
+		var x ast.Expr
+		x, err = heapify(vars, s.X)
+		stmt = &ast.IncDecStmt{X: x, Tok: s.Tok}
+	case *ast.IfStmt:
+		s := *stmt.(*ast.IfStmt)
+		if s.Init, err = heapifyOne(vars, s.Init); err != nil {
+			return
+		}
+		if s.Cond, err = heapify(vars, s.Cond); err != nil {
+			return
+		}
+		if s.Body, err = heapifyBlock(vars, s.Body); err != nil {
+			return
+		}
+		s.Else, err = heapifyOne(vars, s.Else)
+		stmt = &s
+	case *ast.ForStmt:
+		s := *stmt.(*ast.ForStmt)
+		if s.Init, err = heapifyOne(vars, s.Init); err != nil {
+			return
+		}
+		if s.Cond != nil {
+			if s.Cond, err = heapify(vars, s.Cond); err != nil {
+				return
+			}
+		}
+		if s.Post, err = heapifyOne(vars, s.Post); err != nil {
+			return
+		}
+		s.Body, err = heapifyBlock(vars, s.Body)
+		stmt = &s
+	case *ast.SwitchStmt:
+		s := *stmt.(*ast.SwitchStmt)
+		if s.Init, err = heapifyOne(vars, s.Init); err != nil {
+			return
+		}
+		if s.Tag != nil {
+			if s.Tag, err = heapify(vars, s.Tag); err != nil {
+				return
+			}
+		}
+		body := &ast.BlockStmt{}
+		for _, c := range s.Body.List {
+			cc := *c.(*ast.CaseClause)
+			var list []ast.Expr
+			for _, e := range cc.List {
+				var x ast.Expr
+				if x, err = heapify(vars, e); err != nil {
+					return
+				}
+				list = append(list, x)
+			}
+			cc.List = list
+			if cc.Body, err = heapifyStmts(vars, cc.Body); err != nil {
+				return
+			}
+			body.List = append(body.List, &cc)
+		}
+		s.Body = body
+		stmt = &s
+	case *ast.BlockStmt:
+		stmt, err = heapifyBlock(vars, stmt.(*ast.BlockStmt))
+	case *ast.DeclStmt:
+		stmt, err = heapifyDecl(vars, stmt.(*ast.DeclStmt))
+	case *ast.ReturnStmt:
+		s := stmt.(*ast.ReturnStmt)
+		var results []ast.Expr
+		for _, e := range s.Results {
+			var x ast.Expr
+			if x, err = heapify(vars, e); err != nil {
+				return
+			}
+			results = append(results, x)
+		}
+		if len(s.Results) == 1 {
+			if ce, ok := s.Results[0].(*ast.CallExpr); ok {
+				if _, err = addCalleeHeapVars(vars, ce); err != nil {
+					return
+				}
+			}
+		}
+		stmt = &ast.ReturnStmt{Results: results}
+	case *ast.ExprStmt:
+		stmt, err = heapifyExprStmt(vars, stmt.(*ast.ExprStmt))
+	}
+	r = []ast.Stmt{stmt}
+	return
+}
+
+// heapifyOne はひとつの文のままでなければならない if 文の初期化文などを変換する関数
+func heapifyOne(vars map[string]ast.Expr, stmt ast.Stmt) (r ast.Stmt, err error) {
+	var ss []ast.Stmt
+	ss, err = heapifyStmt(vars, stmt)
+	if err != nil {
+		return
+	}
+	if len(ss) != 1 {
+		err = fmt.Errorf("heap: allocation to field is not supported here")
+		return
+	}
+	r = ss[0]
+	return
+}
+
+// heapifyBlock はブロックの中の文を変換する関数
+func heapifyBlock(vars map[string]ast.Expr, block *ast.BlockStmt) (r *ast.BlockStmt, err error) {
+	r = &ast.BlockStmt{}
+	r.List, err = heapifyStmts(vars, block.List)
+	return
+}
+
+// heapifyAssign は代入文を変換する関数。:= で宣言された変数の型は右辺の型とする。
+func heapifyAssign(vars map[string]ast.Expr, s *ast.AssignStmt) (r []ast.Stmt, err error) {
+	// 右辺が確保のときは初期値だけを変換する
+	if len(s.Rhs) == 1 {
+		if typ, init, ok := allocOf(s.Rhs[0]); ok {
+			if _, err = heapRef(vars, typ); err != nil {
+				return
+			}
+			if init, err = heapify(vars, init); err != nil {
+				return
+			}
+			var rhs ast.Expr = &ast.UnaryExpr{Op: token.AND, X: init}
+			if _, isLit := init.(*ast.CompositeLit); !isLit {
+				rhs = &ast.CallExpr{Fun: ast.NewIdent("new"), Args: []ast.Expr{typ}}
+			}
+			if len(s.Lhs) == 1 {
+				if ident, isIdent := s.Lhs[0].(*ast.Ident); isIdent {
+					if s.Tok == token.DEFINE {
+						vars[ident.Name] = &ast.StarExpr{X: typ}
+					}
+					r = []ast.Stmt{&ast.AssignStmt{Lhs: s.Lhs, Tok: s.Tok, Rhs: []ast.Expr{rhs}}}
+					return
+				}
+			}
+			// 変数でない左辺への確保は一時変数を経由する
+			tmp := FreshIdents(1)[0]
+			vars[tmp.(*ast.Ident).Name] = &ast.StarExpr{X: typ}
+			r = append(r, &ast.AssignStmt{Lhs: []ast.Expr{tmp}, Tok: token.DEFINE, Rhs: []ast.Expr{rhs}})
+			var ss []ast.Stmt
+			ss, err = heapifyAssign(vars, &ast.AssignStmt{Lhs: s.Lhs, Tok: s.Tok, Rhs: []ast.Expr{tmp}})
+			r = append(r, ss...)
+			return
+		}
+	}
+
+	// 右辺が検証済みの関数の呼び出しのときは、結果の型を := で宣言された変数の型とする
+	var outTypes []ast.Expr
+	if len(s.Rhs) == 1 {
+		if ce, ok := s.Rhs[0].(*ast.CallExpr); ok {
+			if outTypes, err = addCalleeHeapVars(vars, ce); err != nil {
+				return
+			}
+		}
+	}
+
+	as := &ast.AssignStmt{Tok: s.Tok}
+	for _, e := range s.Rhs {
+		var x ast.Expr
+		if x, err = heapify(vars, e); err != nil {
+			return
+		}
+		as.Rhs = append(as.Rhs, x)
+	}
+	for i, v := range s.Lhs {
+		if ident, ok := v.(*ast.Ident); ok && s.Tok == token.DEFINE && len(s.Lhs) == len(outTypes) {
+			vars[ident.Name] = outTypes[i]
+		} else if ok && s.Tok == token.DEFINE && len(s.Lhs) == len(s.Rhs) {
+			if typ := typeOf(vars, as.Rhs[i]); typ != nil {
+				vars[ident.Name] = typ
+				if err = addHeapVars(vars, typ); err != nil {
+					return
+				}
+			}
+		}
+		var x ast.Expr
+		if x, err = heapify(vars, v); err != nil {
+			return
+		}
+		as.Lhs = append(as.Lhs, x)
+	}
+	r = []ast.Stmt{as}
+	return
+}
+
+// addCalleeHeapVars は検証済みの関数の呼び出し ce の入出力パラメータの型からたどれるヒープの変数を登録する関数。
+// 呼び出し先が変更するヒープを呼び出し側でも扱えるようにする。outTypes には出力パラメータの型が返る。
+// 検証済みの関数の呼び出しでないときは何もしない。
+func addCalleeHeapVars(vars map[string]ast.Expr, ce *ast.CallExpr) (outTypes []ast.Expr, err error) {
+	funData, _, e := getCallData(vars, ce)
+	if e != nil {
+		return
+	}
+	_, _, inTypes, outTypes := funData.getParams()
+	for _, typ := range append(append([]ast.Expr{}, inTypes...), outTypes...) {
+		if err = addHeapVars(vars, typ); err != nil {
+			return
+		}
+	}
+	return
+}
+
+// heapifyDecl は変数宣言を変換する関数。宣言された変数の型を登録する。
+func heapifyDecl(vars map[string]ast.Expr, ds *ast.DeclStmt) (r ast.Stmt, err error) {
+	r = ds
+	gd, ok := ds.Decl.(*ast.GenDecl)
+	if !ok || gd.Tok != token.VAR {
+		return
+	}
+	decl := *gd
+	decl.Specs = nil
+	for _, spec := range gd.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			decl.Specs = append(decl.Specs, spec)
+			continue
+		}
+		v := *vs
+		v.Values = nil
+		for _, e := range vs.Values {
+			var x ast.Expr
+			if x, err = heapify(vars, e); err != nil {
+				return
+			}
+			v.Values = append(v.Values, x)
+		}
+		if vs.Type != nil {
+			if err = addHeapVars(vars, vs.Type); err != nil {
+				return
+			}
+		}
+		decl.Specs = append(decl.Specs, &v)
+	}
+	r = &ast.DeclStmt{Decl: &decl}
+	return
+}
+
+// heapifyExprStmt は式文を変換する関数。
+// INV などの表明文は文字列をパースして変換した式を引数とする表明文に直す。
+// 関数呼び出しは引数だけを変換する。メソッドのレシーバはそのままとする。
+func heapifyExprStmt(vars map[string]ast.Expr, es *ast.ExprStmt) (r ast.Stmt, err error) {
+	r = es
+	ce, ok := es.X.(*ast.CallExpr)
+	if !ok {
+		return
+	}
+	if tag, cond, ok := isAssertStmt(es); ok && tag != "MODIFIES" {
+		if cond, err = heapify(vars, cond); err != nil {
+			return
+		}
+		r = &ast.ExprStmt{X: &ast.CallExpr{Fun: ast.NewIdent(tag), Args: []ast.Expr{cond}}}
+		return
+	}
+	if _, err = addCalleeHeapVars(vars, ce); err != nil {
+		return
+	}
+	call := &ast.CallExpr{Fun: ce.Fun}
+	for _, arg := range ce.Args {
+		var x ast.Expr
+		if x, err = heapify(vars, arg); err != nil {
+			return
+		}
+		call.Args = append(call.Args, x)
+	}
+	r = &ast.ExprStmt{X: call}
+	return
+}
+
+// heapifyFunc は関数の事前・事後条件と本体の文のポインタの参照をヒープの配列の参照に直す関数。
+// 関数の変数名の表 vars にはヒープの変数を登録する。
+// ヒープを使う関数では、事後条件に MODIFIES 以外の場所が入口での値から変わらないことを加える。
+// また nil でないポインタの入力パラメータは確保済みであることを仮定し、出力パラメータも確保済みであることを検証する。
+func heapifyFunc(vars map[string]ast.Expr, preCond, postCond, modifies ast.Expr, results []ast.Expr, stmts []ast.Stmt) (pre, post ast.Expr, r []ast.Stmt, err error) {
+	var params, paramTypes, resultTypes []ast.Expr
+	var names []string
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if !containsExpr(results, ast.NewIdent(name)) {
+			params = append(params, ast.NewIdent(name))
+			paramTypes = append(paramTypes, vars[name])
+		}
+		if err = addHeapVars(vars, vars[name]); err != nil {
+			return
+		}
+	}
+	for _, result := range results {
+		resultTypes = append(resultTypes, vars[result.(*ast.Ident).Name])
+	}
+
+	if r, err = heapifyStmts(vars, stmts); err != nil {
+		return
+	}
+	if pre, err = heapify(vars, preCond); err != nil {
+		return
+	}
+	if post, err = heapify(vars, postCond); err != nil {
+		return
+	}
+	names = heapVarNames(vars)
+	if len(names) == 0 {
+		return
+	}
+	alloc := ast.NewIdent(allocName)
+	pre = astAnd(pre, allocated(params, paramTypes, alloc))
+	post = astAnd(post, allocated(results, resultTypes, alloc))
+
+	var mods []ast.Expr
+	if modifies != nil {
+		mods = modifies.(*ast.CallExpr).Args
+	}
+	var items []modItem
+	if items, err = modItems(vars, mods); err != nil {
+		return
+	}
+	names = heapVarNames(vars)
+
+	// MODIFIES の場所は関数の入口での値で評価する。old.go 参照。
+	for i, item := range items {
+		items[i].ptr = elimOld(vars, &ast.CallExpr{Fun: ast.NewIdent("old"), Args: []ast.Expr{item.ptr}})
+	}
+	olds := map[string]ast.Expr{}
+	for _, name := range names {
+		olds[name] = oldIdent(name)
+	}
+	post = astAnd(post, heapFrame(vars, items, olds, heapIdents(names)))
+	return
+}
+
+// parseModifies は MODIFIES の文字列をパースして場所の式のリストを取得する関数
+func parseModifies(s string) (r []ast.Expr, err error) {
+	if s == "" {
+		return
+	}
+	var expr ast.Expr
+	expr, err = parser.ParseExpr("MODIFIES(" + s + ")")
+	if err != nil {
+		return
+	}
+	r = expr.(*ast.CallExpr).Args
+	return
+}
+
+// modItems は MODIFIES の場所の式のリストを、変数名の表 vars のもとで変更してよいヒープの場所に直す関数。
+// ポインタの式はヒープの変換済みのものとする。
+func modItems(vars map[string]ast.Expr, mods []ast.Expr) (r []modItem, err error) {
+	for _, mod := range mods {
+		var item modItem
+		var x ast.Expr
+		switch mod.(type) {
+		case *ast.SelectorExpr:
+			se := mod.(*ast.SelectorExpr)
+			item.field = se.Sel.Name
+			x = se.X
+		case *ast.StarExpr:
+			x = mod.(*ast.StarExpr).X
+		default:
+			x = mod
+		}
+		if item.ptr, err = heapify(vars, x); err != nil {
+			return
+		}
+		item.typ = pointee(typeOf(vars, item.ptr))
+		if item.typ == nil {
+			err = fmt.Errorf("MODIFIES: %s is not a pointer", typeString(x))
+			return
+		}
+		if _, err = heapRef(vars, item.typ); err != nil {
+			return
+		}
+		if item.field != "" {
+			_, st := structOf(item.typ)
+			if st == nil || fieldType(st, item.field) == nil {
+				err = fmt.Errorf("MODIFIES: unknown field %s of %s", item.field, typeString(item.typ))
+				return
+			}
+		}
+		r = append(r, item)
+	}
+	return
+}
+
+// heapFrame はヒープの変数を olds から news に変えたときに、変更してよい場所 items 以外の
+// 確保済みの場所が変わらないことを表す条件式を作成する関数。
+// 確保済みの位置は減らない。olds と news は変数名 vars のヒープの変数ごとの式。
+func heapFrame(vars map[string]ast.Expr, items []modItem, olds, news map[string]ast.Expr) (r ast.Expr) {
+	oldAlloc, newAlloc := olds[allocName], news[allocName]
+	l := FreshIdents(1)[0]
+	at := func(h ast.Expr, i ast.Expr) ast.Expr { return &ast.IndexExpr{X: h, Index: i} }
+	eq := astIdentical
+	neq := func(x, y ast.Expr) ast.Expr { return &ast.BinaryExpr{X: x, Op: token.NEQ, Y: y} }
+
+	// ForAll l. alloc[l] => alloc'[l]
+	conds := []ast.Expr{astForAll(l, ast.NewIdent("int"), astImplies(at(oldAlloc, l), at(newAlloc, l)))}
+
+	for _, name := range heapVarNames(vars) {
+		if name == allocName {
+			continue
+		}
+		var mine []modItem
+		for _, item := range items {
+			if heapPrefix+typeString(item.typ) == name {
+				mine = append(mine, item)
+			}
+		}
+
+		// 変更してよい場所を指さない確保済みの位置の値は変わらない
+		hyps := []ast.Expr{at(oldAlloc, l)}
+		for _, item := range mine {
+			hyps = append(hyps, neq(l, item.ptr))
+		}
+		conds = append(conds, astForAll(l, ast.NewIdent("int"),
+			astImplies(astAnds(hyps...), eq(at(news[name], l), at(olds[name], l)))))
+
+		// フィールドだけを変更してよい場所は、ほかのフィールドの値が変わらない
+		elt := vars[name].(*ast.ArrayType).Elt
+		_, st := structOf(elt)
+		if st == nil {
+			continue
+		}
+		fields, _ := structFields(st)
+		var done []ast.Expr
+		for _, item := range mine {
+			if item.field == "" || containsExpr(done, item.ptr) {
+				continue
+			}
+			done = append(done, item.ptr)
+			p := item.ptr
+			for _, field := range fields {
+				hyps := []ast.Expr{at(oldAlloc, p)}
+				changed := false
+				for _, other := range mine {
+					if other.field != "" && other.field != field {
+						continue
+					}
+					if Equals(other.ptr, p) {
+						changed = true
+						break
+					}
+					hyps = append(hyps, neq(p, other.ptr))
+				}
+				if changed {
+					continue
+				}
+				f := ast.NewIdent(field)
+				conds = append(conds, astImplies(astAnds(hyps...),
+					eq(&ast.SelectorExpr{X: at(news[name], p), Sel: f}, &ast.SelectorExpr{X: at(olds[name], p), Sel: f})))
+			}
+		}
+	}
+	r = astAnds(conds...)
+	return
+}
+
+// containsExpr は式のリストに式 x と同じものがあるか調べる関数
+func containsExpr(list []ast.Expr, x ast.Expr) bool {
+	for _, y := range list {
+		if Equals(x, y) {
+			return true
+		}
+	}
+	return false
+}
+
+// heapIdents はヒープの変数名のリストから、それぞれの名前そのものの Ident の表を作成する関数
+func heapIdents(names []string) (r map[string]ast.Expr) {
+	r = map[string]ast.Expr{}
+	for _, name := range names {
+		r[name] = ast.NewIdent(name)
+	}
+	return
+}
+
+// substHeap は式の中のヒープの変数を表 hs の式で置換する関数
+func substHeap(expr ast.Expr, hs map[string]ast.Expr) (r ast.Expr, err error) {
+	var vs, es []ast.Expr
+	for name, e := range hs {
+		vs = append(vs, ast.NewIdent(name))
+		es = append(es, e)
+	}
+	r, err = subst(expr, vs, es)
+	return
+}
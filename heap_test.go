@@ -0,0 +1,63 @@
+package main
+
+import (
+	"testing"
+)
+
+// ポインタの指す先は型ごとのヒープの配列、確保済みの位置は alloc$ で表し、
+// 呼び出し先の MODIFIES にない場所は呼び出しの前後で変わらない
+func TestHeapSMT(t *testing.T) {
+	src := `package main
+
+type Counter struct{ n, m int }
+
+func incr(c *Counter) {
+	PRE("c != nil")
+	MODIFIES("c.n")
+	c.n = c.n + 1
+	POST("c.n == old(c.n) + 1")
+}
+
+func use(c *Counter, d *Counter) {
+	PRE("c != nil && d != nil")
+	MODIFIES("c.n, d")
+	incr(c)
+	p := &Counter{n: 1}
+	d.m = 2
+	POST("d.m == 2 && p.n == 1")
+}
+`
+	expectSMT(t, src, []string{"incr"},
+		"(declare-const heap$Counter (Array Int Counter))",
+		"(declare-const alloc$ (Array Int Bool))",
+		"(store heap$Counter c (mk-Counter (+ (Counter.n (select heap$Counter c)) 1) (Counter.m (select heap$Counter c))))",
+		// MODIFIES にないフィールド c.m と、c 以外の確保済みの場所は変わらない
+		"(=> (select alloc$$old c$old) (= (Counter.m (select ",
+		"(not (= u$",
+	)
+	expectSMT(t, src, []string{"incr", "use"},
+		// 呼び出し先の MODIFIES の場所の外は変わらない
+		"(=> (select alloc$ c) (= (Counter.m (select ",
+		// 確保する位置は確保済みでなく、指す先を初期値にする
+		"(not (select ",
+		"(mk-Counter 1 0)",
+	)
+}
+
+// MODIFIES にない場所を変更する関数の検証条件には、その場所が変わらないことが含まれる
+func TestHeapModifies(t *testing.T) {
+	src := `package main
+
+type Counter struct{ n, m int }
+
+func bad(c *Counter) {
+	PRE("c != nil")
+	MODIFIES("c.n")
+	c.m = 1
+	POST("true")
+}
+`
+	expectSMT(t, src, []string{"bad"},
+		"(=> (select alloc$$old c$old) (= (Counter.m (select ",
+	)
+}
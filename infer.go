@@ -0,0 +1,362 @@
+// infer.go
+// ループ不変条件の推論
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io/ioutil"
+	"sort"
+	"strings"
+)
+
+// INV のないループには、Houdini の方法でループ不変条件を推論する。
+//
+// ループごとに不変条件の候補を作り、候補の連言を INV として受動形に変換する (vcgen.go 参照)。
+// ループに入る時点とループ本体を一回実行したあとの INV の条件を候補ごとに分けて SMT ソルバで調べ、
+// 成り立たない候補を除く。除く候補がなくなるまで繰り返し、残った候補の連言をループ不変条件とする。
+// 候補は次のものとする。
+//
+//	ループに現れる整数の変数 x, y と、0 およびループに現れる整数の定数 c について x >= c, x <= c, x <= y, x >= y
+//	関数の PRE と POST の連言の各項
+//
+// 設定の write_inv が true のときは、推論したループ不変条件をソースファイルのループ本体の先頭に INV 文として書き込む。
+
+// invLoop は不変条件を推論するループ
+type invLoop struct {
+	loop  *ast.ForStmt  // ループ
+	cands []ast.Expr    // 不変条件の候補
+	inv   *ast.CallExpr // ループ本体の先頭に加えた INV(...)
+}
+
+// inferred は検証中の関数で推論したループ不変条件の文字列のリスト
+var inferred []string
+
+// invEdit はソースファイルへの INV 文の書き込み
+type invEdit struct {
+	offset int    // 書き込む位置 (ループ本体の { の直後)
+	text   string // 書き込む文字列
+}
+
+// invEdits は書き込み待ちの INV 文のリスト
+var invEdits []invEdit
+
+// inferInvariants は関数本体の文 stmts の中の INV のないループに、推論した INV 文を加える関数。
+// vars は関数の変数名とその型、pre と post は関数の事前・事後条件、results は名前付き結果パラメータ。
+// orig は書き込み位置を調べるための元の関数本体。
+func inferInvariants(vars map[string]ast.Expr, pre, post ast.Expr, stmts []ast.Stmt, results []ast.Expr, orig *ast.BlockStmt) (err error) {
+	inferred = nil
+	if conf.BMC > 0 {
+		// 有界モデル検査ではループを展開するので INV はいらない。bmc.go 参照。
+		return
+	}
+
+	// INV のないループを集めて、候補の連言を INV とする
+	var loops []*invLoop
+	byLoop := map[*ast.ForStmt]*invLoop{}
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			s, ok := n.(*ast.ForStmt)
+			if !ok {
+				return true
+			}
+			if asserts, _, e := separateStmts(s.Body.List); e != nil || asserts["INV"] != nil {
+				return true
+			}
+			il := &invLoop{
+				loop:  s,
+				cands: invCandidates(vars, pre, post, s),
+				inv:   &ast.CallExpr{Fun: ast.NewIdent("INV")},
+			}
+			s.Body.List = append([]ast.Stmt{&ast.ExprStmt{X: il.inv}}, s.Body.List...)
+			loops = append(loops, il)
+			byLoop[s] = il
+			return true
+		})
+	}
+	if len(loops) == 0 {
+		return
+	}
+
+	for {
+		for _, il := range loops {
+			il.inv.Args = []ast.Expr{invConj(il.cands)}
+		}
+
+		// 事後条件は調べないので true とする
+		var pv *passive
+		pv, err = passiveGoals(vars, stmts, ast.NewIdent("true"), results)
+		if err != nil {
+			return
+		}
+
+		// 成り立たない候補を調べる
+		removed := map[*invLoop]map[int]bool{}
+		for _, g := range pv.goals {
+			il := byLoop[g.loop]
+			if il == nil || len(il.cands) == 0 || isFalseIdent(g.reach) {
+				continue
+			}
+			if removed[il] == nil {
+				removed[il] = map[int]bool{}
+			}
+			for j, c := range splitAnds(g.cond, len(il.cands)) {
+				if !removed[il][j] && !pv.valid(pre, g, c) {
+					removed[il][j] = true
+				}
+			}
+		}
+
+		changed := false
+		for _, il := range loops {
+			var cands []ast.Expr
+			for j, c := range il.cands {
+				if !removed[il][j] {
+					cands = append(cands, c)
+				}
+			}
+			changed = changed || len(cands) != len(il.cands)
+			il.cands = cands
+		}
+		if !changed {
+			break
+		}
+	}
+
+	// 元のループの位置を調べ、推論した INV 文を記録する
+	lbraces := map[token.Pos]token.Pos{}
+	ast.Inspect(orig, func(n ast.Node) bool {
+		if s, ok := n.(*ast.ForStmt); ok {
+			lbraces[s.For] = s.Body.Lbrace
+		}
+		return true
+	})
+	for _, il := range loops {
+		inv := nodeString(oldToCall(il.inv.Args[0]))
+		inferred = append(inferred, inv)
+		if conf.WriteInv && lbraces[il.loop.For].IsValid() {
+			addInvEdit(il.loop.For, lbraces[il.loop.For], inv)
+		}
+	}
+	return
+}
+
+// invCandidates はループ s の不変条件の候補のリストを作成する関数
+func invCandidates(vars map[string]ast.Expr, pre, post ast.Expr, s *ast.ForStmt) (r []ast.Expr) {
+	// ループに現れる整数の変数と整数の定数
+	var names []string
+	consts := []string{"0"}
+	seen := map[string]bool{"0": true}
+	var visit func(n ast.Node) bool
+	visit = func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.SelectorExpr:
+			// フィールド名は変数ではない
+			ast.Inspect(n.(*ast.SelectorExpr).X, visit)
+			return false
+		case *ast.Ident:
+			name := n.(*ast.Ident).Name
+			if !seen[name] && isIntType(vars[name]) && !strings.Contains(name, "$") {
+				seen[name] = true
+				names = append(names, name)
+			}
+		case *ast.BasicLit:
+			lit := n.(*ast.BasicLit)
+			if lit.Kind == token.INT && !seen[lit.Value] {
+				seen[lit.Value] = true
+				consts = append(consts, lit.Value)
+			}
+		}
+		return true
+	}
+	ast.Inspect(s, visit)
+	sort.Strings(names)
+
+	cmp := func(x ast.Expr, op token.Token, y ast.Expr) ast.Expr {
+		return &ast.BinaryExpr{X: x, Op: op, Y: y}
+	}
+	for i, x := range names {
+		for _, c := range consts {
+			lit := &ast.BasicLit{Kind: token.INT, Value: c}
+			r = append(r, cmp(ast.NewIdent(x), token.GEQ, lit), cmp(ast.NewIdent(x), token.LEQ, lit))
+		}
+		for _, y := range names[i+1:] {
+			r = append(r, cmp(ast.NewIdent(x), token.LEQ, ast.NewIdent(y)), cmp(ast.NewIdent(x), token.GEQ, ast.NewIdent(y)))
+		}
+	}
+
+	// PRE と POST の各項。ヒープの変数を含むものは除く。
+	for _, cond := range []ast.Expr{pre, post} {
+		for _, c := range conjuncts(cond) {
+			if !containsHeapVar(c) && !isTrueIdent(c) {
+				r = append(r, c)
+			}
+		}
+	}
+
+	// 同じ候補を除く
+	var uniq []ast.Expr
+	strs := map[string]bool{}
+	for _, c := range r {
+		s := nodeString(c)
+		if !strs[s] {
+			strs[s] = true
+			uniq = append(uniq, c)
+		}
+	}
+	r = uniq
+	return
+}
+
+// isIntType は型が整数型 (int もしくは int から宣言された型) かどうか調べる関数
+func isIntType(typ ast.Expr) bool {
+	ident, ok := underlying(typ).(*ast.Ident)
+	return ok && ident.Name == "int"
+}
+
+// conjuncts は条件式を && で分けた項のリストを取得する関数
+func conjuncts(expr ast.Expr) (r []ast.Expr) {
+	switch expr.(type) {
+	case *ast.ParenExpr:
+		r = conjuncts(expr.(*ast.ParenExpr).X)
+	case *ast.BinaryExpr:
+		be := expr.(*ast.BinaryExpr)
+		if be.Op != token.LAND {
+			r = []ast.Expr{expr}
+			break
+		}
+		r = append(conjuncts(be.X), conjuncts(be.Y)...)
+	default:
+		r = []ast.Expr{expr}
+	}
+	return
+}
+
+// containsHeapVar は式がヒープの変数を含むかどうか調べる関数
+func containsHeapVar(expr ast.Expr) (ok bool) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if ident, isIdent := n.(*ast.Ident); isIdent && (isHeapVar(ident.Name) || ident.Name == allocName) {
+			ok = true
+		}
+		return !ok
+	})
+	return
+}
+
+// invConj は候補のリストの連言を作成する関数。候補がないときは true とする。
+// 候補 c1, ..., cn の連言は ((c1 && c2) && ...) && cn とし、splitAnds で項に分けられるようにする。
+func invConj(cands []ast.Expr) (r ast.Expr) {
+	if len(cands) == 0 {
+		r = ast.NewIdent("true")
+		return
+	}
+	r = astAnds(cands...)
+	return
+}
+
+// splitAnds は invConj で作成した n 個の項の連言 (の変数を置換したもの) を項に分ける関数
+func splitAnds(expr ast.Expr, n int) (r []ast.Expr) {
+	r = make([]ast.Expr, n)
+	for i := n - 1; i > 0; i-- {
+		be, ok := expr.(*ast.BinaryExpr)
+		if !ok || be.Op != token.LAND {
+			// 想定しない形のときは全体を各項とする
+			for j := range r {
+				r[j] = expr
+			}
+			return
+		}
+		r[i] = be.Y
+		expr = be.X
+	}
+	r[0] = expr
+	return
+}
+
+// valid は証明すべき条件 g の地点で条件 cond が成り立つことを SMT ソルバで調べる関数。
+// g より前の仮定だけを使う。ループに入る時点の条件は、ループの先頭で仮定する候補を使わずに調べる。
+func (pv *passive) valid(pre ast.Expr, g pGoal, cond ast.Expr) bool {
+	goal := cond
+	if !isTrueIdent(g.reach) {
+		goal = astImplies(g.reach, cond)
+	}
+	script, err := makeSMTScript(pv.vars, astNot(pv.vcAt(pre, g.nhyps, goal)))
+	if err != nil {
+		return false
+	}
+	result, _, _, err := runSMTScript(script)
+	return err == nil && result == "unsat"
+}
+
+// oldToCall は入口での値を表す変数 x$old を old(x) に直した式を作成する関数
+func oldToCall(expr ast.Expr) (r ast.Expr) {
+	r = mapExpr(expr, func(e ast.Expr) (x ast.Expr, ok bool) {
+		ident, isIdent := e.(*ast.Ident)
+		if !isIdent || !strings.HasSuffix(ident.Name, oldSuffix) {
+			return
+		}
+		name := strings.TrimSuffix(ident.Name, oldSuffix)
+		x, ok = &ast.CallExpr{Fun: ast.NewIdent("old"), Args: []ast.Expr{ast.NewIdent(name)}}, true
+		return
+	})
+	return
+}
+
+// addInvEdit は for 文 (位置 forPos) の本体の { (位置 lbrace) の直後に INV 文を書き込む予定を記録する関数
+func addInvEdit(forPos, lbrace token.Pos, inv string) {
+	src, err := ioutil.ReadFile(srcFile)
+	if err != nil {
+		return
+	}
+	offset := fset.Position(lbrace).Offset + 1
+	start := fset.Position(forPos).Offset
+	lineStart := strings.LastIndex(string(src[:start]), "\n") + 1
+	line := string(src[lineStart:start])
+	indent := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+	newline := "\n"
+	if strings.Contains(string(src), "\r\n") {
+		newline = "\r\n"
+	}
+	lit, ok := specLiteral(inv)
+	if !ok {
+		return
+	}
+	text := fmt.Sprintf("%s%s\tINV(%s)", newline, indent, lit)
+	invEdits = append(invEdits, invEdit{offset: offset, text: text})
+}
+
+// specLiteral は表明の式の文字列 s を、そのまま読み戻せる文字列リテラルにする関数。
+// 表明の文字列リテラルはエスケープを解釈せずに読むので (typecheck.go の parseSpec 参照)、
+// s に ` がなければ ` で、" がなければ " で囲む。どちらも含むときは ok を false とする。
+func specLiteral(s string) (r string, ok bool) {
+	switch {
+	case !strings.Contains(s, "`"):
+		r, ok = "`"+s+"`", true
+	case !strings.Contains(s, `"`):
+		r, ok = `"`+s+`"`, true
+	}
+	return
+}
+
+// writeInvEdits は記録した INV 文をソースファイルに書き込む関数
+func writeInvEdits() (err error) {
+	if len(invEdits) == 0 {
+		return
+	}
+	var src []byte
+	src, err = ioutil.ReadFile(srcFile)
+	if err != nil {
+		return
+	}
+	// 後ろから書き込むと前の位置はずれない
+	sort.Slice(invEdits, func(i, j int) bool { return invEdits[i].offset > invEdits[j].offset })
+	s := string(src)
+	for _, e := range invEdits {
+		s = s[:e.offset] + e.text + s[e.offset:]
+	}
+	invEdits = nil
+	err = ioutil.WriteFile(srcFile, []byte(s), 0644)
+	return
+}
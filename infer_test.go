@@ -0,0 +1,121 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// INV のないループの不変条件の推論
+
+const inferSrc = `package main
+
+func f(n int) (r int) {
+	PRE("n >= 0")
+	i := 0
+	r = 0
+	for i < n {
+		i = i + 1
+		r = r + 1
+	}
+	POST("r == n")
+	return
+}
+
+func g(n int) (r int) {
+	PRE("n >= 0")
+	i := 0
+	r = 0
+	for i < n {
+		i = i + 1
+		r = r + 1
+	}
+	POST("r == n + 1")
+	return
+}
+`
+
+func TestInferInvariants(t *testing.T) {
+	expectVerdict(t, inferSrc, true, "f")
+	expectVerdict(t, inferSrc, false, "g")
+}
+
+// ループに入る時点で成り立たない候補は、ループの先頭で仮定する候補の連言が矛盾していても除く
+func TestInferPrunesFalseCandidates(t *testing.T) {
+	if err := verifyFuncs(t, "passive", inferSrc, "f"); err != nil {
+		t.Fatal(err)
+	}
+	if len(inferred) != 1 {
+		t.Fatalf("inferred: %v", inferred)
+	}
+	inv := inferred[0]
+	for _, bad := range []string{"i >= 1", "r >= 1", "i <= n && i >= n"} {
+		if strings.Contains(inv, bad) {
+			t.Errorf("false candidate %q is not pruned: %s", bad, inv)
+		}
+	}
+	for _, want := range []string{"i <= n", "r == i", "r <= i", "r >= i"} {
+		if strings.Contains(inv, want) {
+			return
+		}
+	}
+	t.Errorf("inferred INV does not relate r and i: %s", inv)
+}
+
+// write_inv のときは推論した INV をループ本体の先頭に書き込み、書き込んだソースはそのまま検証できる
+func TestInferWriteBack(t *testing.T) {
+	src := inferSrc + specStubs
+	fileNode := setupSrc(t, src)
+	conf.WriteInv = true
+	if err := processFunc(fileNode, "f"); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeInvEdits(); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(srcFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	written := string(b)
+	if want := "\tfor i < n {\n\t\tINV("; strings.Count(written, want) != 1 {
+		t.Fatalf("INV is not written at the top of the first loop:\n%s", written)
+	}
+	if got := strings.Count(written, "INV(`"); got != 1 {
+		t.Errorf("got %d INVs, want 1:\n%s", got, written)
+	}
+	expectVerdict(t, strings.TrimSuffix(written, specStubs), true, "f")
+}
+
+// 書き込む INV の文字列リテラルは、" や \ を含む式でもそのまま読み戻せる
+func TestSpecLiteral(t *testing.T) {
+	fset = token.NewFileSet()
+	for _, inv := range []string{
+		"i <= n",
+		`s == "a\\b" && i >= 0`,
+		"s == `a` && i >= 0",
+	} {
+		lit, ok := specLiteral(inv)
+		if !ok {
+			t.Errorf("%s: no literal", inv)
+			continue
+		}
+		x, err := parser.ParseExpr(lit)
+		if err != nil {
+			t.Fatalf("%s: %v", lit, err)
+		}
+		expr, err := parseSpec(x.(*ast.BasicLit), "INV")
+		if err != nil {
+			t.Fatalf("%s: %v", lit, err)
+		}
+		if got := nodeString(expr); got != inv {
+			t.Errorf("%s: got %s, want %s", lit, got, inv)
+		}
+	}
+	if lit, ok := specLiteral("s == `a` && t == \"b\""); ok {
+		t.Errorf("got %s for an expression with both quotes", lit)
+	}
+}
@@ -0,0 +1,89 @@
+// lit.go
+// リテラルの変換
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// Golang のリテラルは strconv などで値を求めてから SMT LIB Language のリテラルにする。
+//
+//	0x1F、0b101、0o17、017、1_000 -> 31、5、15、15、1000
+//	'a'、'\n'、'\u00e9'            -> 97、10、233 (符号位置の整数)
+//	"a\"b\n"、`a\b`               -> "a""b\u{a}"、"a\u{5c}b"
+//	1.5、1e3                       -> float.go 参照
+//
+// 負の数はリテラルではなく単項演算子 - の式とする。
+
+// convBasicLit はリテラル bl を SMT LIB Language のリテラルに変換する関数
+func convBasicLit(bl *ast.BasicLit) (r string) {
+	switch {
+	case floatLits[bl] != "":
+		// 浮動小数点数の型をもつ 0 など
+		r = convFloatLit(bl, floatLits[bl])
+	case bl.Kind == token.FLOAT:
+		r = convFloatLit(bl, "float64")
+	case bl.Kind == token.INT:
+		r = convIntLit(bl.Value)
+	case bl.Kind == token.CHAR:
+		r = convCharLit(bl.Value)
+	case bl.Kind == token.STRING:
+		r = convStringLit(bl.Value)
+	default:
+		printNode(bl)
+		panic("unknown literal " + bl.Value)
+	}
+	return
+}
+
+// convIntLit は Golang の整数リテラルを 10 進数の整数に変換する関数。
+// 0x、0b、0o、0 の接頭辞と桁区切りの _ を受け付ける。
+func convIntLit(lit string) (r string) {
+	r = lit
+	if n, ok := new(big.Int).SetString(lit, 0); ok {
+		r = n.String()
+	}
+	return
+}
+
+// convStringLit は Golang の文字列リテラルを SMT の文字列リテラルに変換する関数。
+// " は "" とし、ASCII の印字可能文字以外と \ は \u{XXXX} とする。
+// SMT の文字列の \u{...} はエスケープなので、\ もそのままにはしない。
+// 例："a\"b\n" -> "a""b\u{a}"
+func convStringLit(lit string) (r string) {
+	s, err := strconv.Unquote(lit)
+	if err != nil {
+		r = lit
+		return
+	}
+	var sb strings.Builder
+	sb.WriteByte('"')
+	for _, c := range s {
+		switch {
+		case c == '"':
+			sb.WriteString(`""`)
+		case 0x20 <= c && c < 0x7f && c != '\\':
+			sb.WriteRune(c)
+		default:
+			fmt.Fprintf(&sb, `\u{%x}`, c)
+		}
+	}
+	sb.WriteByte('"')
+	r = sb.String()
+	return
+}
+
+// convCharLit は Golang の文字リテラル 'a' をその符号位置の整数に変換する関数
+func convCharLit(lit string) (r string) {
+	r = lit
+	if c, _, _, err := strconv.UnquoteChar(lit[1:len(lit)-1], '\''); err == nil {
+		r = strconv.Itoa(int(c))
+	}
+	return
+}
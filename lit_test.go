@@ -0,0 +1,65 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"testing"
+)
+
+// Golang のリテラルは値を求めて SMT LIB Language のリテラルになる
+func TestConvBasicLit(t *testing.T) {
+	tests := []struct {
+		lit  string
+		want string
+	}{
+		{"0x1F", "31"},
+		{"0b101", "5"},
+		{"0o17", "15"},
+		{"017", "15"},
+		{"1_000", "1000"},
+		{"'a'", "97"},
+		{`'\n'`, "10"},
+		{`'é'`, "233"},
+		{`"a\"b\n"`, `"a""b\u{a}"`},
+		{"`a\\b`", `"a\u{5c}b"`},
+	}
+	for _, tt := range tests {
+		expr, err := parser.ParseExpr(tt.lit)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := convBasicLit(expr.(*ast.BasicLit)); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.lit, got, tt.want)
+		}
+	}
+}
+
+// 表明とコードのリテラルは同じ値になる
+func TestLiterals(t *testing.T) {
+	runVerdictTests(t, []verdictTest{
+		{name: "int", src: `
+func f(x int) (r int) {
+	PRE("true")
+	r = x + 0x1F - 0b11110 + 1_000 - 0o1750
+	POST("r == x + 1")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "rune", src: `
+func f(x int) (r int) {
+	PRE("true")
+	r = x + int('b'-'a')
+	POST("r == x + 0x1 && 'a' == 97")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "ng", src: `
+func f(x int) (r int) {
+	PRE("true")
+	r = x + 0x10
+	POST("r == x + 10")
+	return
+}
+`, funcs: []string{"f"}, ok: false},
+	})
+}
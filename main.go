@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"flag"
 	"fmt"
 	"go/ast"
 	"go/format"
@@ -14,7 +15,7 @@ import (
 
 const (
 	// USAGE はコマンドラインでの使い方
-	USAGE = "%s src.go func_name\n"
+	USAGE = "%s [--bmc=k] src.go func_name\n"
 )
 
 func main() {
@@ -26,8 +27,14 @@ var fset *token.FileSet
 var srcFile string
 
 func run() int {
-	if len(os.Args) < 2 {
+	bmc := flag.Int("bmc", 0, "ループを k 回まで展開して有界モデル検査をする")
+	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, USAGE, os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() < 1 {
+		flag.Usage()
 		return 1
 	}
 
@@ -37,25 +44,58 @@ func run() int {
 		fmt.Fprintln(os.Stderr, err)
 		return 2
 	}
+	if *bmc > 0 {
+		conf.BMC = *bmc
+	}
+	floatMode = conf.Float
 
-	srcFile = os.Args[1]
-	funcNames := os.Args[2:]
+	srcFile = flag.Arg(0)
+	funcNames := flag.Args()[1:]
 
 	// Golang の構文としてパース
 	fset = token.NewFileSet()
-	fileNode, err := parser.ParseFile(fset, srcFile, nil, 0)
+	fileNode, err := parser.ParseFile(fset, srcFile, nil, parser.ParseComments)
 	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
 		return 2
 	}
 
+	// ファイルで宣言されている型を登録
+	loadTypeDecls(fileNode)
+
+	// //hl:pure の純粋関数と PREDICATE、LEMMA を登録。pure.go、predicate.go 参照。
+	if err = loadPureFuncs(fileNode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	// 表明の型検査のためにファイルを型検査
+	if err = loadTypes(fileNode); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	// パッケージレベルの定数と変数を登録。const.go 参照。
+	loadPkgDecls()
+	if err = checkSpecDefs(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+
+	// LEMMA を証明する
+	if err = proveLemmas(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 3
+	}
+
 	var d Data
 	for _, funcName := range funcNames {
 
 		// すでに検証結果が保存されているならそれを表示する。
+		// 有界モデル検査のときは保存されている結果を使わずに検査する。
 		//d, err = LoadData(funcName + ".json")
 		d, err = getFuncData(funcName)
-		if err == nil {
+		if err == nil && conf.BMC == 0 {
 			fmt.Println("(cached)")
 			fmt.Println(d)
 			continue
@@ -69,6 +109,14 @@ func run() int {
 		}
 	}
 
+	// 推論したループ不変条件をソースファイルに書き込む
+	if conf.WriteInv {
+		if err = writeInvEdits(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+	}
+
 	return 0
 }
 
@@ -84,8 +132,25 @@ func processFunc(fileNode *ast.File, funcName string) (err error) {
 		return
 	}
 
+	// 表明を型検査する。型の誤りは SMT ソルバを呼ぶ前にエラーとする。
+	if err = checkSpecs(funcDecl); err != nil {
+		return
+	}
+
+	// 浮動小数点数のモード (ieee または real) を選ぶ。float.go 参照。
+	if floatMode, err = funcFloatMode(funcDecl); err != nil {
+		return
+	}
+
+	// 関数の仕様 (入出力パラメータと表明) を取得し、再帰呼び出しのために funcTab に仮に登録する
+	data, err := getFuncSpec(funcDecl, funcName)
+	if err != nil {
+		return
+	}
+	setFuncData(funcName, data)
+
 	// 検証すべき条件式を取得する。
-	conds, vars, pre, post, err := getCondTobeVerified(funcDecl)
+	conds, vars, err := getCondTobeVerified(funcDecl)
 	if err != nil {
 		return
 	}
@@ -95,19 +160,10 @@ func processFunc(fileNode *ast.File, funcName string) (err error) {
 		format.Node(os.Stdout, token.NewFileSet(), conds)
 	}
 
-	// 関数の入出力パラメータを取得
-	inputs, outputs := getIOParams(funcDecl.Type)
-
-	preBuffer := new(bytes.Buffer)
-	format.Node(preBuffer, token.NewFileSet(), pre)
-
-	postBuffer := new(bytes.Buffer)
-	format.Node(postBuffer, token.NewFileSet(), post)
-
 	// 検証すべき条件式の文字列を格納するリスト
 	var condStrs []string
 
-	for _, cond := range conds {
+	for i, cond := range conds {
 		if conf.Debug {
 			printNode(cond)
 			fmt.Print("#processFunc: cond: ")
@@ -115,41 +171,33 @@ func processFunc(fileNode *ast.File, funcName string) (err error) {
 			fmt.Println("")
 		}
 		// 検証すべき条件式を SMT Solver で検証する。
-
-		// AST の cond を Golang 構文の文字列に変換
-		condBuffer := new(bytes.Buffer)
-		if conf.Debug {
-			if cond == nil {
-				fmt.Println("cond is nil!")
-			} else {
-				fmt.Println("cond is not nil!")
-			}
-		}
-		format.Node(condBuffer, token.NewFileSet(), cond)
-		condStrs = append(condStrs, condBuffer.String())
-
-		// SMT Script を作成。
-		script := makeSMTScript(vars, cond)
-		if conf.Debug {
-			// cond の AST と作成した SMT Script の表示
-			fmt.Println("# AST")
-			printNode(cond)
-			fmt.Println("# SMT Script:")
-			fmt.Println(script)
-		}
-
-		// SMT Script を実行。
-		var result, outText, errText string
-		result, outText, errText, err = runSMTScript(script)
+		condStr := nodeString(cond)
+		condStrs = append(condStrs, condStr)
+		var result, outText string
+		result, outText, err = checkCond(vars, cond)
 		if err != nil {
-			err = fmt.Errorf("%s; %s", err.Error(), errText)
 			return
 		}
 
+		// 到達可能性の条件は充足 (sat) の場合が OK。symexec.go 参照。
+		info := condInfoAt(i)
+		if info.reach {
+			switch result {
+			case "sat":
+				result = "unsat"
+			case "unsat":
+				err = fmt.Errorf("unreachable: %s", info.trace)
+				return
+			}
+		}
+
 		// 充足 (sat) の場合は NG なので反例を表示。
 		switch result {
 		case "sat":
-			fmt.Fprintln(os.Stderr, condBuffer.String(), "=> NG")
+			fmt.Fprintln(os.Stderr, condStr, "=> NG")
+			if info.trace != "" {
+				fmt.Fprintln(os.Stderr, info.trace)
+			}
 			err = fmt.Errorf("unsat; counter-example: %s", outText)
 			return
 		case "unsat":
@@ -163,14 +211,30 @@ func processFunc(fileNode *ast.File, funcName string) (err error) {
 	}
 
 	// 検証結果のデータを作成
-	data := Data{
-		Name:    funcName,
-		Inputs:  inputs,
-		Outputs: outputs,
-		Pre:     preBuffer.String(),
-		Post:    postBuffer.String(),
-		Conds:   condStrs,
-		Date:    time.Now().String(),
+	data.Asserts, data.Assumes = collectMidAsserts(funcDecl.Body)
+	data.Invariants = inferred
+	data.Warnings = warnings
+	data.Conds = condStrs
+	data.Correctness = term.correctness()
+	data.Date = time.Now().String()
+
+	if conf.BMC > 0 {
+		// 有界モデル検査では、展開の上限に達する実行があるかも調べる。bmc.go 参照。
+		var reached bool
+		reached, err = checkBound(funcDecl)
+		if err != nil {
+			return
+		}
+		data.Correctness = boundedCorrectness
+		data.Note = fmt.Sprintf("bounded model checking: loops unrolled %d times", conf.BMC)
+		if reached {
+			data.Note += "; the bound is reached"
+		}
+		fmt.Println(data)
+
+		// 証明ではないので funcTab にだけ保存し、JSON には保存しない
+		setFuncData(funcName, data)
+		return
 	}
 	fmt.Println(data)
 
@@ -183,6 +247,86 @@ func processFunc(fileNode *ast.File, funcName string) (err error) {
 	return
 }
 
+// checkCond は検証すべき条件式 cond の SMT Script を作成して SMT Solver で実行し、その結果を取得する関数。
+// 結果 result は "sat" (反例がある)、"unsat" (検証できた) など。outText は反例などの出力。
+func checkCond(vars map[string]ast.Expr, cond ast.Expr) (result, outText string, err error) {
+	if conf.Debug {
+		if cond == nil {
+			fmt.Println("cond is nil!")
+		} else {
+			fmt.Println("cond is not nil!")
+		}
+	}
+
+	// SMT Script を作成。
+	script, err := makeSMTScript(vars, cond)
+	if err != nil {
+		return
+	}
+	if conf.Debug {
+		// cond の AST と作成した SMT Script の表示
+		fmt.Println("# AST")
+		printNode(cond)
+		fmt.Println("# SMT Script:")
+		fmt.Println(script)
+	}
+
+	// SMT Script を実行。
+	var errText string
+	result, outText, errText, err = runSMTScript(script)
+	if err != nil {
+		err = fmt.Errorf("%s; %s", err.Error(), errText)
+	}
+	return
+}
+
+// getFuncSpec は関数定義から関数の仕様 (レシーバ、入出力パラメータ、PRE、POST、MODIFIES、DECREASES) の
+// 検証結果データを作成する関数
+func getFuncSpec(funcDecl *ast.FuncDecl, funcName string) (data Data, err error) {
+	var asserts map[string]ast.Expr
+	asserts, _, err = separateStmts(funcDecl.Body.List)
+	if err != nil {
+		return
+	}
+
+	// 関数のレシーバと入出力パラメータを取得
+	inputs, outputs := getIOParams(funcDecl.Type)
+	data = Data{
+		Name:    funcName,
+		Recv:    getRecvParam(funcDecl.Recv),
+		Inputs:  inputs,
+		Outputs: outputs,
+	}
+	data.Unchanged = unchangedParams(append(append([][2]string{}, data.Recv...), inputs...), funcDecl.Body)
+
+	if asserts["PRE"] != nil {
+		data.Pre = nodeString(asserts["PRE"])
+	}
+	if asserts["POST"] != nil {
+		data.Post = nodeString(asserts["POST"])
+	}
+	if asserts["DECREASES"] != nil {
+		data.Decreases = nodeString(asserts["DECREASES"])
+	}
+
+	// MODIFIES の場所の式をカンマ区切りの文字列にする
+	if modifies := asserts["MODIFIES"]; modifies != nil {
+		var mods []string
+		for _, mod := range modifies.(*ast.CallExpr).Args {
+			mods = append(mods, nodeString(mod))
+		}
+		data.Modifies = strings.Join(mods, ", ")
+	}
+	return
+}
+
+// nodeString は AST のノードを Golang 構文の文字列に変換する関数
+func nodeString(node ast.Node) string {
+	buf := new(bytes.Buffer)
+	format.Node(buf, token.NewFileSet(), node)
+	return buf.String()
+}
+
 func makeFuncFileName(funcName string) (r string) {
 	r = srcFile
 	if strings.HasSuffix(r, ".go") { // 01234.go
@@ -194,13 +338,14 @@ func makeFuncFileName(funcName string) (r string) {
 
 // pickupFuncDecl は指定された関数名 (funcName) の関数定義を
 // トップレベルの宣言の中から取得する関数。
+// メソッドは "型名.メソッド名" で指定する。例：Point.Dist
 // 関数内部で宣言される関数は対象外。
 func pickupFuncDecl(fileNode *ast.File, funcName string) (f *ast.FuncDecl) {
 	// ファイルノードのトップレベルの「宣言」の中から指定された名前の関数を取得する
 	for _, n := range fileNode.Decls {
-		// 関数宣言のうちその名前が "main" のものをみつける
+		// 関数宣言のうちその名前が funcName のものをみつける
 		funcDecl, ok := n.(*ast.FuncDecl)
-		if ok && funcDecl.Name.Name == funcName {
+		if ok && funcDeclName(funcDecl) == funcName {
 			f = funcDecl
 			break
 		}
@@ -208,6 +353,34 @@ func pickupFuncDecl(fileNode *ast.File, funcName string) (f *ast.FuncDecl) {
 	return
 }
 
+// funcDeclName は関数定義の名前を取得する関数。
+// メソッドのときは "型名.メソッド名" とし、型の異なる同名のメソッドを区別する。
+func funcDeclName(funcDecl *ast.FuncDecl) (r string) {
+	r = funcDecl.Name.Name
+	if funcDecl.Recv != nil && len(funcDecl.Recv.List) > 0 {
+		r = recvTypeName(funcDecl.Recv.List[0].Type) + "." + r
+	}
+	return
+}
+
+// recvTypeName はレシーバの型から型名を取得する関数。
+// ポインタ型 *T や型パラメータつきの型 T[K] のときは T とする。
+func recvTypeName(typ ast.Expr) (r string) {
+	switch typ.(type) {
+	case *ast.Ident:
+		r = typ.(*ast.Ident).Name
+	case *ast.StarExpr:
+		r = recvTypeName(typ.(*ast.StarExpr).X)
+	case *ast.IndexExpr:
+		r = recvTypeName(typ.(*ast.IndexExpr).X)
+	case *ast.IndexListExpr:
+		r = recvTypeName(typ.(*ast.IndexListExpr).X)
+	case *ast.ParenExpr:
+		r = recvTypeName(typ.(*ast.ParenExpr).X)
+	}
+	return
+}
+
 // printNode は与えられた AST ノードのツリー構造をダンプする関数。
 func printNode(node interface{}) {
 	ast.Print(fset, node)
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// レシーバのあるメソッドの検証と呼び出し。同じ名前のメソッドは型ごとに区別する。
+func TestMethods(t *testing.T) {
+	methods := `
+type Celsius int
+
+type Offset int
+
+func (c Celsius) Next() (r int) {
+	PRE("c >= 0")
+	r = int(c) + 1
+	POST("r == int(c) + 1")
+	return
+}
+
+func (o Offset) Next() (r int) {
+	PRE("true")
+	r = int(o) - 1
+	POST("r == int(o) - 1")
+	return
+}
+
+func use(c Celsius, o Offset) (r int) {
+	PRE("c >= 0")
+	r = c.Next()
+	s := o.Next()
+	r = r + s
+	POST("%s")
+	return
+}
+`
+	funcs := []string{"Celsius.Next", "Offset.Next", "use"}
+	runVerdictTests(t, []verdictTest{
+		{name: "call", src: fmt.Sprintf(methods, "r == int(c) + int(o)"), funcs: funcs, ok: true},
+		{name: "call NG", src: fmt.Sprintf(methods, "r == int(c) + int(o) + 2"), funcs: funcs, ok: false},
+		{name: "receiver PRE", src: fmt.Sprintf(methods, "r == int(c) + int(o)") + `
+func bad(c Celsius) (r int) {
+	PRE("true")
+	r = c.Next()
+	POST("true")
+	return
+}
+`, funcs: append(funcs, "bad"), ok: false},
+	})
+}
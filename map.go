@@ -0,0 +1,205 @@
+// map.go
+// マップ型の式。SMT の配列の組のデータ型への変換
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// マップ型 map[K]V は、値の配列 vals、キーの有無の配列 keys、要素数 len の組のデータ型とする。
+// データ型の名前は Golang の型の文字列を |...| で囲んだものとする。
+//
+//	(declare-datatypes ((|map[string]int| 0))
+//	  (((|mk-map[string]int| (|map[string]int.vals| (Array String Int))
+//	                         (|map[string]int.keys| (Array String Bool))
+//	                         (|map[string]int.len| Int)))))
+//
+// マップの式は次のように変換する。代入 m[k] = v は m = Store(m, k, v)、
+// delete(m, k) は m = Delete(m, k)、v, ok := m[k] は v, ok := m[k], HasKey(m, k) に直す。
+//
+//	m[k]            -> (ite (select keys k) (select vals k) V のゼロ値)
+//	HasKey(m, k)    -> (select keys k)
+//	Store(m, k, v)  -> (mk (store vals k v) (store keys k true) (ite (select keys k) len (+ len 1)))
+//	Delete(m, k)    -> (mk vals (store keys k false) (ite (select keys k) (- len 1) len))
+//	len(m)          -> len
+//	make(map[K]V)   -> (mk ((as const (Array K V)) V のゼロ値) ((as const (Array K Bool)) false) 0)
+//
+// nil のマップは空のマップと区別しない。パラメータのマップの len は 0 以上とするが、len とキーの有無の整合性は仮定しない。
+//
+// マップは参照なので、呼び出し先でのマップのパラメータへの代入や delete は呼び出し側の実引数のマップにも及ぶ。
+// 呼び出し先の関数本体で変更されうるマップのパラメータに渡した変数は、呼び出しのあとは値を定めない (changedMapArgs)。
+
+// mapTypeOf は型がマップ型のとき、その定義を返す関数
+func mapTypeOf(typ ast.Expr) (mt *ast.MapType) {
+	mt, _ = underlying(typ).(*ast.MapType)
+	return
+}
+
+// mapSort はマップ型 mt のデータ型の名前を返す関数。例：|map[string]int|
+func mapSort(mt *ast.MapType) string {
+	return "|" + typeString(mt) + "|"
+}
+
+// mapAccessor はマップ型 mt のデータ型の構築子 (field が "mk") またはアクセサの名前を返す関数
+func mapAccessor(mt *ast.MapType, field string) string {
+	if field == "mk" {
+		return "|mk-" + typeString(mt) + "|"
+	}
+	return fmt.Sprintf("|%s.%s|", typeString(mt), field)
+}
+
+// mapCtor はマップ型 mt の declare-datatypes の構築子の宣言を作成する関数
+func mapCtor(mt *ast.MapType) string {
+	k, v := convType(mt.Key), convType(mt.Value)
+	return fmt.Sprintf("(%s (%s (Array %s %s)) (%s (Array %s Bool)) (%s Int))",
+		mapAccessor(mt, "mk"), mapAccessor(mt, "vals"), k, v, mapAccessor(mt, "keys"), k, mapAccessor(mt, "len"))
+}
+
+// mapZero はマップ型 mt の空のマップを作成する関数
+func mapZero(mt *ast.MapType) string {
+	k, v := convType(mt.Key), convType(mt.Value)
+	return fmt.Sprintf("(%s ((as const (Array %s %s)) %s) ((as const (Array %s Bool)) false) 0)",
+		mapAccessor(mt, "mk"), k, v, zeroValue(mt.Value), k)
+}
+
+// convMapCall はマップ m についての組み込み関数 name の呼び出しを変換する関数。
+// args は m に続く引数。
+func convMapCall(mt *ast.MapType, name string, m ast.Expr, args ...ast.Expr) (r string) {
+	x := convExpr(m)
+	field := func(f string) string { return fmt.Sprintf("(%s %s)", mapAccessor(mt, f), x) }
+	var k string
+	if len(args) > 0 {
+		k = convExpr(args[0])
+	}
+	has := fmt.Sprintf("(select %s %s)", field("keys"), k)
+	switch name {
+	case "Select":
+		r = fmt.Sprintf("(ite %s (select %s %s) %s)", has, field("vals"), k, zeroValue(mt.Value))
+	case "HasKey":
+		r = has
+	case "Store":
+		r = fmt.Sprintf("(%s (store %s %s %s) (store %s %s true) (ite %s %s (+ %s 1)))",
+			mapAccessor(mt, "mk"), field("vals"), k, convExpr(args[1]), field("keys"), k, has, field("len"), field("len"))
+	case "Delete":
+		r = fmt.Sprintf("(%s %s (store %s %s false) (ite %s (- %s 1) %s))",
+			mapAccessor(mt, "mk"), field("vals"), field("keys"), k, has, field("len"), field("len"))
+	case "len":
+		r = field("len")
+	}
+	return
+}
+
+// astHasKey はマップ m にキー k があることを表す式の AST を作成する関数。
+// 例：HasKey(m, k)
+func astHasKey(m, k ast.Expr) (r ast.Expr) {
+	r = &ast.CallExpr{
+		Fun: ast.NewIdent("HasKey"),
+		Args: []ast.Expr{
+			m,
+			k,
+		},
+	}
+	return
+}
+
+// normCommaOk はマップの参照の代入 v, ok = m[k] を v, ok = m[k], HasKey(m, k) に直す関数。
+// それ以外の代入文はそのまま返す。
+func normCommaOk(vars map[string]ast.Expr, s *ast.AssignStmt) (r *ast.AssignStmt) {
+	r = s
+	if len(s.Lhs) != 2 || len(s.Rhs) != 1 {
+		return
+	}
+	ie, ok := s.Rhs[0].(*ast.IndexExpr)
+	if !ok || mapTypeOf(typeOf(vars, ie.X)) == nil {
+		return
+	}
+	r = &ast.AssignStmt{Lhs: s.Lhs, Tok: s.Tok, Rhs: []ast.Expr{ie, astHasKey(ie.X, ie.Index)}}
+	return
+}
+
+// deleteAssign は delete(m, k) の文を代入文 m = Delete(m, k) に直す関数
+func deleteAssign(es *ast.ExprStmt) (r *ast.AssignStmt, ok bool) {
+	ce, isCall := es.X.(*ast.CallExpr)
+	if !isCall || len(ce.Args) != 2 {
+		return
+	}
+	if ident, isIdent := ce.Fun.(*ast.Ident); !isIdent || ident.Name != "delete" {
+		return
+	}
+	m := ce.Args[0]
+	r = &ast.AssignStmt{
+		Lhs: []ast.Expr{m},
+		Tok: token.ASSIGN,
+		Rhs: []ast.Expr{&ast.CallExpr{Fun: ast.NewIdent("Delete"), Args: []ast.Expr{m, ce.Args[1]}}},
+	}
+	ok = true
+	return
+}
+
+// changedMapArgs は関数呼び出しで呼び出し先 d が変更しうるマップの入力パラメータに渡す実引数の変数のリストを取得する関数。
+// マップは参照なので、呼び出し先の m[k] = v や delete(m, k) は呼び出し側の実引数のマップにも及ぶ。
+// 関数本体で代入されない (Unchanged) パラメータと、変数でない実引数は除く。
+// 実引数 s.m や a[i] は、その値をもつ変数 s、a とする。
+func changedMapArgs(types map[string]ast.Expr, d Data, args []ast.Expr) (r []*ast.Ident) {
+	iParams, _, iTypes, _ := d.getParams()
+	unchanged := map[string]bool{}
+	for _, name := range d.Unchanged {
+		unchanged[name] = true
+	}
+	seen := map[string]bool{}
+	for i, v := range iParams {
+		if i >= len(args) || unchanged[v.(*ast.Ident).Name] || mapTypeOf(iTypes[i]) == nil {
+			continue
+		}
+		root := argRoot(args[i])
+		if root == nil || types[root.Name] == nil || isHeapVar(root.Name) || seen[root.Name] {
+			continue
+		}
+		seen[root.Name] = true
+		r = append(r, root)
+	}
+	return
+}
+
+// argRoot は実引数 expr の値をもつ変数を取得する関数。変数でないときは nil を返す。
+func argRoot(expr ast.Expr) (r *ast.Ident) {
+	for {
+		switch expr.(type) {
+		case *ast.Ident:
+			r = expr.(*ast.Ident)
+			return
+		case *ast.SelectorExpr:
+			expr = expr.(*ast.SelectorExpr).X
+		case *ast.IndexExpr:
+			expr = expr.(*ast.IndexExpr).X
+		case *ast.ParenExpr:
+			expr = expr.(*ast.ParenExpr).X
+		default:
+			return
+		}
+	}
+}
+
+// mapLenFact はマップ型 typ の値 x の要素数が 0 以上である条件式を作成する関数。マップ型でないときは nil を返す。
+func mapLenFact(typ, x ast.Expr) (r ast.Expr) {
+	if mapTypeOf(typ) == nil {
+		return
+	}
+	r = nonNegative(&ast.CallExpr{Fun: ast.NewIdent("len"), Args: []ast.Expr{x}})
+	return
+}
+
+// mapParamFacts は関数の型 ft の入力パラメータのうちマップのものの要素数が 0 以上である条件式のリストを作成する関数
+func mapParamFacts(ft *ast.FuncType) (r []ast.Expr) {
+	for _, field := range ft.Params.List {
+		for _, name := range field.Names {
+			if fact := mapLenFact(field.Type, name); fact != nil {
+				r = append(r, fact)
+			}
+		}
+	}
+	return
+}
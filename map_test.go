@@ -0,0 +1,120 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// マップは値の配列、キーの有無の配列、要素数の組のデータ型になり、参照、代入、delete、len はその操作になる
+func TestMapSMT(t *testing.T) {
+	src := `package main
+
+func f(m map[int]int, k, v int) (r int, ok bool, n int) {
+	PRE("!HasKey(m, k) && len(m) >= 0")
+	m[k] = v
+	r, ok = m[k]
+	delete(m, k)
+	e := make(map[int]int)
+	n = len(m) + len(e) + e[k]
+	POST("r == v && ok && !HasKey(m, k) && n == len(m)")
+	return
+}
+`
+	expectSMT(t, src, []string{"f"},
+		"(declare-datatypes ((|map[int]int| 0)) (((|mk-map[int]int| (|map[int]int.vals| (Array Int Int)) (|map[int]int.keys| (Array Int Bool)) (|map[int]int.len| Int)))))",
+		"(declare-const m |map[int]int|)",
+		"(not (select (|map[int]int.keys| m) k))",
+		"(|map[int]int.len| m)",
+		"(store (|map[int]int.keys| m) k true)",
+		"(store (|map[int]int.vals| m) k v)",
+		"k false)",
+		"((as const (Array Int Int)) 0)",
+		"((as const (Array Int Bool)) false)")
+}
+
+// ループの中で delete するマップはループの先頭で値を定めない。
+// ループのあとで PRE の HasKey(m, 1) を仮定せずに POST を示すことになる。
+func TestMapDeleteInLoop(t *testing.T) {
+	src := `package main
+
+func f(m map[int]int, n int) (r int) {
+	PRE("HasKey(m, 1) && n >= 0")
+	i := 0
+	for i < n {
+		INV("i >= 0")
+		delete(m, 1)
+		i++
+	}
+	r = 0
+	POST("HasKey(m, 1)")
+	return
+}
+`
+	wants := map[string]string{
+		// ループを抜けたあとの条件は INV だけを仮定する
+		"wp": "(=> (and (>= i 0) (not (< i n))) (select (|map[int]int.keys| m) 1))",
+		// ループの先頭の m は新しい定数
+		"passive": "(declare-const m@1 |map[int]int|)",
+		"symexec": "(declare-const m@1 |map[int]int|)",
+	}
+	for _, vcgen := range vcgens {
+		scripts := strings.Join(smtScripts(t, vcgen, src, "f"), "\n")
+		if !strings.Contains(scripts, wants[vcgen]) {
+			t.Errorf("%s: %q is not in\n%s", vcgen, wants[vcgen], scripts)
+		}
+	}
+}
+
+// マップは参照なので、呼び出し先でキーを追加、削除しうるマップの実引数は呼び出しのあとは値を定めない。
+// パラメータのマップの要素数は 0 以上とする。
+func TestMapArgAtCall(t *testing.T) {
+	src := `package main
+
+func put(m map[int]int, k int) (r int) {
+	PRE("true")
+	m[k] = 1
+	r = 0
+	POST("r == 0")
+	return
+}
+
+func del(m map[int]int, k int) {
+	PRE("true")
+	delete(m, k)
+	POST("true")
+}
+
+func g(m map[int]int) (r int) {
+	PRE("!HasKey(m, 1)")
+	r = put(m, 1)
+	POST("!HasKey(m, 1)")
+	return
+}
+
+func h(m map[int]int) (r int) {
+	PRE("HasKey(m, 1)")
+	del(m, 1)
+	r = 0
+	POST("HasKey(m, 1)")
+	return
+}
+`
+	for _, name := range []string{"g", "h"} {
+		expectSMT(t, src, []string{"put", "del", name}, "(>= (|map[int]int.len| m) 0)")
+		wants := map[string][]string{
+			// 呼び出しのあとのマップは全称量化した新規変数
+			"wp": {"(=> (>= (|map[int]int.len| u$", "(select (|map[int]int.keys| u$"},
+			// 呼び出しのあとのマップは新しい版の定数
+			"passive": {"(>= (|map[int]int.len| m@1) 0)", "(select (|map[int]int.keys| m@1) 1)"},
+			"symexec": {"(>= (|map[int]int.len| m@1) 0)", "(select (|map[int]int.keys| m@1) 1)"},
+		}
+		for _, vcgen := range vcgens {
+			scripts := strings.Join(smtScripts(t, vcgen, src, "put", "del", name), "\n")
+			for _, want := range wants[vcgen] {
+				if !strings.Contains(scripts, want) {
+					t.Errorf("%s: %s: %q is not in\n%s", vcgen, name, want, scripts)
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+// old.go
+// 関数の入口での値 old(e)
+
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// POST や INV の中の old(e) は、関数の入口での式 e の値を表す。
+// 関数の入口で変数 x の値を新しい定数 x$old に写しとったものとし、old(e) は e の中の変数 x を x$old に置換した式とする。
+// 検証条件では事前条件に x$old == x を加える。x$old はプログラムの代入で置換されないので、入口での値のままとなる。
+//
+//   POST("x == old(x) + 1") => x == x$old + 1
+//
+// 関数呼び出しでは、呼び出し先の事後条件の x$old を呼び出し時点の実引数の値で置換する。
+// old の外に現れる入力パラメータ x は呼び出し先の終了時の値で、関数本体で代入されるときは呼び出し側からは見えない。
+// そのときは x を存在量化した変数 x$post に置き換える。data.go の instAsserts 参照。
+
+// oldSuffix は関数の入口での値を表す変数の名前の接尾辞
+const oldSuffix = "$old"
+
+// postSuffix は呼び出し先の終了時の入力パラメータの値を表す変数の名前の接尾辞
+const postSuffix = "$post"
+
+// oldIdent は変数 name の関数の入口での値を表す Ident を作成する関数
+func oldIdent(name string) (r *ast.Ident) {
+	r = ast.NewIdent(name + oldSuffix)
+	return
+}
+
+// postIdent は入力パラメータ name の呼び出し先の終了時の値を表す Ident を作成する関数
+func postIdent(name string) (r *ast.Ident) {
+	r = ast.NewIdent(name + postSuffix)
+	return
+}
+
+// unchangedParams は関数本体 body で代入されない入力パラメータ params の名前のリストを作成する関数。
+// 代入、++ と --、range の代入先、& でアドレスをとる変数、delete(m, k) のマップは、
+// 内側のスコープで宣言したものでも代入されるものとする。
+// p.x = e、a[i] = e の代入先は、その値をもつ変数 p、a の代入とする (assignedRoot 参照)。
+func unchangedParams(params [][2]string, body *ast.BlockStmt) (r []string) {
+	vars := map[string]ast.Expr{}
+	for _, p := range params {
+		if typ, err := parser.ParseExpr(p[1]); err == nil {
+			vars[p[0]] = typ
+		}
+	}
+	changed := map[string]bool{}
+	mark := func(e ast.Expr) {
+		if ident := assignedRoot(vars, e); ident != nil {
+			changed[ident.Name] = true
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.AssignStmt:
+			for _, lhs := range n.(*ast.AssignStmt).Lhs {
+				mark(lhs)
+			}
+		case *ast.IncDecStmt:
+			mark(n.(*ast.IncDecStmt).X)
+		case *ast.RangeStmt:
+			mark(n.(*ast.RangeStmt).Key)
+			mark(n.(*ast.RangeStmt).Value)
+		case *ast.UnaryExpr:
+			if n.(*ast.UnaryExpr).Op == token.AND {
+				mark(n.(*ast.UnaryExpr).X)
+			}
+		case *ast.CallExpr:
+			ce := n.(*ast.CallExpr)
+			if ident, ok := ce.Fun.(*ast.Ident); ok && ident.Name == "delete" && len(ce.Args) == 2 {
+				mark(ce.Args[0])
+			}
+		}
+		return true
+	})
+	for _, p := range params {
+		if !changed[p[0]] {
+			r = append(r, p[0])
+		}
+	}
+	return
+}
+
+// assignedRoot は代入先 e によって値が変わる変数の Ident を返す関数。vars は変数名とその型。
+// フィールド p.x、要素 a[i]、括弧の代入先は、その値をもつ変数の代入とする。
+// ポインタを通した代入 (*p = e、ポインタ p の p.x = e) はヒープの変更で、変数の値は変わらないので nil を返す。
+func assignedRoot(vars map[string]ast.Expr, e ast.Expr) (r *ast.Ident) {
+	for {
+		switch e.(type) {
+		case *ast.Ident:
+			r = e.(*ast.Ident)
+			return
+		case *ast.ParenExpr:
+			e = e.(*ast.ParenExpr).X
+		case *ast.IndexExpr:
+			e = e.(*ast.IndexExpr).X
+		case *ast.SelectorExpr:
+			x := e.(*ast.SelectorExpr).X
+			if _, isPtr := underlying(typeOf(vars, x)).(*ast.StarExpr); isPtr {
+				return
+			}
+			e = x
+		default:
+			return
+		}
+	}
+}
+
+// elimOld は式の中の old(e) を、e の中の変数名の表 vars の変数を入口での値に置換した式に直す関数
+func elimOld(vars map[string]ast.Expr, expr ast.Expr) (r ast.Expr) {
+	var names []string
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var vs, es []ast.Expr
+	for _, name := range names {
+		vs = append(vs, ast.NewIdent(name))
+		es = append(es, oldIdent(name))
+	}
+	r = mapExpr(expr, func(e ast.Expr) (x ast.Expr, ok bool) {
+		ce, isCall := e.(*ast.CallExpr)
+		if !isCall || len(ce.Args) != 1 {
+			return
+		}
+		if ident, isIdent := ce.Fun.(*ast.Ident); !isIdent || ident.Name != "old" {
+			return
+		}
+		// old(old(e)) は old(e) と同じ
+		x, err := subst(elimOld(map[string]ast.Expr{}, ce.Args[0]), vs, es)
+		ok = err == nil
+		return
+	})
+	return
+}
+
+// elimOldStmts は文の中の表明文 (INV など) の old(e) を入口での値に置換する関数。
+// 表明文はヒープの変換で式を引数とするものになっているので、その引数を置き換える。
+func elimOldStmts(vars map[string]ast.Expr, stmts []ast.Stmt) {
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			es, ok := n.(*ast.ExprStmt)
+			if !ok {
+				return true
+			}
+			if tag, _, ok := isAssertStmt(es); ok && tag != "MODIFIES" {
+				ce := es.X.(*ast.CallExpr)
+				ce.Args[0] = elimOld(vars, ce.Args[0])
+			}
+			return false
+		})
+	}
+}
+
+// snapshotOld は式と文の中に現れる入口での値を表す変数 x$old を変数名の表 vars に登録し、
+// 事前条件 pre に x$old == x を加えた条件式を作成する関数
+func snapshotOld(vars map[string]ast.Expr, pre ast.Expr, nodes ...ast.Node) (r ast.Expr) {
+	r = pre
+	seen := map[string]bool{}
+	var names []string
+	for _, node := range nodes {
+		ast.Inspect(node, func(n ast.Node) bool {
+			ident, ok := n.(*ast.Ident)
+			if !ok || !strings.HasSuffix(ident.Name, oldSuffix) {
+				return true
+			}
+			name := strings.TrimSuffix(ident.Name, oldSuffix)
+			if vars[name] != nil && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+			return true
+		})
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+	var eqs []ast.Expr
+	for _, name := range names {
+		vars[name+oldSuffix] = vars[name]
+		eqs = append(eqs, astIdentical(oldIdent(name), ast.NewIdent(name)))
+	}
+	r = astAnd(pre, astAnds(eqs...))
+	return
+}
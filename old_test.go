@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// 呼び出し先の事後条件の old(x) と x
+
+const incSrc = `package main
+
+func inc(x int) (r int) {
+	PRE("true")
+	x = x + 1
+	r = x
+	POST("x == old(x) + 1 && r == x")
+	return
+}
+
+func id(x int) (r int) {
+	PRE("true")
+	r = x
+	POST("r == x")
+	return
+}
+`
+
+func TestOldAtCall(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		ok   bool
+	}{
+		{
+			name: "old and final value",
+			src: `
+func use(a int) (b int) {
+	PRE("true")
+	b = inc(a)
+	POST("b == a + 1")
+	return
+}
+`,
+			ok: true,
+		},
+		{
+			// 終了時の x を実引数に置き換えると a == a + 1 となり、何でも検証できてしまう
+			name: "not vacuous",
+			src: `
+func use(a int) (b int) {
+	PRE("true")
+	b = inc(a)
+	POST("b == 100")
+	return
+}
+`,
+			ok: false,
+		},
+		{
+			name: "final value of assigned parameter",
+			src: `
+func use(a int) (b int) {
+	PRE("true")
+	b = inc(a)
+	POST("b == a")
+	return
+}
+`,
+			ok: false,
+		},
+		{
+			// 代入されないパラメータの終了時の値は実引数の値
+			name: "unchanged parameter",
+			src: `
+func use(a int) (b int) {
+	PRE("true")
+	b = id(a)
+	POST("b == a")
+	return
+}
+`,
+			ok: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectVerdict(t, incSrc+tt.src, tt.ok, "inc", "id", "use")
+		})
+	}
+}
+
+func TestUnchangedParams(t *testing.T) {
+	fileNode := setupSrc(t, `package main
+
+func f(a, b, c, d, e int, p *int) {
+	a = 1
+	b++
+	for c = range []int{} {
+	}
+	q := &d
+	*p = e + *q
+}
+`)
+	funcDecl := pickupFuncDecl(fileNode, "f")
+	inputs, _ := getIOParams(funcDecl.Type)
+	got := unchangedParams(inputs, funcDecl.Body)
+	if len(got) != 2 || got[0] != "e" || got[1] != "p" {
+		t.Errorf("unchangedParams: got %v, want [e p]", got)
+	}
+
+	// フィールド、要素、delete の代入先は変数の代入。ポインタを通した代入は変数を変えない
+	fileNode = setupSrc(t, fieldSrc+`
+func h(p Point, a []int, m map[int]int, u Point, s *Point, b Box) {
+	p.x = 1
+	a[0] = 1
+	delete(m, 0)
+	(u).y = 2
+	s.x = 1
+	b.p.x = 1
+}
+`)
+	funcDecl = pickupFuncDecl(fileNode, "h")
+	inputs, _ = getIOParams(funcDecl.Type)
+	got = unchangedParams(inputs, funcDecl.Body)
+	if len(got) != 2 || got[0] != "s" || got[1] != "b" {
+		t.Errorf("unchangedParams: got %v, want [s b]", got)
+	}
+}
+
+const fieldSrc = `package main
+
+type Point struct{ x, y int }
+
+type Box struct{ p *Point }
+`
+
+// 呼び出し先でフィールドを代入したパラメータは値渡しなので、呼び出し側の実引数は変わらない
+func TestFieldAssignAtCall(t *testing.T) {
+	src := fieldSrc + `
+func set(p Point) (z int) {
+	PRE("true")
+	p.x = 5
+	z = 0
+	POST("p.x == 5 && z == 0")
+	return
+}
+
+func g() (r int) {
+	PRE("true")
+	q := Point{x: 1}
+	z := set(q)
+	r = q.x + z
+	POST("r == 5")
+	return
+}
+`
+	expectSMT(t, src, []string{"set", "g"}, "(exists ((p$post Point)) (and (= (Point.x p$post) 5) ")
+}
+
+// 関数の本体での old(e) は入口での値
+func TestOldInCallee(t *testing.T) {
+	bump := `
+func bump(x int) (y int) {
+	PRE("x >= 0")
+	x = x + 1
+	y = x
+	POST("%s")
+	return
+}
+`
+	loop := `
+func add(x, k int) (r int) {
+	PRE("k >= 0")
+	i := 0
+	for i < k {
+		INV("%s")
+		x = x + 1
+		i = i + 1
+	}
+	r = x
+	POST("r == old(x) + k")
+	return
+}
+`
+	runVerdictTests(t, []verdictTest{
+		{name: "POST", src: fmt.Sprintf(bump, "y == old(x) + 1 && x == old(x) + 1"), funcs: []string{"bump"}, ok: true},
+		{name: "POST NG", src: fmt.Sprintf(bump, "y == old(x)"), funcs: []string{"bump"}, ok: false},
+		{name: "INV", src: fmt.Sprintf(loop, "0 <= i && i <= k && x == old(x) + i"), funcs: []string{"add"}, ok: true},
+		{name: "INV NG", src: fmt.Sprintf(loop, "0 <= i && i <= k && x == old(x)"), funcs: []string{"add"}, ok: false},
+	})
+}
@@ -0,0 +1,238 @@
+// predicate.go
+// 名前つきの述語 (PREDICATE) と補題 (LEMMA)
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// 表明でくり返し使う式は、パッケージレベルの PREDICATE で名前をつけて定義できる。
+// 1 つ目の引数はパラメータに型をつけた述語の名前、2 つ目の引数は述語の本体の式。
+//
+//	var _ = PREDICATE("sorted(a []int, n int)", "ForAll(i, int, Implies(0 < i && i < n, a[i-1] <= a[i]))")
+//
+// 述語は本体を返す bool の純粋関数として pureTab に登録し、define-fun に変換する。pure.go 参照。
+//
+// LEMMA は補題の宣言で、パラメータのすべての値について本体の式が成り立つことを表す。
+//
+//	var _ = LEMMA("sortedPrefix(a []int, n int, m int)", "Implies(0 <= m && m <= n && sorted(a, n), sorted(a, m))")
+//
+// 補題は起動時に宣言の順に一度だけ証明し (それより前の補題は仮定してよい)、
+// 以降はその補題が使う述語や純粋関数を参照する SMT Script に公理 (forall) として加える。
+
+// specDef は PREDICATE または LEMMA の宣言
+type specDef struct {
+	kind   string              // "PREDICATE" または "LEMMA"
+	name   string              // 名前
+	sig    string              // パラメータリストの文字列 "(a []int, n int)"
+	params []ast.Expr          // パラメータの Ident のリスト
+	vars   map[string]ast.Expr // パラメータの変数名とその型
+	body   ast.Expr            // 本体の式
+	lit    *ast.BasicLit       // 本体の文字列リテラル
+	scope  token.Pos           // 本体を型検査するスコープの位置。typecheck.go 参照。
+	calls  []string            // 本体で呼び出す純粋関数の名前のリスト
+	proved bool                // LEMMA を証明したかどうか
+}
+
+// specDefs はファイルで宣言されている PREDICATE と LEMMA のリスト (宣言の順)
+var specDefs []*specDef
+
+// errorf は PREDICATE または LEMMA の位置 pos のエラーを作成する関数
+func (def *specDef) errorf(pos token.Pos, format string, a ...interface{}) error {
+	return fmt.Errorf("%s: %s %s: %s", specErrPos(pos), def.kind, def.name, fmt.Sprintf(format, a...))
+}
+
+// loadSpecDefs はパッケージレベルの var _ = PREDICATE(...) と var _ = LEMMA(...) を specDefs に登録する関数。
+// PREDICATE は純粋関数の定義にして返す。
+func loadSpecDefs(fileNode *ast.File) (preds []*pureFunc, err error) {
+	specDefs = nil
+	for _, decl := range fileNode.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.VAR {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			for _, value := range spec.(*ast.ValueSpec).Values {
+				ce, ok := value.(*ast.CallExpr)
+				if !ok {
+					continue
+				}
+				ident, ok := ce.Fun.(*ast.Ident)
+				if !ok || ident.Name != "PREDICATE" && ident.Name != "LEMMA" {
+					continue
+				}
+				var def *specDef
+				def, err = newSpecDef(ident.Name, ce)
+				if err != nil {
+					return
+				}
+				specDefs = append(specDefs, def)
+				if def.kind == "PREDICATE" {
+					preds = append(preds, def.pureFunc())
+				}
+			}
+		}
+	}
+	return
+}
+
+// newSpecDef は PREDICATE(sig, body) または LEMMA(sig, body) の呼び出し ce から宣言を作成する関数
+func newSpecDef(kind string, ce *ast.CallExpr) (def *specDef, err error) {
+	def = &specDef{kind: kind, vars: map[string]ast.Expr{}}
+	var lits []*ast.BasicLit
+	for _, arg := range ce.Args {
+		if bl, ok := arg.(*ast.BasicLit); ok && bl.Kind == token.STRING {
+			lits = append(lits, bl)
+		}
+	}
+	if len(ce.Args) != 2 || len(lits) != 2 {
+		err = fmt.Errorf("%s: %s: two string literals are expected", fset.Position(ce.Pos()), kind)
+		return
+	}
+
+	// "sorted(a []int, n int)" を名前とパラメータリストに分ける
+	header := lits[0].Value[1 : len(lits[0].Value)-1]
+	i := strings.Index(header, "(")
+	if i < 0 || !token.IsIdentifier(strings.TrimSpace(header[:i])) {
+		err = fmt.Errorf("%s: %s: name(params) is expected", specPos(lits[0], 0), kind)
+		return
+	}
+	def.name, def.sig = strings.TrimSpace(header[:i]), header[i:]
+	var x ast.Expr
+	x, err = parseSpecAt(lits[0], kind+" "+def.name, i-len("func"), "func"+def.sig)
+	if err != nil {
+		return
+	}
+	ft, ok := x.(*ast.FuncType)
+	if !ok || ft.Results != nil {
+		err = def.errorf(lits[0].Pos(), "name(params) is expected")
+		return
+	}
+	for _, field := range ft.Params.List {
+		if len(field.Names) == 0 {
+			err = def.errorf(field.Pos(), "parameter %s needs a type", nodeString(field.Type))
+			return
+		}
+		for _, name := range field.Names {
+			def.params = append(def.params, ast.NewIdent(name.Name))
+			def.vars[name.Name] = field.Type
+		}
+	}
+
+	def.lit = lits[1]
+	def.body, err = parseSpec(def.lit, kind+" "+def.name)
+	return
+}
+
+// pureFunc は PREDICATE を本体の式を返す bool の純粋関数にする関数
+func (def *specDef) pureFunc() (pf *pureFunc) {
+	pf = &pureFunc{
+		kind:   "predicate",
+		name:   def.name,
+		params: def.params,
+		vars:   def.vars,
+		result: ast.NewIdent("bool"),
+		stmts:  []ast.Stmt{&ast.ReturnStmt{Results: []ast.Expr{def.body}}},
+		pos:    def.lit.Pos(),
+		end:    def.lit.End(),
+	}
+	return
+}
+
+// checkSpecDefs は PREDICATE と LEMMA の本体を型検査する関数。typecheck.go 参照。
+func checkSpecDefs() (err error) {
+	for _, def := range specDefs {
+		err = checkSpecExpr(def.kind+" "+def.name, types.IsBoolean, def.lit, def.body, def.scope)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// proveLemmas は LEMMA を宣言の順に証明する関数。
+// 証明した LEMMA はそれ以降の SMT Script で公理として使う。
+func proveLemmas() (err error) {
+	for _, def := range specDefs {
+		if def.kind != "LEMMA" {
+			continue
+		}
+		vars := map[string]ast.Expr{}
+		for name, typ := range def.vars {
+			vars[name] = typ
+		}
+		var result, outText string
+		result, outText, err = checkCond(vars, astNot(def.body))
+		if err != nil {
+			return
+		}
+		switch result {
+		case "unsat":
+			def.proved = true
+			fmt.Printf("Lemma: %s%s proved\n", def.name, def.sig)
+		case "sat":
+			err = fmt.Errorf("%s: LEMMA %s is not valid; counter-example: %s", specPos(def.lit, 0), def.name, outText)
+			return
+		default:
+			err = fmt.Errorf("%s: LEMMA %s: something wrong", specPos(def.lit, 0), def.name)
+			return
+		}
+	}
+	return
+}
+
+// usedDefs は式 expr で使われる純粋関数と、それらの純粋関数を参照する証明済みの LEMMA を集める関数。
+// 純粋関数は呼び出される関数が先になる順、LEMMA は宣言の順とする。
+func usedDefs(expr ast.Expr) (pfs []*pureFunc, lemmas []*specDef) {
+	roots := []ast.Expr{expr}
+	selected := map[*specDef]bool{}
+	for {
+		pfs = usedPureFuncs(roots...)
+		used := map[string]bool{}
+		for _, pf := range pfs {
+			used[pf.name] = true
+		}
+		changed := false
+		for _, def := range specDefs {
+			if def.kind != "LEMMA" || !def.proved || selected[def] {
+				continue
+			}
+			for _, name := range def.calls {
+				if used[name] {
+					selected[def] = true
+					roots = append(roots, def.body)
+					changed = true
+					break
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	for _, def := range specDefs {
+		if selected[def] {
+			lemmas = append(lemmas, def)
+		}
+	}
+	return
+}
+
+// convLemma は LEMMA を公理とする SMT LIB Language 仕様のコードを作成する関数
+func (def *specDef) convLemma() (r string) {
+	saved := convEnv
+	convEnv = def.vars
+	body := convExpr(def.body)
+	convEnv = saved
+	if len(def.params) == 0 {
+		r = fmt.Sprintf("(assert %s)", body)
+		return
+	}
+	r = fmt.Sprintf("(assert (forall (%s) %s))", convParams(def.params, def.vars), body)
+	return
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// PREDICATE と LEMMA の宣言
+const predicateSrc = `
+var _ = PREDICATE("between(x int, lo int, hi int)", "lo <= x && x <= hi")
+var _ = LEMMA("betweenShift(x int, lo int, hi int)", "Implies(between(x, lo, hi), between(x+1, lo+1, hi+1))")
+var _ = PREDICATE("positive(x int)", "x > 0")
+`
+
+// PREDICATE は表明の中で展開せずに呼び出せる
+func TestPredicates(t *testing.T) {
+	runVerdictTests(t, []verdictTest{
+		{name: "ok", src: predicateSrc + `
+func f(x int) (r int) {
+	PRE("between(x, 0, 2)")
+	r = x + 1
+	POST("between(r, 1, 3) && positive(r)")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "ng", src: predicateSrc + `
+func f(x int) (r int) {
+	PRE("between(x, 0, 2)")
+	r = x + 1
+	POST("between(r, 1, 2)")
+	return
+}
+`, funcs: []string{"f"}, ok: false},
+	})
+}
+
+// PREDICATE は define-fun になり、LEMMA はそれが参照する述語を使う SMT Script にだけ公理として加わる
+func TestPredicateSMT(t *testing.T) {
+	src := "package main\n" + predicateSrc + `
+func f(x int) (r int) {
+	PRE("between(x, 0, 2)")
+	r = x + 1
+	POST("between(r, 1, 3)")
+	return
+}
+
+func g(x int) (r int) {
+	PRE("positive(x)")
+	r = x
+	POST("positive(r)")
+	return
+}
+`
+	expectSMT(t, src, []string{"f"},
+		"(define-fun between ((x Int) (lo Int) (hi Int)) Bool",
+		"(assert (forall ((x Int) (lo Int) (hi Int)) (=> (between x lo hi) (between (+ x 1) (+ lo 1) (+ hi 1)))))")
+	for _, vcgen := range vcgens {
+		for _, script := range smtScripts(t, vcgen, src, "g") {
+			if !strings.Contains(script, "(define-fun positive ((x Int)) Bool") {
+				t.Errorf("%s: no define-fun positive:\n%s", vcgen, script)
+			}
+			if strings.Contains(script, "between") {
+				t.Errorf("%s: unused predicate or lemma:\n%s", vcgen, script)
+			}
+		}
+	}
+}
+
+// 成り立たない LEMMA は起動時の証明でエラーになる
+func TestLemmaNotValid(t *testing.T) {
+	setupSrc(t, "package main\n"+specStubs)
+	fset = token.NewFileSet()
+	src := `package main
+
+var _ = LEMMA("wrong(x int)", "x * x > x")
+`
+	fileNode, err := parser.ParseFile(fset, "src.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = loadPureFuncs(fileNode); err != nil {
+		t.Fatal(err)
+	}
+	if err = loadTypes(fileNode); err != nil {
+		t.Fatal(err)
+	}
+	if err = checkSpecDefs(); err != nil {
+		t.Fatal(err)
+	}
+	err = proveLemmas()
+	if err == nil || !strings.Contains(err.Error(), "LEMMA wrong is not valid") {
+		t.Errorf("got %v", err)
+	}
+}
@@ -0,0 +1,575 @@
+// pure.go
+// 表明とコードから呼び出せる純粋関数
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"sort"
+	"strings"
+)
+
+// 関数の直前のコメントに //hl:pure と書いた関数は副作用のない純粋関数とし、
+// 表明とコードの両方から呼び出せる。
+//
+//	//hl:pure
+//	func sorted(a []int, n int) bool {
+//		if n <= 1 {
+//			return true
+//		}
+//		return a[n-2] <= a[n-1] && sorted(a, n-1)
+//	}
+//
+// 純粋関数の本体は SMT LIB Language の define-fun (再帰するときは define-funs-rec) に変換し、
+// 呼び出しはその関数の適用とする。本体に書ける文は次のものに限る。
+//
+//	x := e                    ローカル変数の定義 (let に変換)
+//	if c { ... } else { ... } 場合分け (ite に変換)
+//	return e                  関数の値
+//
+// 純粋関数のパラメータはポインタであってはならず、結果はひとつとする。
+// 再帰する純粋関数には DECREASES が必要で、その停止性は hl src.go f で関数を検証するときに検証する。
+
+// pureDirective は純粋関数を表す指示コメント
+const pureDirective = "//hl:pure"
+
+// pureFunc は純粋関数の定義
+type pureFunc struct {
+	kind    string              // "pure function" または "predicate"
+	name    string              // 関数名
+	params  []ast.Expr          // パラメータの Ident のリスト
+	vars    map[string]ast.Expr // パラメータの変数名とその型
+	result  ast.Expr            // 結果の型
+	pre     ast.Expr            // PRE の事前条件。ないときは nil
+	measure ast.Expr            // DECREASES の減少量。ないときは nil
+	stmts   []ast.Stmt          // 表明文を除いた関数本体の文
+	calls   []string            // 本体で呼び出す純粋関数の名前のリスト
+	pos     token.Pos           // 宣言の位置
+	end     token.Pos           // 関数本体の末尾の位置
+}
+
+// pureTab は純粋関数の名前とその定義の表
+var pureTab map[string]*pureFunc
+
+// specFuncs は表明の式で使える組み込みの関数
+var specFuncs = map[string]bool{
+	"Implies":   true,
+	"ForAll":    true,
+	"Exists":    true,
+	"ForAllIn":  true,
+	"ExistsIn":  true,
+	"Let":       true,
+	"Select":    true,
+	"Store":     true,
+	"Pattern":   true,
+	"len":       true,
+	"int":       true,
+	"byte":      true,
+	"rune":      true,
+	"float64":   true,
+	"float32":   true,
+	"Identical": true,
+	"HasKey":    true,
+	"Delete":    true,
+	"make":      true,
+}
+
+// loadPureFuncs はファイルで宣言されている純粋関数と PREDICATE を pureTab に登録する関数。
+// PREDICATE と LEMMA については predicate.go 参照。
+func loadPureFuncs(fileNode *ast.File) (err error) {
+	pureTab = map[string]*pureFunc{}
+	var pfs []*pureFunc
+	for _, decl := range fileNode.Decls {
+		fd, ok := decl.(*ast.FuncDecl)
+		if !ok || !isPureDecl(fd) {
+			continue
+		}
+		var pf *pureFunc
+		pf, err = newPureFunc(fd)
+		if err != nil {
+			return
+		}
+		pfs = append(pfs, pf)
+	}
+	var preds []*pureFunc
+	preds, err = loadSpecDefs(fileNode)
+	if err != nil {
+		return
+	}
+	pfs = append(pfs, preds...)
+	for _, pf := range pfs {
+		if isPureName(pf.name) {
+			err = pf.errorf(pf.pos, "redeclared")
+			return
+		}
+		pureTab[pf.name] = pf
+	}
+
+	// 本体で呼び出す関数は純粋関数か表明の組み込みの関数に限る
+	for _, pf := range pfs {
+		var bad *ast.CallExpr
+		pf.calls, bad = pureCallees(pf.stmts...)
+		if bad != nil {
+			err = pf.errorf(bad.Pos(), "calls non-pure function %s", nodeString(bad.Fun))
+			return
+		}
+	}
+	for _, def := range specDefs {
+		var bad *ast.CallExpr
+		def.calls, bad = pureCallees(&ast.ExprStmt{X: def.body})
+		if bad != nil {
+			err = def.errorf(bad.Pos(), "calls non-pure function %s", nodeString(bad.Fun))
+			return
+		}
+	}
+
+	// 再帰する純粋関数は DECREASES で停止性を示す必要がある
+	for _, pf := range pfs {
+		if pf.recursive() && pf.measure == nil {
+			err = pf.errorf(pf.pos, "recursion needs a //hl:pure function with DECREASES")
+			return
+		}
+	}
+	return
+}
+
+// errorf は純粋関数の位置 pos のエラーを作成する関数
+func (pf *pureFunc) errorf(pos token.Pos, format string, a ...interface{}) error {
+	return fmt.Errorf("%s: %s %s: %s", fset.Position(pos), pf.kind, pf.name, fmt.Sprintf(format, a...))
+}
+
+// isPureDecl は関数宣言の直前のコメントに //hl:pure があるかどうか調べる関数
+func isPureDecl(fd *ast.FuncDecl) bool {
+	if fd.Doc == nil {
+		return false
+	}
+	for _, c := range fd.Doc.List {
+		if strings.TrimSpace(c.Text) == pureDirective {
+			return true
+		}
+	}
+	return false
+}
+
+// newPureFunc は関数宣言 fd から純粋関数の定義を作成する関数。
+// 純粋関数に書けない文があるときはエラーとする。
+func newPureFunc(fd *ast.FuncDecl) (pf *pureFunc, err error) {
+	pf = &pureFunc{
+		kind: "pure function",
+		name: fd.Name.Name,
+		vars: map[string]ast.Expr{},
+		pos:  fd.Pos(),
+		end:  fd.Body.Rbrace,
+	}
+	if fd.Recv != nil {
+		err = pf.errorf(fd.Pos(), "methods are not supported")
+		return
+	}
+	if fd.Type.Results == nil || len(fd.Type.Results.List) != 1 || len(fd.Type.Results.List[0].Names) > 1 {
+		err = pf.errorf(fd.Pos(), "a pure function must have exactly one result")
+		return
+	}
+	pf.result = fd.Type.Results.List[0].Type
+	pf.params, err = pf.addParams(fd.Type.Params)
+	if err != nil {
+		return
+	}
+
+	var asserts map[string]ast.Expr
+	asserts, pf.stmts, err = separateStmts(fd.Body.List)
+	if err != nil {
+		return
+	}
+	pf.pre = asserts["PRE"]
+	pf.measure = asserts["DECREASES"]
+	err = pf.check(pf.stmts)
+	return
+}
+
+// addParams はパラメータリスト params の変数名とその型を pf.vars に登録し、パラメータの Ident のリストを返す関数
+func (pf *pureFunc) addParams(params *ast.FieldList) (r []ast.Expr, err error) {
+	for _, field := range params.List {
+		if _, ok := underlying(field.Type).(*ast.StarExpr); ok {
+			err = pf.errorf(field.Pos(), "pointer parameters are not supported")
+			return
+		}
+		if len(field.Names) == 0 {
+			err = pf.errorf(field.Pos(), "parameter %s needs a type", nodeString(field.Type))
+			return
+		}
+		for _, name := range field.Names {
+			r = append(r, ast.NewIdent(name.Name))
+			pf.vars[name.Name] = field.Type
+		}
+	}
+	return
+}
+
+// pureCallees は文の中で呼び出す純粋関数の名前のリストを返す関数。
+// 純粋関数と表明の組み込みの関数以外の呼び出しがあるときは、その呼び出しを bad に返す。
+func pureCallees(stmts ...ast.Stmt) (r []string, bad *ast.CallExpr) {
+	seen := map[string]bool{}
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			if bad != nil {
+				return false
+			}
+			ce, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			ident, ok := ce.Fun.(*ast.Ident)
+			switch {
+			case isPkgFuncCall(ce):
+			case ok && specFuncs[ident.Name]:
+			case ok && isPureName(ident.Name):
+				if !seen[ident.Name] {
+					seen[ident.Name] = true
+					r = append(r, ident.Name)
+				}
+			default:
+				bad = ce
+				return false
+			}
+			return true
+		})
+	}
+	return
+}
+
+// check は純粋関数の本体の文のリストが変換できる形で、どの経路も return で終わるか調べる関数
+func (pf *pureFunc) check(stmts []ast.Stmt) (err error) {
+	if len(stmts) == 0 {
+		err = pf.errorf(pf.end, "missing return")
+		return
+	}
+	rest := stmts[1:]
+	switch stmts[0].(type) {
+	case *ast.ReturnStmt:
+		if len(stmts[0].(*ast.ReturnStmt).Results) != 1 {
+			err = pf.errorf(stmts[0].Pos(), "return must have a result")
+		}
+	case *ast.AssignStmt:
+		s := stmts[0].(*ast.AssignStmt)
+		_, isIdent := s.Lhs[0].(*ast.Ident)
+		if s.Tok != token.DEFINE || len(s.Lhs) != 1 || len(s.Rhs) != 1 || !isIdent {
+			err = pf.errorf(s.Pos(), "only x := e is supported")
+			return
+		}
+		err = pf.check(rest)
+	case *ast.IfStmt:
+		s := stmts[0].(*ast.IfStmt)
+		if s.Init != nil {
+			err = pf.errorf(s.Pos(), "if with an init statement is not supported")
+			return
+		}
+		if err = pf.check(thenStmts(s, rest)); err != nil {
+			return
+		}
+		err = pf.check(elseStmts(s, rest))
+	case *ast.BlockStmt:
+		err = pf.check(append(append([]ast.Stmt{}, stmts[0].(*ast.BlockStmt).List...), rest...))
+	default:
+		err = pf.errorf(stmts[0].Pos(), "unsupported statement")
+	}
+	return
+}
+
+// thenStmts は if 文の条件が成り立つときに実行する文のリスト (後続の文 rest を含む) を返す関数
+func thenStmts(s *ast.IfStmt, rest []ast.Stmt) (r []ast.Stmt) {
+	r = append(append([]ast.Stmt{}, s.Body.List...), rest...)
+	return
+}
+
+// elseStmts は if 文の条件が成り立たないときに実行する文のリスト (後続の文 rest を含む) を返す関数
+func elseStmts(s *ast.IfStmt, rest []ast.Stmt) (r []ast.Stmt) {
+	switch s.Else.(type) {
+	case *ast.BlockStmt:
+		r = append(append([]ast.Stmt{}, s.Else.(*ast.BlockStmt).List...), rest...)
+	case *ast.IfStmt:
+		r = append([]ast.Stmt{s.Else}, rest...)
+	default:
+		r = rest
+	}
+	return
+}
+
+// isPureName は name が純粋関数の名前かどうか調べる関数
+func isPureName(name string) (ok bool) {
+	_, ok = pureTab[name]
+	return
+}
+
+// isPureCall は式が純粋関数の呼び出しかどうか調べる関数。呼び出しのときは関数名を name に返す。
+func isPureCall(expr ast.Expr) (name string, ok bool) {
+	ce, isCall := expr.(*ast.CallExpr)
+	if !isCall {
+		return
+	}
+	ident, isIdent := ce.Fun.(*ast.Ident)
+	if !isIdent || !isPureName(ident.Name) {
+		return
+	}
+	name, ok = ident.Name, true
+	return
+}
+
+// reaches は純粋関数 pf から呼び出しをたどって関数 name に到達するかどうか調べる関数
+func (pf *pureFunc) reaches(name string) bool {
+	seen := map[string]bool{}
+	var visit func(f *pureFunc) bool
+	visit = func(f *pureFunc) bool {
+		for _, callee := range f.calls {
+			if callee == name {
+				return true
+			}
+			if !seen[callee] {
+				seen[callee] = true
+				if visit(pureTab[callee]) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return visit(pf)
+}
+
+// recursive は純粋関数が (相互に) 再帰するかどうか調べる関数
+func (pf *pureFunc) recursive() bool {
+	return pf.reaches(pf.name)
+}
+
+// usedPureFuncs は式 expr から呼び出しをたどって使われる純粋関数を、
+// 呼び出される関数が先になる順に返す関数
+func usedPureFuncs(exprs ...ast.Expr) (r []*pureFunc) {
+	seen := map[string]bool{}
+	var visit func(name string)
+	visit = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		pf := pureTab[name]
+		for _, callee := range pf.calls {
+			visit(callee)
+		}
+		r = append(r, pf)
+	}
+	var names []string
+	for _, expr := range exprs {
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if ce, ok := n.(*ast.CallExpr); ok {
+				if name, ok := isPureCall(ce); ok {
+					names = append(names, name)
+				}
+			}
+			return true
+		})
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		visit(name)
+	}
+	return
+}
+
+// convPureFuncs は式 expr で使われる純粋関数を定義する SMT LIB Language 仕様のコードを作成する関数。
+// 再帰する純粋関数があるときは、すべてをひとつの define-funs-rec でまとめて定義する。
+// それらの純粋関数を参照する証明済みの LEMMA は公理として加える。predicate.go 参照。
+func convPureFuncs(expr ast.Expr) (r string) {
+	pfs, lemmas := usedDefs(expr)
+	if len(pfs) == 0 {
+		return
+	}
+	rec := false
+	for _, pf := range pfs {
+		rec = rec || pf.recursive()
+	}
+
+	var decls, bodies []string
+	for _, pf := range pfs {
+		decl := fmt.Sprintf("%s (%s) %s", pf.name, convParams(pf.params, pf.vars), convType(pf.result))
+		body := pf.convBody()
+		if !rec {
+			decls = append(decls, fmt.Sprintf("(define-fun %s %s)", decl, body))
+			continue
+		}
+		decls = append(decls, fmt.Sprintf("(%s)", decl))
+		bodies = append(bodies, body)
+	}
+	var tmp []string
+	if rec {
+		tmp = append(tmp, fmt.Sprintf("(define-funs-rec (%s) (%s))", strings.Join(decls, " "), strings.Join(bodies, " ")))
+	} else {
+		tmp = append(tmp, decls...)
+	}
+	for _, def := range lemmas {
+		tmp = append(tmp, def.convLemma())
+	}
+	r = strings.Join(tmp, "\n")
+	return
+}
+
+// convParams はパラメータのリストを SMT LIB Language 仕様の ((a (Array Int Int)) (n Int)) の中身に変換する関数
+func convParams(params []ast.Expr, vars map[string]ast.Expr) (r string) {
+	var tmp []string
+	for _, p := range params {
+		name := p.(*ast.Ident).Name
+		tmp = append(tmp, fmt.Sprintf("(%s %s)", name, convType(vars[name])))
+	}
+	r = strings.Join(tmp, " ")
+	return
+}
+
+// convBody は純粋関数の本体を SMT LIB Language 仕様の式に変換する関数
+func (pf *pureFunc) convBody() (r string) {
+	saved := convEnv
+	convEnv = pf.vars
+	r = convPureStmts(pf.stmts)
+	convEnv = saved
+	return
+}
+
+// convPureStmts は純粋関数の本体の文のリストを SMT LIB Language 仕様の式に変換する関数。
+// 文のリストは check で調べてあるものとする。
+func convPureStmts(stmts []ast.Stmt) (r string) {
+	rest := stmts[1:]
+	switch stmts[0].(type) {
+	case *ast.ReturnStmt:
+		r = convExpr(stmts[0].(*ast.ReturnStmt).Results[0])
+	case *ast.AssignStmt:
+		// (let ((x e)) rest)
+		s := stmts[0].(*ast.AssignStmt)
+		name := s.Lhs[0].(*ast.Ident).Name
+		e := convExpr(s.Rhs[0])
+		saved := convEnv
+		convEnv = bindVar(convEnv, name, typeOf(convEnv, s.Rhs[0]))
+		r = fmt.Sprintf("(let ((%s %s)) %s)", name, e, convPureStmts(rest))
+		convEnv = saved
+	case *ast.IfStmt:
+		// (ite c then else)
+		s := stmts[0].(*ast.IfStmt)
+		r = fmt.Sprintf("(ite %s %s %s)", convExpr(s.Cond), convPureStmts(thenStmts(s, rest)), convPureStmts(elseStmts(s, rest)))
+	case *ast.BlockStmt:
+		r = convPureStmts(append(append([]ast.Stmt{}, stmts[0].(*ast.BlockStmt).List...), rest...))
+	}
+	return
+}
+
+// termConds は再帰する純粋関数の停止性を検証する条件式のリストを作成する関数。
+// 再帰呼び出し g(args) ごとに、PRE とその呼び出しに至る条件 pc が成り立つとき
+// 引数が呼び出し先の PRE を満たし、呼び出し先の減少量が 0 以上で呼び出し元の減少量より真に小さいことを検証する。
+//
+//	!(pre && pc => g の PRE[g のパラメータ:=args])
+//	!(pre && pc => m >= 0 && m < f の減少量)   ただし m は g の減少量[g のパラメータ:=args]
+func (pf *pureFunc) termConds(pre ast.Expr) (r []ast.Expr, err error) {
+	if !pf.recursive() {
+		return
+	}
+	err = pf.walk(pf.stmts, ast.NewIdent("true"), nil, nil, func(pc ast.Expr, ce *ast.CallExpr) (err error) {
+		g := pureTab[ce.Fun.(*ast.Ident).Name]
+		if !g.reaches(pf.name) {
+			return
+		}
+		if g.measure == nil {
+			err = fmt.Errorf("pure function %s: %s has no DECREASES", pf.name, g.name)
+			return
+		}
+		if g.pre != nil {
+			var gpre ast.Expr
+			gpre, err = subst(g.pre, g.params, ce.Args)
+			if err != nil {
+				return
+			}
+			r = append(r, astNot(astImplies(astAnd(pre, pc), gpre)))
+		}
+		var m ast.Expr
+		m, err = subst(g.measure, g.params, ce.Args)
+		if err != nil {
+			return
+		}
+		r = append(r, astNot(astImplies(astAnd(pre, pc), astAnd(nonNegative(m), decreased(m, pf.measure)))))
+		return
+	})
+	return
+}
+
+// walk は純粋関数の本体の文のリストをたどり、純粋関数の呼び出しごとにそこに至る条件 pc とともに visit を呼ぶ関数。
+// ローカル変数 vs はその定義の式 es で置換する。
+func (pf *pureFunc) walk(stmts []ast.Stmt, pc ast.Expr, vs, es []ast.Expr, visit func(pc ast.Expr, ce *ast.CallExpr) error) (err error) {
+	rest := stmts[1:]
+	switch stmts[0].(type) {
+	case *ast.ReturnStmt:
+		err = pf.callsIn(stmts[0].(*ast.ReturnStmt).Results[0], pc, vs, es, visit)
+	case *ast.AssignStmt:
+		s := stmts[0].(*ast.AssignStmt)
+		if err = pf.callsIn(s.Rhs[0], pc, vs, es, visit); err != nil {
+			return
+		}
+		var e ast.Expr
+		e, err = subst(s.Rhs[0], vs, es)
+		if err != nil {
+			return
+		}
+		err = pf.walk(rest, pc, append([]ast.Expr{s.Lhs[0]}, vs...), append([]ast.Expr{e}, es...), visit)
+	case *ast.IfStmt:
+		s := stmts[0].(*ast.IfStmt)
+		if err = pf.callsIn(s.Cond, pc, vs, es, visit); err != nil {
+			return
+		}
+		var cond ast.Expr
+		cond, err = subst(s.Cond, vs, es)
+		if err != nil {
+			return
+		}
+		if err = pf.walk(thenStmts(s, rest), astAnd(pc, cond), vs, es, visit); err != nil {
+			return
+		}
+		err = pf.walk(elseStmts(s, rest), astAnd(pc, astNot(cond)), vs, es, visit)
+	case *ast.BlockStmt:
+		err = pf.walk(append(append([]ast.Stmt{}, stmts[0].(*ast.BlockStmt).List...), rest...), pc, vs, es, visit)
+	}
+	return
+}
+
+// callsIn は式 expr の中の純粋関数の呼び出しごとに、そこに至る条件とともに visit を呼ぶ関数。
+// a && b の b は a が成り立つとき、a || b の b は a が成り立たないときに評価される。
+func (pf *pureFunc) callsIn(expr, pc ast.Expr, vs, es []ast.Expr, visit func(pc ast.Expr, ce *ast.CallExpr) error) (err error) {
+	expr, err = subst(expr, vs, es)
+	if err != nil {
+		return
+	}
+	var inspect func(expr, pc ast.Expr)
+	inspect = func(expr, pc ast.Expr) {
+		ast.Inspect(expr, func(n ast.Node) bool {
+			if err != nil {
+				return false
+			}
+			switch n.(type) {
+			case *ast.BinaryExpr:
+				be := n.(*ast.BinaryExpr)
+				switch be.Op {
+				case token.LAND:
+					inspect(be.X, pc)
+					inspect(be.Y, astAnd(pc, be.X))
+					return false
+				case token.LOR:
+					inspect(be.X, pc)
+					inspect(be.Y, astAnd(pc, astNot(be.X)))
+					return false
+				}
+			case *ast.CallExpr:
+				ce := n.(*ast.CallExpr)
+				if _, ok := isPureCall(ce); ok {
+					err = visit(pc, ce)
+				}
+			}
+			return true
+		})
+	}
+	inspect(expr, pc)
+	return
+}
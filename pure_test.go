@@ -0,0 +1,159 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// 純粋関数の宣言。表明とコードの両方から呼び出す
+const pureSrc = `
+//hl:pure
+func max(a, b int) int {
+	if a >= b {
+		return a
+	}
+	return b
+}
+
+//hl:pure
+func sum(n int) int {
+	DECREASES("n")
+	if n <= 0 {
+		return 0
+	}
+	m := n - 1
+	return n + sum(m)
+}
+`
+
+// 純粋関数は define-fun または define-funs-rec に変換され、表明とコードから呼び出せる
+func TestPureFuncs(t *testing.T) {
+	runVerdictTests(t, []verdictTest{
+		{name: "spec", src: pureSrc + `
+func f(x, y int) (r int) {
+	PRE("true")
+	if x >= y {
+		r = x
+	} else {
+		r = y
+	}
+	POST("r == max(x, y)")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "spec ng", src: pureSrc + `
+func f(x, y int) (r int) {
+	PRE("true")
+	r = x
+	POST("r == max(x, y)")
+	return
+}
+`, funcs: []string{"f"}, ok: false},
+		{name: "code", src: pureSrc + `
+func f(x, y int) (r int) {
+	PRE("true")
+	r = max(x, y)
+	POST("r >= x && r >= y")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "recursive", src: pureSrc + `
+func f(n int) (r int) {
+	PRE("n >= 0")
+	r = 0
+	i := 0
+	for i < n {
+		INV("0 <= i && i <= n && r == sum(i)")
+		i = i + 1
+		r = r + i
+	}
+	POST("r == sum(n)")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "recursive ng", src: pureSrc + `
+func f(n int) (r int) {
+	PRE("n >= 1")
+	r = n
+	POST("r == sum(n)")
+	return
+}
+`, funcs: []string{"f"}, ok: false},
+	})
+}
+
+// 純粋関数に書けない宣言はエラーになる
+func TestPureFuncErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want string
+	}{
+		{name: "no decreases", src: `
+//hl:pure
+func sum(n int) int {
+	if n <= 0 {
+		return 0
+	}
+	return n + sum(n-1)
+}
+`, want: "recursion needs a //hl:pure function with DECREASES"},
+		{name: "non-pure callee", src: `
+func g(n int) int { return n }
+
+//hl:pure
+func h(n int) int {
+	return g(n)
+}
+`, want: "calls non-pure function g"},
+		{name: "two results", src: `
+//hl:pure
+func h(n int) (int, int) {
+	return n, n
+}
+`, want: "a pure function must have exactly one result"},
+		{name: "pointer", src: `
+//hl:pure
+func h(p *int) int {
+	return 0
+}
+`, want: "pointer parameters are not supported"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fset = token.NewFileSet()
+			fileNode, err := parser.ParseFile(fset, "src.go", "package main\n"+tt.src+specStubs, parser.ParseComments)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = loadPureFuncs(fileNode)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// 再帰する純粋関数の停止性: 再帰呼び出しの引数は PRE を満たし、減少量は 0 以上で真に小さくなる
+func TestPureTermination(t *testing.T) {
+	src := `
+//hl:pure
+func steps(n int) int {
+	PRE("n >= 0")
+	DECREASES("n")
+	POST("true")
+	if n == 0 {
+		return 0
+	}
+	m := n - %s
+	return steps(m) + 1
+}
+`
+	runVerdictTests(t, []verdictTest{
+		{name: "step 1", src: strings.Replace(src, "%s", "1", 1), funcs: []string{"steps"}, ok: true},
+		// steps(1) は steps(-1) を呼び、停止しない
+		{name: "step 2", src: strings.Replace(src, "%s", "2", 1), funcs: []string{"steps"}, ok: false},
+	})
+}
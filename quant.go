@@ -0,0 +1,296 @@
+// quant.go
+// 限量子 (ForAll、Exists、ForAllIn、ExistsIn) の式
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"strconv"
+	"strings"
+)
+
+// 表明の限量子は次の形で書く。束縛変数は識別子で、変数と型の組をくり返して複数の変数を束縛できる。
+//
+//	ForAll(x, T, e)
+//	ForAll(x, T, y, U, e)
+//	Exists(x, T, e)
+//	ForAllIn(i, lo, hi, e)  lo <= i < hi の範囲の i (int) について
+//	ExistsIn(i, lo, hi, e)
+//
+// 本体 e の直前に Pattern(t1, t2, ...) を書くと、SMT のパターン (トリガー) (! e :pattern (t1 t2 ...)) になる。
+// Pattern は複数書くことができ、z3 はそのどれかに一致する項があるときに限量子を具体化する。
+//
+//	ForAll(i, int, j, int, Pattern(a[i], a[j]), Implies(i < j, a[i] <= a[j]))
+//
+// Exists("x", T, e) のような文字列の束縛変数や型も受け付け、識別子と型の式に直す。
+
+// quant は限量子の式を分解したもの
+type quant struct {
+	kind     string       // "ForAll"、"Exists"、"ForAllIn" または "ExistsIn"
+	names    []*ast.Ident // 束縛変数
+	types    []ast.Expr   // 束縛変数の型
+	lo, hi   ast.Expr     // ForAllIn、ExistsIn の範囲。それ以外は nil
+	patterns [][]ast.Expr // パターンのリスト
+	body     ast.Expr     // 本体
+}
+
+// isQuantName は name が限量子の名前かどうか調べる関数
+func isQuantName(name string) bool {
+	switch name {
+	case "ForAll", "Exists", "ForAllIn", "ExistsIn":
+		return true
+	}
+	return false
+}
+
+// quantOf は式が限量子の呼び出しかどうか調べ、そうであれば分解する関数。
+// 限量子の呼び出しで引数の形が正しくないときは err を返す。
+func quantOf(expr ast.Expr) (q quant, ok bool, err error) {
+	ce, isCall := expr.(*ast.CallExpr)
+	if !isCall {
+		return
+	}
+	ident, isIdent := ce.Fun.(*ast.Ident)
+	if !isIdent || !isQuantName(ident.Name) {
+		return
+	}
+	ok = true
+	q.kind = ident.Name
+	args := ce.Args
+	if len(args) < 3 {
+		err = fmt.Errorf("%s: too few arguments", q.kind)
+		return
+	}
+	q.body = args[len(args)-1]
+	args = args[:len(args)-1]
+
+	// 本体の直前の Pattern(...) を取り出す
+	for len(args) > 0 {
+		pce, isPattern := args[len(args)-1].(*ast.CallExpr)
+		if !isPattern || !isPatternCall(pce) {
+			break
+		}
+		if len(pce.Args) == 0 {
+			err = fmt.Errorf("%s: empty Pattern", q.kind)
+			return
+		}
+		q.patterns = append([][]ast.Expr{pce.Args}, q.patterns...)
+		args = args[:len(args)-1]
+	}
+
+	if q.isRange() {
+		// ForAllIn(i, lo, hi, e)
+		if len(args) != 3 {
+			err = fmt.Errorf("%s: (i, lo, hi, e) is expected", q.kind)
+			return
+		}
+		var name *ast.Ident
+		if name, err = binderIdent(q.kind, args[0]); err != nil {
+			return
+		}
+		q.names, q.types = []*ast.Ident{name}, []ast.Expr{ast.NewIdent("int")}
+		q.lo, q.hi = args[1], args[2]
+		return
+	}
+
+	// ForAll(x, T, y, U, e)
+	if len(args) == 0 || len(args)%2 != 0 {
+		err = fmt.Errorf("%s: (x, T, ..., e) is expected", q.kind)
+		return
+	}
+	for i := 0; i < len(args); i += 2 {
+		var name *ast.Ident
+		if name, err = binderIdent(q.kind, args[i]); err != nil {
+			return
+		}
+		var typ ast.Expr
+		if typ, err = binderType(q.kind, args[i+1]); err != nil {
+			return
+		}
+		q.names = append(q.names, name)
+		q.types = append(q.types, typ)
+	}
+	return
+}
+
+// isPatternCall は呼び出しが Pattern(...) かどうか調べる関数
+func isPatternCall(ce *ast.CallExpr) bool {
+	ident, ok := ce.Fun.(*ast.Ident)
+	return ok && ident.Name == "Pattern"
+}
+
+// binderIdent は束縛変数 (識別子または文字列リテラル) を識別子にする関数
+func binderIdent(kind string, expr ast.Expr) (r *ast.Ident, err error) {
+	switch expr.(type) {
+	case *ast.Ident:
+		r = expr.(*ast.Ident)
+		return
+	case *ast.BasicLit:
+		bl := expr.(*ast.BasicLit)
+		if s, e := strconv.Unquote(bl.Value); e == nil && token.IsIdentifier(s) {
+			r = &ast.Ident{NamePos: bl.ValuePos, Name: s}
+			return
+		}
+	}
+	err = fmt.Errorf("%s: bound variable %s is not an identifier", kind, nodeString(expr))
+	return
+}
+
+// binderType は束縛変数の型 (型の式または文字列リテラル) を型の式にする関数
+func binderType(kind string, expr ast.Expr) (r ast.Expr, err error) {
+	r = expr
+	if bl, ok := expr.(*ast.BasicLit); ok {
+		s, e := strconv.Unquote(bl.Value)
+		if e == nil {
+			r, e = parser.ParseExpr(s)
+		}
+		if e != nil {
+			err = fmt.Errorf("%s: bad type %s", kind, bl.Value)
+		}
+	}
+	return
+}
+
+// isRange は ForAllIn、ExistsIn かどうか調べる関数
+func (q quant) isRange() bool {
+	return q.kind == "ForAllIn" || q.kind == "ExistsIn"
+}
+
+// isForAll は全称限量 (ForAll、ForAllIn) かどうか調べる関数
+func (q quant) isForAll() bool {
+	return q.kind == "ForAll" || q.kind == "ForAllIn"
+}
+
+// binds は name が束縛変数かどうか調べる関数
+func (q quant) binds(name string) bool {
+	for _, x := range q.names {
+		if x.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// call は限量子の式を作成する関数。束縛変数は識別子とする。
+func (q quant) call() (r *ast.CallExpr) {
+	var args []ast.Expr
+	if q.isRange() {
+		args = append(args, q.names[0], q.lo, q.hi)
+	} else {
+		for i, x := range q.names {
+			args = append(args, x, q.types[i])
+		}
+	}
+	for _, p := range q.patterns {
+		args = append(args, &ast.CallExpr{Fun: ast.NewIdent("Pattern"), Args: p})
+	}
+	args = append(args, q.body)
+	r = &ast.CallExpr{Fun: ast.NewIdent(q.kind), Args: args}
+	return
+}
+
+// mapQuant は限量子の範囲 lo、hi を outer で、本体とパターンを inner で書き換えた限量子を作成する関数
+func (q quant) mapQuant(outer, inner func(ast.Expr) (ast.Expr, error)) (r quant, err error) {
+	r = q
+	if q.isRange() {
+		if r.lo, err = outer(q.lo); err != nil {
+			return
+		}
+		if r.hi, err = outer(q.hi); err != nil {
+			return
+		}
+	}
+	r.patterns = nil
+	for _, p := range q.patterns {
+		var terms []ast.Expr
+		for _, t := range p {
+			var x ast.Expr
+			if x, err = inner(t); err != nil {
+				return
+			}
+			terms = append(terms, x)
+		}
+		r.patterns = append(r.patterns, terms)
+	}
+	r.body, err = inner(q.body)
+	return
+}
+
+// convQuant は限量子を SMT LIB Language 仕様のコードに変換する関数。
+// ForAllIn と ExistsIn は範囲の条件をつけた限量にする。
+//
+//	ForAllIn(i, lo, hi, e)  ->  (forall ((i Int)) (=> (and (<= lo i) (< i hi)) e))
+//	ExistsIn(i, lo, hi, e)  ->  (exists ((i Int)) (and (and (<= lo i) (< i hi)) e))
+func convQuant(q quant) (r string) {
+	var guard string
+	if q.isRange() {
+		i := q.names[0].Name
+		guard = fmt.Sprintf("(and (<= %s %s) (< %s %s))", convExpr(q.lo), i, i, convExpr(q.hi))
+	}
+
+	saved := convEnv
+	var binders []string
+	for i, x := range q.names {
+		convEnv = bindVar(convEnv, x.Name, q.types[i])
+		binders = append(binders, fmt.Sprintf("(%s %s)", x.Name, convType(q.types[i])))
+	}
+	body := convExpr(q.body)
+	var patterns []string
+	for _, p := range q.patterns {
+		var terms []string
+		for _, t := range p {
+			terms = append(terms, convExpr(t))
+		}
+		patterns = append(patterns, fmt.Sprintf(":pattern (%s)", strings.Join(terms, " ")))
+	}
+	if len(q.patterns) == 0 && q.isRange() && conf.AutoTriggers {
+		patterns = autoPatterns(q.names[0].Name, q.body)
+	}
+	convEnv = saved
+
+	quantifier := "exists"
+	if q.isForAll() {
+		quantifier = "forall"
+	}
+	switch {
+	case guard != "" && q.isForAll():
+		body = fmt.Sprintf("(=> %s %s)", guard, body)
+	case guard != "":
+		body = fmt.Sprintf("(and %s %s)", guard, body)
+	}
+	if len(patterns) > 0 {
+		body = fmt.Sprintf("(! %s %s)", body, strings.Join(patterns, " "))
+	}
+	r = fmt.Sprintf("(%s (%s) %s)", quantifier, strings.Join(binders, " "), body)
+	return
+}
+
+// autoPatterns は束縛変数 name を添字とする配列の参照 a[name] をパターンにする関数。
+// 設定の auto_triggers が true で Pattern が書かれていない ForAllIn、ExistsIn に使う。
+// 例：(! (=> (and (<= 0 i) (< i n)) (<= (select a i) x)) :pattern ((select a i)))
+// 内側の限量子の中は、内側の束縛変数を含むことがあるので探さない。
+func autoPatterns(name string, expr ast.Expr) (r []string) {
+	seen := map[string]bool{}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n.(type) {
+		case *ast.CallExpr:
+			if ident, ok := n.(*ast.CallExpr).Fun.(*ast.Ident); ok && (isQuantName(ident.Name) || ident.Name == "Let") {
+				return false
+			}
+		case *ast.IndexExpr:
+			ie := n.(*ast.IndexExpr)
+			if index, ok := ie.Index.(*ast.Ident); ok && index.Name == name {
+				p := convExpr(ie)
+				if !seen[p] {
+					seen[p] = true
+					r = append(r, fmt.Sprintf(":pattern (%s)", p))
+				}
+			}
+		}
+		return true
+	})
+	return
+}
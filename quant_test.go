@@ -0,0 +1,173 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"strings"
+	"testing"
+)
+
+// ForAllIn と ExistsIn は範囲の条件をつけた限量子になる
+func TestRangeQuantifiers(t *testing.T) {
+	runVerdictTests(t, []verdictTest{
+		{name: "ForAllIn", src: `
+func f(x, n int) (r int) {
+	PRE("n >= 1 && ForAllIn(i, 0, n, i < x)")
+	r = x
+	POST("r >= n")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "ForAllIn ng", src: `
+func f(x, n int) (r int) {
+	PRE("n >= 1 && ForAllIn(i, 0, n, i < x)")
+	r = x
+	POST("r > n")
+	return
+}
+`, funcs: []string{"f"}, ok: false},
+		{name: "ExistsIn", src: `
+func f(x, n int) (r int) {
+	PRE("ExistsIn(i, 0, n, i == x)")
+	r = x
+	POST("0 <= r && r < n")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "ExistsIn ng", src: `
+func f(x, n int) (r int) {
+	PRE("ExistsIn(i, 0, n, i == x)")
+	r = x
+	POST("r > 0")
+	return
+}
+`, funcs: []string{"f"}, ok: false},
+	})
+}
+
+// convQuantString は変数 vars の環境で限量子の式 src を SMT LIB Language のコードに変換する
+func convQuantString(t *testing.T, vars map[string]string, src string) string {
+	t.Helper()
+	convEnv = map[string]ast.Expr{}
+	for name, typ := range vars {
+		x, err := parser.ParseExpr(typ)
+		if err != nil {
+			t.Fatal(err)
+		}
+		convEnv[name] = x
+	}
+	expr, err := parser.ParseExpr(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return convExpr(expr)
+}
+
+func TestConvRangeQuantifiers(t *testing.T) {
+	vars := map[string]string{"a": "[]int", "n": "int", "x": "int"}
+	tests := []struct {
+		src  string
+		auto bool
+		want string
+	}{
+		{src: "ForAllIn(i, 0, n, i < x)",
+			want: "(forall ((i Int)) (=> (and (<= 0 i) (< i n)) (< i x)))"},
+		{src: "ExistsIn(i, 1, n-1, i == x)",
+			want: "(exists ((i Int)) (and (and (<= 1 i) (< i (- n 1))) (= i x)))"},
+		{src: "ForAllIn(i, 0, n, a[i] <= x)", auto: true,
+			want: "(forall ((i Int)) (! (=> (and (<= 0 i) (< i n)) (<= (select a i) x)) :pattern ((select a i))))"},
+		{src: "ForAllIn(i, 0, n, a[i] <= x)",
+			want: "(forall ((i Int)) (=> (and (<= 0 i) (< i n)) (<= (select a i) x)))"},
+	}
+	defer func() { conf.AutoTriggers = false }()
+	for _, tt := range tests {
+		conf.AutoTriggers = tt.auto
+		if got := convQuantString(t, vars, tt.src); got != tt.want {
+			t.Errorf("%s (auto_triggers %v):\ngot  %s\nwant %s", tt.src, tt.auto, got, tt.want)
+		}
+	}
+}
+
+// 限量子の引数の形が正しくないときはエラーになる
+func TestQuantOfErrors(t *testing.T) {
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{"ForAllIn(i, 0, e)", "ForAllIn: (i, lo, hi, e) is expected"},
+		{"ExistsIn(i+1, 0, n, e)", "ExistsIn: bound variable i + 1 is not an identifier"},
+		{"ForAll(x, e)", "ForAll: too few arguments"},
+	}
+	for _, tt := range tests {
+		expr, err := parser.ParseExpr(tt.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, ok, err := quantOf(expr)
+		if !ok || err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got %v, want %q", tt.src, err, tt.want)
+		}
+	}
+}
+
+// Exists は ForAll と同じ束縛変数の形をとり、複数の変数を束縛できる。束縛変数は置換されない
+func TestExists(t *testing.T) {
+	runVerdictTests(t, []verdictTest{
+		{name: "ident", src: `
+func f(x int) (r int) {
+	PRE("x >= 0")
+	r = x + 1
+	POST("Exists(y, int, r == y + 1 && y >= 0)")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "string", src: "\nfunc f(x int) (r int) {\n\tPRE(\"x >= 0\")\n\tr = x + 1\n" +
+			"\tPOST(`Exists(\"y\", \"int\", r == y + 1)`)\n\treturn\n}\n", funcs: []string{"f"}, ok: true},
+		{name: "bound result", src: `
+func f(x int) (r int) {
+	PRE("true")
+	r = x + 1
+	POST("Exists(r, int, r == x) && r == x + 1")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "two variables", src: `
+func f(x int) (r int) {
+	PRE("x >= 0 && x <= 2")
+	r = x + 1
+	POST("Exists(a, int, b, int, a + b == r && b == 1)")
+	return
+}
+`, funcs: []string{"f"}, ok: true},
+		{name: "two variables ng", src: `
+func f(x int) (r int) {
+	PRE("x >= 0 && x <= 2")
+	r = x + 1
+	POST("ForAll(a, int, b, int, Implies(a + b == r, a == x))")
+	return
+}
+`, funcs: []string{"f"}, ok: false},
+	})
+}
+
+func TestConvPatterns(t *testing.T) {
+	vars := map[string]string{"a": "[]int", "n": "int"}
+	tests := []struct {
+		src  string
+		want string
+	}{
+		{`ForAll(i, int, j, int, Pattern(a[i], a[j]), Implies(i < j, a[i] <= a[j]))`,
+			"(forall ((i Int) (j Int)) (! (=> (< i j) (<= (select a i) (select a j))) :pattern ((select a i) (select a j))))"},
+		{`ForAll(i, int, Pattern(a[i]), Pattern(a[i+1]), a[i] <= a[i+1])`,
+			"(forall ((i Int)) (! (<= (select a i) (select a (+ i 1))) :pattern ((select a i)) :pattern ((select a (+ i 1)))))"},
+		{`Exists("i", "int", a[i] == n)`,
+			"(exists ((i Int)) (= (select a i) n))"},
+		{`ExistsIn(i, 0, n, Pattern(a[i]), a[i] == n)`,
+			"(exists ((i Int)) (! (and (and (<= 0 i) (< i n)) (= (select a i) n)) :pattern ((select a i))))"},
+	}
+	for _, tt := range tests {
+		if got := convQuantString(t, vars, tt.src); got != tt.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.src, got, tt.want)
+		}
+	}
+}
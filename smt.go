@@ -6,19 +6,48 @@ import (
 	"fmt"
 	"go/ast"
 	"go/token"
+	"sort"
 	"strings"
 )
 
-// makeSMTScript は Golang AST の式から SMT LIB Language 仕様のスクリプトを作成する関数
-func makeSMTScript(vars map[string]ast.Expr, cond ast.Expr) (r string) {
+// convEnv は式の変換中に参照する変数名とその型。
+// フィールドの参照のように、式の型によって変換先が変わるときに使う。
+var convEnv map[string]ast.Expr
+
+// convErr は式の変換中に見つかった最初のエラー。表明に書かれた変換できない式は convFail で記録する。
+var convErr error
+
+// convFail は式 expr を変換できないことを convErr に記録する関数。変換結果の代わりに false を返す。
+func convFail(expr ast.Expr, msg string) (r string) {
+	if convErr == nil {
+		convErr = fmt.Errorf("%s: %s", msg, nodeString(expr))
+	}
+	r = "false"
+	return
+}
+
+// makeSMTScript は Golang AST の式から SMT LIB Language 仕様のスクリプトを作成する関数。
+// 変換できない式があるときはエラーを返す。
+func makeSMTScript(vars map[string]ast.Expr, cond ast.Expr) (r string, err error) {
+	// 参照されるパッケージレベルの変数も宣言する。const.go 参照。
+	vars = withGlobals(vars, cond)
+	convEnv = vars
+	convErr = nil
 	var tmp []string
+	if dt := convDatatypes(vars, cond); dt != "" {
+		tmp = append(tmp, dt)
+	}
 	tmp = append(tmp, convVars(vars))
+	if defs := convPureFuncs(cond); defs != "" {
+		tmp = append(tmp, defs)
+	}
 	tmp = append(tmp, fmt.Sprintf("(assert %s)", convExpr(cond)))
 	tmp = append(tmp, "(check-sat)")
 	tmp = append(tmp, "(get-model)")
 	r = strings.Join(tmp, "\n") + "\n"
 	// [MEMO] r の末尾の LF は Z3 での実行では不要かもしれないが、
 	// 他の事例において末尾の LF がないとうまくいかないことがあった。
+	err = convErr
 	return
 }
 
@@ -53,24 +82,165 @@ func convVars(vars map[string]ast.Expr) (r string) {
 	return
 }
 
+// convDatatypes は変数の型や式の中で使われている構造体型とマップ型を、
+// SMT LIB Language 仕様の代数的データ型として宣言するコードを作成する関数。
+// 構造体型 Point は構築子 mk-Point とフィールドごとのアクセサ Point.x をもつデータ型になる。
+// 例：(declare-datatypes ((Point 0)) (((mk-Point (Point.x Int) (Point.y Int)))))
+// マップ型については map.go 参照。
+func convDatatypes(vars map[string]ast.Expr, cond ast.Expr) (r string) {
+	// 使われている構造体型とマップ型をフィールドの型や要素の型までたどって集める
+	seen := map[string]bool{}
+	var names []string
+	maps := map[string]*ast.MapType{}
+	var visit func(node ast.Node)
+	visit = func(node ast.Node) {
+		ast.Inspect(node, func(n ast.Node) bool {
+			if mt, ok := n.(*ast.MapType); ok {
+				name := mapSort(mt)
+				if maps[name] == nil {
+					maps[name] = mt
+					names = append(names, name)
+				}
+				return true
+			}
+			ident, ok := n.(*ast.Ident)
+			if !ok {
+				return true
+			}
+			if mt := mapTypeOf(ident); mt != nil {
+				if maps[mapSort(mt)] == nil {
+					visit(mt)
+				}
+				return true
+			}
+			name, st := structOf(ident)
+			if st == nil || seen[name] {
+				return true
+			}
+			seen[name] = true
+			names = append(names, name)
+			visit(st)
+			return true
+		})
+	}
+	for _, typ := range vars {
+		if typ != nil {
+			visit(typ)
+		}
+	}
+	visit(cond)
+	pfs, lemmas := usedDefs(cond)
+	for _, pf := range pfs {
+		for _, typ := range pf.vars {
+			visit(typ)
+		}
+		visit(pf.result)
+	}
+	for _, def := range lemmas {
+		for _, typ := range def.vars {
+			visit(typ)
+		}
+	}
+	if len(names) == 0 {
+		return
+	}
+	sort.Strings(names)
+
+	// 相互に参照する構造体型もあり得るので、ひとつの declare-datatypes でまとめて宣言する
+	var sorts, ctors []string
+	for _, name := range names {
+		if mt := maps[name]; mt != nil {
+			sorts = append(sorts, fmt.Sprintf("(%s 0)", name))
+			ctors = append(ctors, fmt.Sprintf("(%s)", mapCtor(mt)))
+			continue
+		}
+		_, st := structOf(ast.NewIdent(name))
+		fields, types := structFields(st)
+		ctor := "mk-" + name
+		for i, field := range fields {
+			ctor += fmt.Sprintf(" (%s.%s %s)", name, field, convType(types[i]))
+		}
+		sorts = append(sorts, fmt.Sprintf("(%s 0)", name))
+		ctors = append(ctors, fmt.Sprintf("((%s))", ctor))
+	}
+	r = fmt.Sprintf("(declare-datatypes (%s) (%s))", strings.Join(sorts, " "), strings.Join(ctors, " "))
+	return
+}
+
+// zeroValue は型のゼロ値の SMT LIB Language 仕様のコードを作成する関数
+func zeroValue(typ ast.Expr) (r string) {
+	if name, st := structOf(typ); st != nil {
+		_, types := structFields(st)
+		if len(types) == 0 {
+			r = "mk-" + name
+			return
+		}
+		var vals []string
+		for _, t := range types {
+			vals = append(vals, zeroValue(t))
+		}
+		r = fmt.Sprintf("(mk-%s %s)", name, strings.Join(vals, " "))
+		return
+	}
+	if name := floatTypeName(typ); name != "" {
+		r = floatZero(name)
+		return
+	}
+	if mt := mapTypeOf(typ); mt != nil {
+		r = mapZero(mt)
+		return
+	}
+	switch convType(typ) {
+	case "Int":
+		r = "0"
+	case "Bool":
+		r = "false"
+	case "String":
+		r = `""`
+	default:
+		if at, ok := underlying(typ).(*ast.ArrayType); ok {
+			r = fmt.Sprintf("((as const %s) %s)", convType(typ), zeroValue(at.Elt))
+		} else {
+			r = "unknown"
+		}
+	}
+	return
+}
+
 // convType は型名変換する関数
 func convType(typ ast.Expr) (r string) {
 	switch typ.(type) {
 	case *ast.Ident:
 		ident := typ.(*ast.Ident)
 		switch ident.Name {
-		case "int":
+		case "int", "byte", "rune":
 			r = "Int"
 		case "bool":
 			r = "Bool"
 		case "string":
 			r = "String"
+		case "float64", "float32":
+			r = floatSort(ident.Name)
 		default:
-			r = "unknown"
+			// ファイルで宣言されている構造体型のときはデータ型とする。
+			// それ以外の宣言されている型のときはその定義の型とする。例：type Age int
+			if name, st := structOf(ident); st != nil {
+				r = name
+			} else if def, ok := lookupType(ident.Name); ok {
+				r = convType(def)
+			} else {
+				r = "unknown"
+			}
 		}
 	case *ast.ArrayType:
 		at := typ.(*ast.ArrayType)
 		r = fmt.Sprintf("(Array Int %s)", convType(at.Elt))
+	case *ast.MapType:
+		// マップはデータ型。map.go 参照。
+		r = mapSort(typ.(*ast.MapType))
+	case *ast.StarExpr:
+		// ポインタは位置を表す整数。heap.go 参照。
+		r = "Int"
 	default:
 		r = "unknown"
 	}
@@ -112,47 +282,182 @@ func convOp(op token.Token) (r string) {
 	return
 }
 
+// flattenOp は演算子 op の二項演算の連鎖を平坦にしたオペランドのリストを返す関数。
+// 例：(a && b) && (c && d) => [a, b, c, d]
+func flattenOp(expr ast.Expr, op token.Token) (r []ast.Expr) {
+	switch expr.(type) {
+	case *ast.BinaryExpr:
+		be := expr.(*ast.BinaryExpr)
+		if be.Op == op {
+			r = append(flattenOp(be.X, op), flattenOp(be.Y, op)...)
+			return
+		}
+	case *ast.ParenExpr:
+		pe := expr.(*ast.ParenExpr)
+		r = flattenOp(pe.X, op)
+		return
+	}
+	r = []ast.Expr{expr}
+	return
+}
+
+// convExprWith は束縛変数 name を型 typ とみなして式 expr を変換する関数
+func convExprWith(name string, typ ast.Expr, expr ast.Expr) (r string) {
+	saved := convEnv
+	convEnv = bindVar(convEnv, name, typ)
+	r = convExpr(expr)
+	convEnv = saved
+	return
+}
+
+// isPkgFuncCall は呼び出しが SMT の式に変換できる strings、math パッケージの関数の呼び出しかどうか調べる関数。
+// str.go、float.go 参照。
+func isPkgFuncCall(ce *ast.CallExpr) bool {
+	if _, ok := isStringsCall(ce); ok {
+		return true
+	}
+	_, ok := isMathCall(ce)
+	return ok
+}
+
 // convExpr は Golang の式の AST を SMT LIB Language 仕様の式のコードに変換する関数
 func convExpr(expr ast.Expr) (r string) {
 	switch expr.(type) {
 	case *ast.BasicLit:
-		bl := expr.(*ast.BasicLit)
-		r = bl.Value
+		// 整数、浮動小数点数、文字、文字列のリテラル。lit.go 参照。
+		r = convBasicLit(expr.(*ast.BasicLit))
 	case *ast.Ident:
 		ident := expr.(*ast.Ident)
 		r = ident.Name
+		if c, ok := lookupConst(convEnv, ident.Name); ok {
+			// パッケージレベルの定数はその値にする。const.go 参照。
+			r = convConst(c)
+		}
 	case *ast.CallExpr:
 		ce := expr.(*ast.CallExpr)
+		if name, ok := isStringsCall(ce); ok {
+			// strings.Contains(s, t) など。str.go 参照。
+			r = convStringsCall(name, ce)
+			break
+		}
+		if name, ok := isMathCall(ce); ok {
+			// math.IsNaN(x) など。float.go 参照。
+			r = convMathCall(name, ce)
+			break
+		}
 		ident := ce.Fun.(*ast.Ident)
 		switch ident.Name {
 		case "Implies":
 			r = fmt.Sprintf("(=> %s %s)", convExpr(ce.Args[0]), convExpr(ce.Args[1]))
-		case "ForAll":
+		case "ForAll", "Exists", "ForAllIn", "ExistsIn":
+			// 限量子。quant.go 参照。
+			q, _, err := quantOf(ce)
+			if err != nil {
+				printNode(expr)
+				panic(err)
+			}
+			r = convQuant(q)
+		case "Let":
+			// (let ((x e)) body)
 			nam := ce.Args[0].(*ast.Ident)
-			//typ := ce.Args[1].(*ast.Ident)
-			r = fmt.Sprintf("(forall ((%s %s)) %s)", nam.Name, convType(ce.Args[1]), convExpr(ce.Args[2]))
-		case "Exists":
-			nam := ce.Args[0].(*ast.BasicLit)
-			//typ := ce.Args[1].(*ast.BasicLit)
-			r = fmt.Sprintf("(exists ((%s %s)) %s)", nam.Value[1:len(nam.Value)-1], convType(ce.Args[1]), convExpr(ce.Args[2]))
+			body := convExprWith(nam.Name, typeOf(convEnv, ce.Args[1]), ce.Args[2])
+			r = fmt.Sprintf("(let ((%s %s)) %s)", nam.Name, convExpr(ce.Args[1]), body)
 		case "Select":
+			if mt := mapTypeOf(typeOf(convEnv, ce.Args[0])); mt != nil {
+				// マップの参照 m[k]。map.go 参照。
+				r = convMapCall(mt, ident.Name, ce.Args[0], ce.Args[1])
+				break
+			}
 			// (select 配列 インデクス) v[i]
-			panic("select is not implemented yet")
+			r = fmt.Sprintf("(select %s %s)", convExpr(ce.Args[0]), convExpr(ce.Args[1]))
 		case "Store":
+			if mt := mapTypeOf(typeOf(convEnv, ce.Args[0])); mt != nil {
+				// マップの更新 m[k] = v。map.go 参照。
+				r = convMapCall(mt, ident.Name, ce.Args[0], ce.Args[1], ce.Args[2])
+				break
+			}
 			// (store  配列 インデクス 式) v(i := e)
-			panic("store is not implemented yet")
+			r = fmt.Sprintf("(store %s %s %s)", convExpr(ce.Args[0]), convExpr(ce.Args[1]), convExpr(ce.Args[2]))
+		case "int", "byte", "rune", "float64", "float32":
+			// 数値の型の変換。整数どうしの int(s[i]) はそのままで、Int の範囲の丸めはしない。float.go 参照。
+			r = convConversion(ident.Name, ce.Args[0])
+		case "Identical":
+			// 同じ値であること。浮動小数点数の NaN どうしも同じとする。
+			r = fmt.Sprintf("(= %s %s)", convExpr(ce.Args[0]), convExpr(ce.Args[1]))
+		case "HasKey", "Delete":
+			// マップのキーの有無と削除。map.go 参照。
+			mt := mapTypeOf(typeOf(convEnv, ce.Args[0]))
+			if mt == nil {
+				r = convFail(expr, ident.Name+" of non-map")
+				break
+			}
+			r = convMapCall(mt, ident.Name, ce.Args[0], ce.Args[1])
+		case "make":
+			// 空のマップ、ゼロ値の配列
+			r = zeroValue(ce.Args[0])
+		case "len":
+			if mt := mapTypeOf(typeOf(convEnv, ce.Args[0])); mt != nil {
+				// マップの要素数
+				r = convMapCall(mt, ident.Name, ce.Args[0])
+				break
+			}
+			// 文字列の長さ (str.len s)
+			if len(ce.Args) != 1 || !isStringExpr(convEnv, ce.Args[0]) {
+				r = convFail(expr, "len of non-string")
+				break
+			}
+			r = fmt.Sprintf("(str.len %s)", convExpr(ce.Args[0]))
 		default:
-			printNode(expr)
-			panic("unknown expr")
+			if !isPureName(ident.Name) {
+				printNode(expr)
+				panic("unknown expr")
+			}
+			// 純粋関数の適用 (f a b)。pure.go 参照。
+			if len(ce.Args) == 0 {
+				r = ident.Name
+				break
+			}
+			var args []string
+			for _, arg := range ce.Args {
+				args = append(args, convExpr(arg))
+			}
+			r = fmt.Sprintf("(%s %s)", ident.Name, strings.Join(args, " "))
 		}
 	case *ast.BinaryExpr:
 		be := expr.(*ast.BinaryExpr)
+		if be.Op == token.LAND || be.Op == token.LOR {
+			// a && b && c は入れ子にせずに (and a b c) とする
+			var args []string
+			for _, x := range flattenOp(be, be.Op) {
+				args = append(args, convExpr(x))
+			}
+			r = fmt.Sprintf("(%s %s)", convOp(be.Op), strings.Join(args, " "))
+			return
+		}
+		if be.Op == token.ADD && isStringExpr(convEnv, be) {
+			// 文字列の連結 s + t + u は (str.++ s t u)
+			var args []string
+			for _, x := range flattenOp(be, be.Op) {
+				args = append(args, convExpr(x))
+			}
+			r = fmt.Sprintf("(str.++ %s)", strings.Join(args, " "))
+			return
+		}
+		if name := floatOperandType(convEnv, be); name != "" {
+			// 浮動小数点数の演算。float.go 参照。
+			r = convFloatBinary(be, name)
+			return
+		}
 		r = fmt.Sprintf("(%s %s %s)", convOp(be.Op), convExpr(be.X), convExpr(be.Y))
 		if be.Op == token.NEQ {
 			r = fmt.Sprintf("(not %s)", r)
 		}
 	case *ast.UnaryExpr:
 		ue := expr.(*ast.UnaryExpr)
+		if name := floatTypeName(typeOf(convEnv, ue.X)); name != "" && ue.Op == token.SUB {
+			r = convFloatNeg(convFloatOperand(ue.X, name))
+			break
+		}
 		r = fmt.Sprintf("(%s %s)", convOp(ue.Op), convExpr(ue.X))
 	case *ast.ParenExpr:
 		pe := expr.(*ast.ParenExpr)
@@ -160,6 +465,59 @@ func convExpr(expr ast.Expr) (r string) {
 		// [MEMO] 括弧をむいて中身を出す感じ。
 		// 下のようにすると余計な括弧のせいで Z3 はエラーになる。
 		// r = fmt.Sprintf("(%s)", convExpr(pe.X))
+	case *ast.IndexExpr:
+		// 配列の要素 a[i] は (select a i)。文字列のバイト s[i] は (str.to_code (str.at s i))。
+		// マップの値 m[k] は map.go 参照。
+		ie := expr.(*ast.IndexExpr)
+		if mt := mapTypeOf(typeOf(convEnv, ie.X)); mt != nil {
+			r = convMapCall(mt, "Select", ie.X, ie.Index)
+			break
+		}
+		if isStringExpr(convEnv, ie.X) {
+			r = fmt.Sprintf("(str.to_code (str.at %s %s))", convExpr(ie.X), convExpr(ie.Index))
+			break
+		}
+		r = fmt.Sprintf("(select %s %s)", convExpr(ie.X), convExpr(ie.Index))
+	case *ast.SelectorExpr:
+		// 構造体のフィールド p.x は (Point.x p)
+		se := expr.(*ast.SelectorExpr)
+		name, st := structOf(typeOf(convEnv, se.X))
+		if st == nil {
+			r = convFail(expr, "field of non-struct")
+			break
+		}
+		r = fmt.Sprintf("(%s.%s %s)", name, se.Sel.Name, convExpr(se.X))
+	case *ast.CompositeLit:
+		// 構造体の値 Point{x: 1} は (mk-Point 1 0)。省略されたフィールドはゼロ値とする。
+		cl := expr.(*ast.CompositeLit)
+		name, st := structOf(cl.Type)
+		if st == nil {
+			r = convFail(expr, "composite literal of non-struct")
+			break
+		}
+		fields, types := structFields(st)
+		if len(fields) == 0 {
+			r = "mk-" + name
+			break
+		}
+		vals := make([]string, len(fields))
+		for i, t := range types {
+			vals[i] = zeroValue(t)
+		}
+		for i, elt := range cl.Elts {
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if !ok {
+				vals[i] = convExpr(elt)
+				continue
+			}
+			key := kv.Key.(*ast.Ident).Name
+			for j, field := range fields {
+				if field == key {
+					vals[j] = convExpr(kv.Value)
+				}
+			}
+		}
+		r = fmt.Sprintf("(mk-%s %s)", name, strings.Join(vals, " "))
 	default:
 		// subst でチェックしているので上記以外のケースはないはずだが、念のため。
 		printNode(expr)
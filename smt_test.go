@@ -0,0 +1,123 @@
+package main
+
+import (
+	"go/ast"
+	"go/parser"
+	"strings"
+	"testing"
+)
+
+// 表明に書かれた SMT の式に変換できない式はエラーにする
+func TestConvErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		post string
+		want string
+	}{
+		{
+			name: "composite literal of non-struct",
+			post: "q.p == struct{ x, y int }{1, 2}",
+			want: "composite literal of non-struct",
+		},
+		{
+			name: "len of slice",
+			post: "len(s) >= 0",
+			want: "len of non-string",
+		},
+		{
+			name: "field of non-struct",
+			post: "a.x == 1",
+			want: "field of non-struct",
+		},
+	}
+	for _, tt := range tests {
+		src := `package main
+
+type Point struct{ x, y int }
+
+type Q struct{ p Point }
+
+func f(m map[int]int, s []int, q Q, a struct{ x int }) (r int) {
+	PRE("true")
+	r = 0
+	POST("` + tt.post + `")
+	return
+}
+`
+		for _, vcgen := range vcgens {
+			t.Run(tt.name+"/"+vcgen, func(t *testing.T) {
+				err := verifyFuncs(t, vcgen, src, "f")
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("want error %q, got %v", tt.want, err)
+				}
+			})
+		}
+	}
+}
+
+// 型検査を通らない式の変換もパニックせずにエラーにする
+func TestMakeSMTScriptErrors(t *testing.T) {
+	tests := []struct {
+		cond string
+		want string
+	}{
+		{"HasKey(s, 1)", "HasKey of non-map"},
+		{"Delete(s, 1) == s", "Delete of non-map"},
+		{"len(s) == n", "len of non-string"},
+		{"len(n) == 0", "len of non-string"},
+	}
+	vars := map[string]ast.Expr{
+		"s": &ast.ArrayType{Elt: ast.NewIdent("int")},
+		"n": ast.NewIdent("int"),
+	}
+	for _, tt := range tests {
+		cond, err := parser.ParseExpr(tt.cond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = makeSMTScript(vars, cond)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: want error %q, got %v", tt.cond, tt.want, err)
+		}
+	}
+}
+
+// expectSMT は src の関数 names の最後の関数の SMT LIB Language のスクリプトを作成方法 vcgens のそれぞれで作成し、
+// どれかのスクリプトに wants のそれぞれが含まれることを調べる。smtScripts 参照。
+func expectSMT(t *testing.T, src string, names []string, wants ...string) {
+	t.Helper()
+	for _, vcgen := range vcgens {
+		scripts := strings.Join(smtScripts(t, vcgen, src, names...), "\n")
+		for _, want := range wants {
+			if !strings.Contains(scripts, want) {
+				t.Errorf("%s: %s: %q is not in\n%s", vcgen, names[len(names)-1], want, scripts)
+			}
+		}
+	}
+}
+
+// 構造体型は代数的データ型になり、フィールドの参照と更新、構造体の値はその構築子とアクセサになる
+func TestStructSMT(t *testing.T) {
+	src := `package main
+
+type Point struct{ x, y int }
+
+type Line struct{ a, b Point }
+
+func move(p Point, l Line, d int) (q Point) {
+	PRE("l.a.y >= 0")
+	q = p
+	q.x = q.x + d
+	POST("q.x == p.x + d && q.y == p.y && q != Point{x: 1}")
+	return
+}
+`
+	expectSMT(t, src, []string{"move"},
+		"(declare-datatypes ((Line 0) (Point 0)) (((mk-Line (Line.a Point) (Line.b Point))) ((mk-Point (Point.x Int) (Point.y Int)))))",
+		"(declare-const p Point)",
+		"(Point.y (Line.a l))",
+		"(Point.x p)",
+		"(mk-Point 1 0)",
+		"(mk-Point (+ (Point.x ",
+	)
+}
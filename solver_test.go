@@ -0,0 +1,670 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// テストでは z3 のかわりに、テストの実行ファイル自身を SMT ソルバとして起動する。
+// このソルバは Int と Bool の定数だけの SMT LIB Language のスクリプトについて、
+// 各定数の値を小さな範囲 (solverMin..solverMax) で列挙して充足するかを調べる。
+// 範囲の外にしか反例がない条件は unsat と答えるので、テストの関数は範囲の中に反例があるように書く。
+// 配列、文字列、浮動小数点数などのソートや未対応の関数を含むスクリプトには unknown と答える。
+
+const (
+	solverEnv  = "HL_TEST_SOLVER"
+	solverMin  = -2
+	solverMax  = 3
+	solverMaxN = 2000000 // 列挙する値の組の数の上限
+)
+
+func TestMain(m *testing.M) {
+	if os.Getenv(solverEnv) == "1" {
+		os.Exit(runTestSolver())
+	}
+	os.Exit(m.Run())
+}
+
+// runTestSolver は標準入力のスクリプトを調べて結果を標準出力に書く
+func runTestSolver() int {
+	src, err := ioutil.ReadAll(bufio.NewReader(os.Stdin))
+	if err != nil {
+		fmt.Println("unknown")
+		return 0
+	}
+	result, model := solveScript(string(src))
+	fmt.Println(result)
+	fmt.Println(model)
+	return 0
+}
+
+// sexp は S 式。アトムのときは atom、リストのときは list をもつ。
+type sexp struct {
+	atom   string
+	list   []*sexp
+	isList bool
+}
+
+func (s *sexp) String() string {
+	if !s.isList {
+		return s.atom
+	}
+	var xs []string
+	for _, x := range s.list {
+		xs = append(xs, x.String())
+	}
+	return "(" + strings.Join(xs, " ") + ")"
+}
+
+// parseSexps はスクリプトを S 式のリストにする
+func parseSexps(src string) (r []*sexp, err error) {
+	var toks []string
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ';':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(' || c == ')':
+			toks = append(toks, string(c))
+			i++
+		case c == '|':
+			j := strings.IndexByte(src[i+1:], '|')
+			if j < 0 {
+				return nil, fmt.Errorf("unterminated |")
+			}
+			toks = append(toks, src[i:i+j+2])
+			i += j + 2
+		case c == '"':
+			j := i + 1
+			for j < len(src) {
+				if src[j] == '"' {
+					if j+1 < len(src) && src[j+1] == '"' {
+						j += 2
+						continue
+					}
+					break
+				}
+				j++
+			}
+			toks = append(toks, src[i:j+1])
+			i = j + 1
+		default:
+			j := i
+			for j < len(src) && !strings.ContainsRune(" \t\r\n()", rune(src[j])) {
+				j++
+			}
+			toks = append(toks, src[i:j])
+			i = j
+		}
+	}
+	var stack [][]*sexp
+	var cur []*sexp
+	for _, t := range toks {
+		switch t {
+		case "(":
+			stack = append(stack, cur)
+			cur = nil
+		case ")":
+			if len(stack) == 0 {
+				return nil, fmt.Errorf("unbalanced )")
+			}
+			l := &sexp{list: cur, isList: true}
+			cur = append(stack[len(stack)-1], l)
+			stack = stack[:len(stack)-1]
+		default:
+			cur = append(cur, &sexp{atom: t})
+		}
+	}
+	if len(stack) != 0 {
+		return nil, fmt.Errorf("unbalanced (")
+	}
+	r = cur
+	return
+}
+
+// errUnknown はソルバが扱えないスクリプトのときのパニックの値
+type errUnknown string
+
+// solverFunc は define-fun で定義された関数
+type solverFunc struct {
+	params []string
+	body   *sexp
+}
+
+// solver は列挙による充足判定の状態
+type solver struct {
+	consts  []string
+	sorts   map[string]string
+	funcs   map[string]solverFunc
+	asserts []*sexp
+	depth   int
+}
+
+// solveScript はスクリプトを列挙で調べて sat、unsat または unknown を返す
+func solveScript(src string) (result, model string) {
+	result, model = "unknown", "()"
+	exprs, err := parseSexps(src)
+	if err != nil {
+		return
+	}
+	s := &solver{sorts: map[string]string{}, funcs: map[string]solverFunc{}}
+	for _, e := range exprs {
+		if !e.isList || len(e.list) == 0 {
+			continue
+		}
+		switch e.list[0].atom {
+		case "declare-const":
+			sort := e.list[2].String()
+			if sort != "Int" && sort != "Bool" {
+				return
+			}
+			s.consts = append(s.consts, e.list[1].atom)
+			s.sorts[e.list[1].atom] = sort
+		case "define-fun", "define-fun-rec":
+			var params []string
+			for _, p := range e.list[2].list {
+				sort := p.list[1].String()
+				if sort != "Int" && sort != "Bool" {
+					return
+				}
+				params = append(params, p.list[0].atom)
+			}
+			s.funcs[e.list[1].atom] = solverFunc{params: params, body: e.list[4]}
+		case "define-funs-rec":
+			for i, decl := range e.list[1].list {
+				var params []string
+				for _, p := range decl.list[1].list {
+					sort := p.list[1].String()
+					if sort != "Int" && sort != "Bool" {
+						return
+					}
+					params = append(params, p.list[0].atom)
+				}
+				s.funcs[decl.list[0].atom] = solverFunc{params: params, body: e.list[2].list[i]}
+			}
+		case "assert":
+			s.asserts = append(s.asserts, e.list[1])
+		case "check-sat", "get-model", "set-option", "set-logic":
+		default:
+			// declare-datatypes、declare-fun など
+			return
+		}
+	}
+	n := 1
+	for range s.consts {
+		n *= solverMax - solverMin + 1
+		if n > solverMaxN {
+			return
+		}
+	}
+	ok, found, env := s.search()
+	if !ok {
+		return
+	}
+	if !found {
+		result = "unsat"
+		return
+	}
+	result = "sat"
+	var defs []string
+	for _, c := range s.consts {
+		defs = append(defs, fmt.Sprintf("(define-fun %s () %s %v)", c, s.sorts[c], env[c]))
+	}
+	model = "(" + strings.Join(defs, " ") + ")"
+	return
+}
+
+// search は定数の値の組を列挙して、すべての assert を満たす組を探す
+func (s *solver) search() (ok, found bool, env map[string]interface{}) {
+	defer func() {
+		if e := recover(); e != nil {
+			if _, isUnknown := e.(errUnknown); !isUnknown {
+				panic(e)
+			}
+			ok = false
+		}
+	}()
+	ok = true
+	env = map[string]interface{}{}
+	var rec func(i int) bool
+	rec = func(i int) bool {
+		if i == len(s.consts) {
+			for _, a := range s.asserts {
+				if !s.eval(a, env).(bool) {
+					return false
+				}
+			}
+			return true
+		}
+		c := s.consts[i]
+		for _, v := range s.domain(s.sorts[c]) {
+			env[c] = v
+			if rec(i + 1) {
+				return true
+			}
+		}
+		return false
+	}
+	found = rec(0)
+	return
+}
+
+// domain はソートの値の列挙の範囲
+func (s *solver) domain(sort string) (r []interface{}) {
+	switch sort {
+	case "Bool":
+		r = []interface{}{false, true}
+	case "Int":
+		for v := int64(solverMin); v <= solverMax; v++ {
+			r = append(r, v)
+		}
+	default:
+		panic(errUnknown(sort))
+	}
+	return
+}
+
+// bind は env に名前と値を加えた環境を作る
+func bindEnv(env map[string]interface{}, names []string, vals []interface{}) (r map[string]interface{}) {
+	r = map[string]interface{}{}
+	for k, v := range env {
+		r[k] = v
+	}
+	for i, name := range names {
+		r[name] = vals[i]
+	}
+	return
+}
+
+// eval は式の値を求める
+func (s *solver) eval(e *sexp, env map[string]interface{}) interface{} {
+	if !e.isList {
+		switch {
+		case e.atom == "true":
+			return true
+		case e.atom == "false":
+			return false
+		}
+		if v, ok := env[e.atom]; ok {
+			return v
+		}
+		if n, err := strconv.ParseInt(e.atom, 10, 64); err == nil {
+			return n
+		}
+		if f, ok := s.funcs[e.atom]; ok && len(f.params) == 0 {
+			return s.eval(f.body, env)
+		}
+		panic(errUnknown(e.atom))
+	}
+	head := e.list[0]
+	args := e.list[1:]
+	if head.isList {
+		panic(errUnknown(e.String()))
+	}
+	switch head.atom {
+	case "let":
+		var names []string
+		var vals []interface{}
+		for _, b := range args[0].list {
+			names = append(names, b.list[0].atom)
+			vals = append(vals, s.eval(b.list[1], env))
+		}
+		return s.eval(args[1], bindEnv(env, names, vals))
+	case "forall", "exists":
+		var names, sorts []string
+		for _, b := range args[0].list {
+			names = append(names, b.list[0].atom)
+			sorts = append(sorts, b.list[1].String())
+		}
+		want := head.atom == "exists"
+		vals := make([]interface{}, len(names))
+		var rec func(i int) bool
+		rec = func(i int) bool {
+			if i == len(names) {
+				return s.eval(args[1], bindEnv(env, names, vals)).(bool) == want
+			}
+			for _, v := range s.domain(sorts[i]) {
+				vals[i] = v
+				if rec(i + 1) {
+					return true
+				}
+			}
+			return false
+		}
+		return rec(0) == want
+	case "!":
+		return s.eval(args[0], env)
+	case "and":
+		for _, a := range args {
+			if !s.eval(a, env).(bool) {
+				return false
+			}
+		}
+		return true
+	case "or":
+		for _, a := range args {
+			if s.eval(a, env).(bool) {
+				return true
+			}
+		}
+		return false
+	case "=>":
+		return !s.eval(args[0], env).(bool) || s.eval(args[1], env).(bool)
+	case "not":
+		return !s.eval(args[0], env).(bool)
+	case "ite":
+		if s.eval(args[0], env).(bool) {
+			return s.eval(args[1], env)
+		}
+		return s.eval(args[2], env)
+	case "=":
+		x := s.eval(args[0], env)
+		for _, a := range args[1:] {
+			if s.eval(a, env) != x {
+				return false
+			}
+		}
+		return true
+	case "distinct":
+		return s.eval(args[0], env) != s.eval(args[1], env)
+	}
+	var vals []interface{}
+	for _, a := range args {
+		vals = append(vals, s.eval(a, env))
+	}
+	if f, ok := s.funcs[head.atom]; ok {
+		s.depth++
+		defer func() { s.depth-- }()
+		if s.depth > 50 {
+			panic(errUnknown("recursion"))
+		}
+		return s.eval(f.body, bindEnv(env, f.params, vals))
+	}
+	ints := make([]int64, len(vals))
+	for i, v := range vals {
+		n, ok := v.(int64)
+		if !ok {
+			panic(errUnknown(e.String()))
+		}
+		ints[i] = n
+	}
+	switch head.atom {
+	case "+":
+		var r int64
+		for _, n := range ints {
+			r += n
+		}
+		return r
+	case "-":
+		if len(ints) == 1 {
+			return -ints[0]
+		}
+		r := ints[0]
+		for _, n := range ints[1:] {
+			r -= n
+		}
+		return r
+	case "*":
+		r := int64(1)
+		for _, n := range ints {
+			r *= n
+		}
+		return r
+	case "div", "mod":
+		if ints[1] == 0 {
+			panic(errUnknown("division by zero"))
+		}
+		q := ints[0] / ints[1]
+		if ints[0]%ints[1] < 0 {
+			// SMT の div は剰余が 0 以上になる商
+			if ints[1] > 0 {
+				q--
+			} else {
+				q++
+			}
+		}
+		if head.atom == "div" {
+			return q
+		}
+		return ints[0] - q*ints[1]
+	case "abs":
+		if ints[0] < 0 {
+			return -ints[0]
+		}
+		return ints[0]
+	case "<":
+		return ints[0] < ints[1]
+	case "<=":
+		return ints[0] <= ints[1]
+	case ">":
+		return ints[0] > ints[1]
+	case ">=":
+		return ints[0] >= ints[1]
+	}
+	panic(errUnknown(head.atom))
+}
+
+// setupSrc は Golang のソース src を一時ファイルに書き出し、run と同じ順に読み込んで
+// 検証の準備をする。設定はテスト用のソルバを使う既定のものとする。
+func setupSrc(t *testing.T, src string) (fileNode *ast.File) {
+	t.Helper()
+	dir := t.TempDir()
+	srcFile = filepath.Join(dir, "src.go")
+	if err := ioutil.WriteFile(srcFile, []byte(src), 0644); err != nil {
+		t.Fatal(err)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv(solverEnv, "1")
+	conf = Config{
+		Cmd:         []string{exe},
+		TimeOutSec:  30,
+		IgnoreFuncs: []string{"Print", "Println", "Printf"},
+		VCGen:       defaultVCGen,
+		Float:       defaultFloat,
+	}
+	floatMode = conf.Float
+	funcTab = nil
+	invEdits = nil
+
+	fset = token.NewFileSet()
+	fileNode, err = parser.ParseFile(fset, srcFile, nil, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	loadTypeDecls(fileNode)
+	if err = loadPureFuncs(fileNode); err != nil {
+		t.Fatal(err)
+	}
+	if err = loadTypes(fileNode); err != nil {
+		t.Fatal(err)
+	}
+	loadPkgDecls()
+	if err = checkSpecDefs(); err != nil {
+		t.Fatal(err)
+	}
+	if err = proveLemmas(); err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+// specStubs は表明文の宣言。テストのソースの末尾に加える。
+const specStubs = `
+func PRE(s string)       {}
+func POST(s string)      {}
+func INV(s string)       {}
+func ASSERT(s string)    {}
+func ASSUME(s string)    {}
+func MODIFIES(s string)  {}
+func DECREASES(s string) {}
+func REACHABLE(s string) {}
+`
+
+// verifyFuncs は src の関数 names を vcgen の方法で順に検証し、最後の関数の検証のエラーを返す。
+// 検証できなかった (反例がある) ときのエラーは "counter-example" を含む。
+// それより前の関数は検証できなければならない。
+func verifyFuncs(t *testing.T, vcgen, src string, names ...string) (err error) {
+	t.Helper()
+	fileNode := setupSrc(t, src+specStubs)
+	conf.VCGen = vcgen
+	for i, name := range names {
+		err = processFunc(fileNode, name)
+		if err != nil && i < len(names)-1 {
+			t.Fatalf("%s: %s: %v", vcgen, name, err)
+		}
+	}
+	return
+}
+
+// vcgens は検証条件の作成方法のリスト
+var vcgens = []string{"wp", "passive", "symexec"}
+
+// expectVerdict は src の関数 names をすべての作成方法で検証し、
+// 最後の関数が検証できるか (ok が true) 反例があるか (ok が false) を調べる。
+func expectVerdict(t *testing.T, src string, ok bool, names ...string) {
+	t.Helper()
+	expectVerdictWith(t, vcgens, src, ok, names...)
+}
+
+// expectVerdictWith は作成方法 methods のそれぞれで expectVerdict と同じことを調べる
+func expectVerdictWith(t *testing.T, methods []string, src string, ok bool, names ...string) {
+	t.Helper()
+	for _, vcgen := range methods {
+		err := verifyFuncs(t, vcgen, src, names...)
+		name := names[len(names)-1]
+		switch {
+		case ok && err != nil:
+			t.Errorf("%s: %s: want verified, got %v", vcgen, name, err)
+		case !ok && err == nil:
+			t.Errorf("%s: %s: want counter-example, got verified", vcgen, name)
+		case !ok && !strings.Contains(err.Error(), "counter-example"):
+			t.Errorf("%s: %s: want counter-example, got %v", vcgen, name, err)
+		}
+	}
+}
+
+// verdictTest は検証結果を調べるテストの事例
+type verdictTest struct {
+	name  string
+	src   string   // package 節を除いたソース
+	funcs []string // 順に検証する関数。最後の関数の結果を調べる
+	ok    bool     // 検証できるとき true、反例があるとき false
+}
+
+// runVerdictTests は事例 tests のそれぞれを expectVerdict で調べる
+func runVerdictTests(t *testing.T, tests []verdictTest) {
+	t.Helper()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectVerdict(t, "package main\n"+tt.src, tt.ok, tt.funcs...)
+		})
+	}
+}
+
+// condStrings は src の関数 name の検証条件を vcgen の方法で作成し、文字列のリストにする
+func condStrings(t *testing.T, vcgen, src, name string) (r []string) {
+	t.Helper()
+	fileNode := setupSrc(t, src+specStubs)
+	conf.VCGen = vcgen
+	funcDecl := pickupFuncDecl(fileNode, name)
+	if funcDecl == nil {
+		t.Fatalf("no function %s", name)
+	}
+	data, err := getFuncSpec(funcDecl, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFuncData(name, data)
+	conds, _, err := getCondTobeVerified(funcDecl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range conds {
+		r = append(r, nodeString(c))
+	}
+	return
+}
+
+// smtScripts は src の関数 names の最後の関数の検証条件の SMT LIB Language のスクリプトを作成する。
+// それより前の関数は、検証せずに仕様だけを登録する。
+func smtScripts(t *testing.T, vcgen, src string, names ...string) (r []string) {
+	t.Helper()
+	fileNode := setupSrc(t, src+specStubs)
+	conf.VCGen = vcgen
+	name := names[len(names)-1]
+	for _, callee := range names[:len(names)-1] {
+		funcDecl := pickupFuncDecl(fileNode, callee)
+		if funcDecl == nil {
+			t.Fatalf("no function %s", callee)
+		}
+		data, err := getFuncSpec(funcDecl, callee)
+		if err != nil {
+			t.Fatal(err)
+		}
+		setFuncData(callee, data)
+	}
+	funcDecl := pickupFuncDecl(fileNode, name)
+	if funcDecl == nil {
+		t.Fatalf("no function %s", name)
+	}
+	if err := checkSpecs(funcDecl); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	if floatMode, err = funcFloatMode(funcDecl); err != nil {
+		t.Fatal(err)
+	}
+	data, err := getFuncSpec(funcDecl, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	setFuncData(name, data)
+	conds, vars, err := getCondTobeVerified(funcDecl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range conds {
+		script, err := makeSMTScript(vars, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r = append(r, script)
+	}
+	return
+}
+
+func TestSolveScript(t *testing.T) {
+	tests := []struct {
+		script string
+		want   string
+	}{
+		{"(declare-const x Int)\n(assert (and (> x 0) (< x 2)))", "sat"},
+		{"(declare-const x Int)\n(assert (and (> x 0) (< x 0)))", "unsat"},
+		{"(declare-const x Int)\n(assert (let ((y (+ x 1))) (= y 0)))", "sat"},
+		{"(declare-const x Int)\n(assert (not (=> (> x 0) (>= x 1))))", "unsat"},
+		{"(declare-const x Int)\n(assert (= (mod x 2) (- 1)))", "unsat"},
+		{"(assert (forall ((i Int)) (> i 0)))", "unsat"},
+		{"(declare-const s String)\n(assert true)", "unknown"},
+	}
+	for _, tt := range tests {
+		if got, _ := solveScript(tt.script); got != tt.want {
+			t.Errorf("%q: got %s, want %s", tt.script, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,160 @@
+// str.go
+// 文字列の式。SMT の文字列理論 (String) への変換
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// Golang の文字列は SMT の String とし、次のように変換する。
+//
+//	s + t                   -> (str.++ s t)
+//	len(s)                  -> (str.len s)
+//	s[i]                    -> (str.to_code (str.at s i))
+//	strings.Contains(s, t)  -> (str.contains s t)
+//	strings.HasPrefix(s, t) -> (str.prefixof t s)
+//	strings.HasSuffix(s, t) -> (str.suffixof t s)
+//	strings.Index(s, t)     -> (str.indexof s t 0)
+//
+// SMT の String は文字 (Unicode の符号位置) の列なので、長さと添字が Golang のバイトと一致するのは
+// ASCII の範囲の文字列に限る。s[i] (byte) と文字リテラル 'a' (rune) は Int とし、
+// int(s[i]-'0') のような整数の型の変換はそのままの値とする。
+//
+// str.at は範囲外の添字で空文字列になり s[i] は -1 になるので、コードの中の s[i] では
+// 0 <= i && i < len(s) を証明すべき条件とする (indexChecks)。
+
+// stringsFunc は strings パッケージの関数の変換先
+type stringsFunc struct {
+	format string // SMT の式の書式。%[1]s、%[2]s が引数
+	result string // 結果の型
+}
+
+// stringsFuncs は SMT の文字列理論の関数に変換できる strings パッケージの関数の表
+var stringsFuncs = map[string]stringsFunc{
+	"Contains":  {"(str.contains %[1]s %[2]s)", "bool"},
+	"HasPrefix": {"(str.prefixof %[2]s %[1]s)", "bool"},
+	"HasSuffix": {"(str.suffixof %[2]s %[1]s)", "bool"},
+	"Index":     {"(str.indexof %[1]s %[2]s 0)", "int"},
+}
+
+// isStringsCall は呼び出しが stringsFuncs の strings パッケージの関数の呼び出しかどうか調べる関数。
+// 呼び出しのときは関数名を name に返す。
+func isStringsCall(ce *ast.CallExpr) (name string, ok bool) {
+	se, isSel := ce.Fun.(*ast.SelectorExpr)
+	if !isSel {
+		return
+	}
+	if pkg, isIdent := se.X.(*ast.Ident); !isIdent || pkg.Name != "strings" {
+		return
+	}
+	if _, ok = stringsFuncs[se.Sel.Name]; ok && len(ce.Args) == 2 {
+		name = se.Sel.Name
+	} else {
+		ok = false
+	}
+	return
+}
+
+// isStringExpr は変数名とその型 vars のもとで式 expr が文字列かどうか調べる関数
+func isStringExpr(vars map[string]ast.Expr, expr ast.Expr) bool {
+	return convType(typeOf(vars, expr)) == "String"
+}
+
+// convStringsCall は strings パッケージの関数 name の呼び出しを SMT の文字列理論の式に変換する関数
+func convStringsCall(name string, ce *ast.CallExpr) (r string) {
+	r = fmt.Sprintf(stringsFuncs[name].format, convExpr(ce.Args[0]), convExpr(ce.Args[1]))
+	return
+}
+
+// stmtExprs は分岐のない文 stmt が評価する式のリストを取得する関数。
+// if 文などの条件式は文の途中で評価されるので含めない。
+func stmtExprs(stmt ast.Stmt) (r []ast.Expr) {
+	switch stmt.(type) {
+	case *ast.AssignStmt:
+		s := stmt.(*ast.AssignStmt)
+		r = append(append(r, s.Lhs...), s.Rhs...)
+	case *ast.IncDecStmt:
+		r = []ast.Expr{stmt.(*ast.IncDecStmt).X}
+	case *ast.ExprStmt:
+		r = []ast.Expr{stmt.(*ast.ExprStmt).X}
+	case *ast.ReturnStmt:
+		r = stmt.(*ast.ReturnStmt).Results
+	case *ast.DeclStmt:
+		gd, ok := stmt.(*ast.DeclStmt).Decl.(*ast.GenDecl)
+		if !ok {
+			return
+		}
+		for _, spec := range gd.Specs {
+			if vs, ok := spec.(*ast.ValueSpec); ok {
+				r = append(r, vs.Values...)
+			}
+		}
+	}
+	return
+}
+
+// indexChecks は式 exprs を評価するときに文字列の添字 s[i] が範囲内である条件
+// 0 <= i && i < len(s) を作成する関数。Golang では範囲外の添字はパニックになるので、証明すべき条件とする。
+// 文字列の添字がないときは nil を返す。
+func indexChecks(vars map[string]ast.Expr, exprs ...ast.Expr) (r ast.Expr) {
+	var conds []ast.Expr
+	for _, e := range exprs {
+		conds = append(conds, indexConds(vars, e)...)
+	}
+	if len(conds) > 0 {
+		r = astAnds(conds...)
+	}
+	return
+}
+
+// indexConds は式 expr の中の文字列の添字が範囲内である条件のリストを作成する関数。
+// && と || の右辺は左辺によっては評価されないので、右辺の条件は評価されるときだけのものとする。
+func indexConds(vars map[string]ast.Expr, expr ast.Expr) (r []ast.Expr) {
+	switch expr.(type) {
+	case *ast.IndexExpr:
+		ie := expr.(*ast.IndexExpr)
+		r = append(indexConds(vars, ie.X), indexConds(vars, ie.Index)...)
+		if isStringExpr(vars, ie.X) {
+			zero := &ast.BasicLit{Kind: token.INT, Value: "0"}
+			length := &ast.CallExpr{Fun: ast.NewIdent("len"), Args: []ast.Expr{ie.X}}
+			r = append(r, astAnd(
+				&ast.BinaryExpr{X: zero, Op: token.LEQ, Y: ie.Index},
+				&ast.BinaryExpr{X: ie.Index, Op: token.LSS, Y: length}))
+		}
+	case *ast.BinaryExpr:
+		be := expr.(*ast.BinaryExpr)
+		r = indexConds(vars, be.X)
+		for _, c := range indexConds(vars, be.Y) {
+			switch be.Op {
+			case token.LAND:
+				c = astImplies(be.X, c)
+			case token.LOR:
+				c = astImplies(astNot(be.X), c)
+			}
+			r = append(r, c)
+		}
+	case *ast.UnaryExpr:
+		r = indexConds(vars, expr.(*ast.UnaryExpr).X)
+	case *ast.ParenExpr:
+		r = indexConds(vars, expr.(*ast.ParenExpr).X)
+	case *ast.SelectorExpr:
+		r = indexConds(vars, expr.(*ast.SelectorExpr).X)
+	case *ast.StarExpr:
+		r = indexConds(vars, expr.(*ast.StarExpr).X)
+	case *ast.CallExpr:
+		for _, arg := range expr.(*ast.CallExpr).Args {
+			r = append(r, indexConds(vars, arg)...)
+		}
+	case *ast.CompositeLit:
+		for _, elt := range expr.(*ast.CompositeLit).Elts {
+			r = append(r, indexConds(vars, elt)...)
+		}
+	case *ast.KeyValueExpr:
+		kv := expr.(*ast.KeyValueExpr)
+		r = append(indexConds(vars, kv.Key), indexConds(vars, kv.Value)...)
+	}
+	return
+}
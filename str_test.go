@@ -0,0 +1,57 @@
+package main
+
+import "testing"
+
+// 文字列の連結、長さ、添字と strings パッケージの関数は SMT の文字列理論の関数になる
+func TestStringSMT(t *testing.T) {
+	src := `package main
+
+import "strings"
+
+func f(s, t string) (r string, n int) {
+	PRE("len(s) > 0 && strings.HasPrefix(s, t)")
+	r = s + t
+	n = int(s[0] - '0')
+	POST("len(r) == len(s) + len(t) && strings.Contains(r, t) && strings.HasSuffix(r, t) && strings.Index(r, s) == 0 && n >= -48")
+	return
+}
+`
+	expectSMT(t, src, []string{"f"},
+		"(declare-const s String)",
+		"(declare-const t String)",
+		"(> (str.len s) 0)",
+		"(str.prefixof t s)",
+		"(str.++ s t)",
+		"(- (str.to_code (str.at s 0)) 48)",
+		"(str.contains ",
+		"(str.suffixof t ",
+		"(str.indexof ")
+}
+
+// コードの中の文字列の添字は範囲内であることを証明すべき条件になる。&& の右辺の添字は左辺が成り立つときだけ評価される。
+func TestStringIndexInRange(t *testing.T) {
+	src := `package main
+
+func f(s string, i int) (r bool) {
+	PRE("true")
+	r = i < len(s) && s[i] == 'a'
+	POST("true")
+	return
+}
+
+func g(s string) (n int) {
+	PRE("true")
+	n = 0
+	for n < len(s) && s[n] != ' ' {
+		INV("n >= 0")
+		n++
+	}
+	POST("n >= 0")
+	return
+}
+`
+	expectSMT(t, src, []string{"f"},
+		"(=> (< i (str.len s)) (and (<= 0 i) (< i (str.len s))))")
+	// ループの条件の添字は繰り返しの先頭ごとに評価される
+	expectSMT(t, src, []string{"g"}, "(and (<= 0 n")
+}
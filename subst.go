@@ -15,7 +15,7 @@ func subst(expr ast.Expr, vs []ast.Expr, es []ast.Expr) (r ast.Expr, err error)
 	case *ast.BasicLit: // 定数のときはなにもしない。
 		bl := expr.(*ast.BasicLit)
 		switch bl.Kind {
-		case token.INT, token.STRING:
+		case token.INT, token.FLOAT, token.STRING, token.CHAR:
 		default:
 			err = fmt.Errorf("subst: BasicLit: unknown Kind")
 			return
@@ -59,6 +59,20 @@ func subst(expr ast.Expr, vs []ast.Expr, es []ast.Expr) (r ast.Expr, err error)
 		}
 	case *ast.CallExpr:
 		ce := expr.(*ast.CallExpr)
+		if isPkgFuncCall(ce) {
+			// strings.Contains(s, t) や math.IsNaN(x) などは引数を置換する。str.go、float.go 参照。
+			var args []ast.Expr
+			for _, arg := range ce.Args {
+				var x ast.Expr
+				x, err = subst(arg, vs, es)
+				if err != nil {
+					return
+				}
+				args = append(args, x)
+			}
+			r = &ast.CallExpr{Fun: ce.Fun, Args: args}
+			return
+		}
 		ident, ok := ce.Fun.(*ast.Ident)
 		if !ok {
 			err = fmt.Errorf("subst: CallExpr: Fun is not Ident")
@@ -86,52 +100,132 @@ func subst(expr ast.Expr, vs []ast.Expr, es []ast.Expr) (r ast.Expr, err error)
 					right,
 				},
 			}
-		case "ForAll", "Exists": // ForAll(x, int, expr)
-			if len(ce.Args) != 3 {
-				err = fmt.Errorf("subst: CallExpr: ForAll/Exists; len(Args) != 3")
+		case "ForAll", "Exists", "ForAllIn", "ExistsIn": // ForAll(x, T, ..., e)、ForAllIn(i, lo, hi, e)。quant.go 参照。
+			var q quant
+			q, _, err = quantOf(ce)
+			if err != nil {
+				err = fmt.Errorf("subst: CallExpr: %s", err)
 				return
 			}
-
-			name, ok := ce.Args[0].(*ast.Ident)
-			if !ok {
-				err = fmt.Errorf("subst: CallExpr: ForAll/Exists; Args[0] is not Ident")
+			// 束縛変数は置換しない。範囲 lo と hi は束縛変数の外側の式。
+			exVs, exEs := vs, es
+			for _, x := range q.names {
+				_, exVs, exEs = excludeVsEs(x, exVs, exEs)
+			}
+			q, err = q.mapQuant(func(e ast.Expr) (ast.Expr, error) {
+				return subst(e, vs, es)
+			}, func(e ast.Expr) (ast.Expr, error) {
+				return subst(e, exVs, exEs)
+			})
+			if err != nil {
 				return
 			}
-			typ, ok := ce.Args[1].(*ast.Ident)
-			if !ok {
-				err = fmt.Errorf("subst: CallExpr: ForAll/Exists; Args[1] is not Ident")
+			r = q.call()
+		case "make": // make(T) の型は置換しない
+			r = expr
+		case "Let": // Let(x, e, body)
+			if len(ce.Args) != 3 {
+				err = fmt.Errorf("subst: CallExpr: Let; len(Args) != 3")
 				return
 			}
-
-			if conf.Debug {
-				fmt.Println(ident.Name, "vs =", vs, "es =", es, "ce.Args[2] =", ce.Args[2])
+			var e, body ast.Expr
+			e, err = subst(ce.Args[1], vs, es)
+			if err != nil {
+				return
 			}
-			_, exVs, exEs := excludeVsEs(name, vs, es)
-			if len(exVs) < 1 { // 置換する変数名がないとき
-				r = expr
-			} else {
-				var t ast.Expr
-				t, err = subst(ce.Args[2], exVs, exEs)
+			body = ce.Args[2]
+			_, exVs, exEs := excludeVsEs(ce.Args[0], vs, es)
+			if len(exVs) > 0 {
+				body, err = subst(body, exVs, exEs)
 				if err != nil {
 					return
 				}
-				r = &ast.CallExpr{
-					Fun: ast.NewIdent(ident.Name),
-					Args: []ast.Expr{
-						name,
-						typ,
-						t,
-					},
+			}
+			r = astLet(ce.Args[0], e, body)
+		case "Store", "Select", "HasKey", "Delete", "Identical", "len", "int", "byte", "rune", "float64", "float32": // Store(a, i, e), Select(a, i), len(s), int(c) など
+			var args []ast.Expr
+			for _, arg := range ce.Args {
+				var x ast.Expr
+				x, err = subst(arg, vs, es)
+				if err != nil {
+					return
 				}
+				args = append(args, x)
+			}
+			r = &ast.CallExpr{
+				Fun:  ast.NewIdent(ident.Name),
+				Args: args,
 			}
 		default:
-			err = fmt.Errorf("subst: CallExpr: Fun: Ident: unknown funcname")
-			return
-			// [TODO] 将来的に関数呼び出しに対応したら、関数の引数の置換を行う。
+			if !isPureName(ident.Name) {
+				err = fmt.Errorf("subst: CallExpr: Fun: Ident: unknown funcname")
+				return
+			}
+			// 純粋関数の呼び出しは引数を置換する。pure.go 参照。
+			var args []ast.Expr
+			for _, arg := range ce.Args {
+				var x ast.Expr
+				x, err = subst(arg, vs, es)
+				if err != nil {
+					return
+				}
+				args = append(args, x)
+			}
+			r = &ast.CallExpr{
+				Fun:  ast.NewIdent(ident.Name),
+				Args: args,
+			}
 		}
 	case *ast.ParenExpr:
 		pe := expr.(*ast.ParenExpr)
 		r, err = subst(pe.X, vs, es)
+	case *ast.SelectorExpr: // 構造体のフィールド p.x
+		se := expr.(*ast.SelectorExpr)
+		var x ast.Expr
+		x, err = subst(se.X, vs, es)
+		if err != nil {
+			return
+		}
+		r = &ast.SelectorExpr{
+			X:   x,
+			Sel: se.Sel,
+		}
+	case *ast.IndexExpr: // 配列の要素 a[i]
+		ie := expr.(*ast.IndexExpr)
+		var x, index ast.Expr
+		x, err = subst(ie.X, vs, es)
+		if err != nil {
+			return
+		}
+		index, err = subst(ie.Index, vs, es)
+		if err != nil {
+			return
+		}
+		r = &ast.IndexExpr{
+			X:     x,
+			Index: index,
+		}
+	case *ast.CompositeLit: // 構造体の値 Point{x: e1, y: e2}
+		cl := expr.(*ast.CompositeLit)
+		var elts []ast.Expr
+		for _, elt := range cl.Elts {
+			var x ast.Expr
+			kv, ok := elt.(*ast.KeyValueExpr)
+			if ok {
+				x, err = subst(kv.Value, vs, es)
+				x = &ast.KeyValueExpr{Key: kv.Key, Value: x}
+			} else {
+				x, err = subst(elt, vs, es)
+			}
+			if err != nil {
+				return
+			}
+			elts = append(elts, x)
+		}
+		r = &ast.CompositeLit{
+			Type: cl.Type,
+			Elts: elts,
+		}
 	default:
 		err = fmt.Errorf("subst: unknown: %v", expr)
 		printNode(expr)
@@ -139,6 +233,53 @@ func subst(expr ast.Expr, vs []ast.Expr, es []ast.Expr) (r ast.Expr, err error)
 	return
 }
 
+// mapExpr は式 expr の部分式を関数 f で書き換えた式を作成する関数。
+// f が ok を返した部分式は f の結果に置き換え、その内側は書き換えない。
+// f が ok を返さなかった部分式は、その内側を書き換えた新しい式にする。元の式は変更しない。
+func mapExpr(expr ast.Expr, f func(ast.Expr) (ast.Expr, bool)) (r ast.Expr) {
+	if x, ok := f(expr); ok {
+		r = x
+		return
+	}
+	r = expr
+	switch expr.(type) {
+	case *ast.BinaryExpr:
+		be := expr.(*ast.BinaryExpr)
+		r = &ast.BinaryExpr{X: mapExpr(be.X, f), Op: be.Op, Y: mapExpr(be.Y, f)}
+	case *ast.UnaryExpr:
+		ue := expr.(*ast.UnaryExpr)
+		r = &ast.UnaryExpr{Op: ue.Op, X: mapExpr(ue.X, f)}
+	case *ast.StarExpr:
+		r = &ast.StarExpr{X: mapExpr(expr.(*ast.StarExpr).X, f)}
+	case *ast.ParenExpr:
+		r = &ast.ParenExpr{X: mapExpr(expr.(*ast.ParenExpr).X, f)}
+	case *ast.SelectorExpr:
+		se := expr.(*ast.SelectorExpr)
+		r = &ast.SelectorExpr{X: mapExpr(se.X, f), Sel: se.Sel}
+	case *ast.IndexExpr:
+		ie := expr.(*ast.IndexExpr)
+		r = &ast.IndexExpr{X: mapExpr(ie.X, f), Index: mapExpr(ie.Index, f)}
+	case *ast.CallExpr:
+		ce := expr.(*ast.CallExpr)
+		var args []ast.Expr
+		for _, arg := range ce.Args {
+			args = append(args, mapExpr(arg, f))
+		}
+		r = &ast.CallExpr{Fun: ce.Fun, Args: args}
+	case *ast.CompositeLit:
+		cl := expr.(*ast.CompositeLit)
+		var elts []ast.Expr
+		for _, elt := range cl.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				elts = append(elts, &ast.KeyValueExpr{Key: kv.Key, Value: mapExpr(kv.Value, f)})
+			} else {
+				elts = append(elts, mapExpr(elt, f))
+			}
+		}
+		r = &ast.CompositeLit{Type: cl.Type, Elts: elts}
+	}
+	return
+}
 
 // excludeVsEs は変数名リスト vs 中にふくまれる変数名 v を除外し、その変数に対応する式リストも除外する関数。
 // 例：excludeVsEs("x", [a,x,y], [A,B,C]) => [a,y],[A,C]
@@ -147,7 +288,7 @@ func excludeVsEs(v ast.Expr, vs []ast.Expr, es []ast.Expr) (r bool, exVs []ast.E
 		if Equals(v, v2) {
 			r = true
 		} else {
-			exVs = append(exVs, v)
+			exVs = append(exVs, v2)
 			exEs = append(exEs, es[i])
 		}
 	}
@@ -172,6 +313,16 @@ func Equals(x, y ast.Expr) (ok bool) {
 		xbe = x.(*ast.BinaryExpr)
 		ybe, ok = y.(*ast.BinaryExpr)
 		ok = ok && xbe.Op == ybe.Op && Equals(xbe.X, ybe.X) && Equals(xbe.Y, ybe.Y)
+	case *ast.SelectorExpr:
+		var xse, yse *ast.SelectorExpr
+		xse = x.(*ast.SelectorExpr)
+		yse, ok = y.(*ast.SelectorExpr)
+		ok = ok && xse.Sel.Name == yse.Sel.Name && Equals(xse.X, yse.X)
+	case *ast.IndexExpr:
+		var xie, yie *ast.IndexExpr
+		xie = x.(*ast.IndexExpr)
+		yie, ok = y.(*ast.IndexExpr)
+		ok = ok && Equals(xie.X, yie.X) && Equals(xie.Index, yie.Index)
 	case *ast.UnaryExpr:
 		var xue, yue *ast.UnaryExpr
 		xue = x.(*ast.UnaryExpr)
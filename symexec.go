@@ -0,0 +1,635 @@
+// symexec.go
+// 記号実行 (symbolic execution) による検証条件の生成
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+)
+
+// 設定の vcgen が "symexec" のときは、関数本体を入口から前向きに記号実行する。
+// if 文や switch 文では合流せずに実行経路を分け、経路ごとに経路条件と実行した文の列 (トレース) をもつ。
+// return した地点と末尾では POST を、ASSERT や関数呼び出しでは証明すべき条件を、経路ごとに別々の検証条件にする。
+// 反例が見つかったときは、その経路のトレースを表示する。
+// 代入や関数呼び出しなどの分岐のない文は受動形の変換 (vcgen.go) を使い、ループは INV で切断する。
+// 受動形の仮定 (呼び出し先の POST やループの先頭の INV) は、それを加えた経路のその地点より後でだけ使う。
+//
+// REACHABLE("ラベル") 文は、その文に到達する実行が PRE のもとで存在することを検証する。
+// 他の方法 (wp, passive) では REACHABLE 文は何もしない。
+
+// maxSymPaths は記号実行で調べる実行経路の数の上限
+const maxSymPaths = 1000
+
+// condInfo は検証条件ごとの付加情報
+type condInfo struct {
+	trace string // 反例の実行経路の説明
+	reach bool   // 到達可能性の条件のときは true。充足 (sat) のときに検証できたことになる。
+}
+
+// condInfos は getCondTobeVerified が返す検証条件の付加情報。検証条件と同じ順で、ないときは空
+var condInfos []condInfo
+
+// condInfoAt は i 番目の検証条件の付加情報を取得する関数
+func condInfoAt(i int) (r condInfo) {
+	if i < len(condInfos) {
+		r = condInfos[i]
+	}
+	return
+}
+
+// sState は記号実行のある経路のある地点での状態
+type sState struct {
+	pState
+	trace []string   // その地点までに実行した文の説明
+	hyps  []ast.Expr // その地点までにその経路で加えた仮定
+}
+
+// then は状態に実行した文の説明を加えた状態を作成する関数
+func (st sState) then(p pState, step string) (r sState) {
+	r.pState = p
+	r.trace = append(append([]string{}, st.trace...), step)
+	r.hyps = st.hyps
+	return
+}
+
+// withHyps は状態に仮定 facts を加えた状態を作成する関数
+func (st sState) withHyps(facts []ast.Expr) (r sState) {
+	r = st
+	if len(facts) > 0 {
+		r.hyps = append(append([]ast.Expr{}, st.hyps...), facts...)
+	}
+	return
+}
+
+// sExits は break/continue で抜けるときの状態の格納先。nil のときはその文脈では抜けられない。
+type sExits struct {
+	brk  *[]sState
+	cont *[]sState
+}
+
+// symexec は記号実行の状態
+type symexec struct {
+	pv      *passive            // 分岐のない文の変換に使う受動形の変換の状態
+	traces  map[int][]string    // 証明すべき条件の番号とその地点までのトレース
+	hyps    map[int][]ast.Expr  // 証明すべき条件の番号とその地点までにその経路で加えた仮定
+	reaches map[string][]sState // REACHABLE 文のラベルとそこに到達する状態
+	labels  []string            // REACHABLE 文のラベルの出現順
+	paths   int                 // 調べた実行経路の数
+}
+
+// symexecCond は記号実行により関数本体の検証条件を作成する関数。
+// 証明すべき条件ごとに Not をとった検証条件を返し、condInfos にそのトレースを格納する。
+func symexecCond(vars map[string]ast.Expr, stmts []ast.Stmt, preCond, postCond ast.Expr, results []ast.Expr) (r []ast.Expr, smtVars map[string]ast.Expr, err error) {
+	pv, st := newPassive(vars, postCond, results)
+	sx := &symexec{
+		pv:      pv,
+		traces:  map[int][]string{},
+		hyps:    map[int][]ast.Expr{},
+		reaches: map[string][]sState{},
+		paths:   1,
+	}
+
+	var outs []sState
+	outs, err = sx.block(sState{pState: st}, stmts, sExits{})
+	if err != nil {
+		return
+	}
+
+	// 末尾まで実行したときも POST が成り立つ
+	for _, out := range outs {
+		var post ast.Expr
+		post, err = pv.rename(out.pState, postCond)
+		if err != nil {
+			return
+		}
+		sx.goal(out, post, "POST")
+	}
+
+	condInfos = nil
+	for i, g := range pv.goals {
+		if isFalseIdent(g.reach) {
+			continue
+		}
+		goal := g.cond
+		if !isTrueIdent(g.reach) {
+			goal = astImplies(g.reach, g.cond)
+		}
+		if hyps := sx.hyps[i]; len(hyps) > 0 {
+			goal = astImplies(astAnds(hyps...), goal)
+		}
+		r = append(r, astNot(pv.vcAt(preCond, 0, goal)))
+		condInfos = append(condInfos, condInfo{trace: g.what + " on path: " + strings.Join(sx.traces[i], "; ")})
+	}
+
+	// REACHABLE 文に到達する経路のどれかが PRE とその経路の仮定のもとで実行できること
+	for _, label := range sx.labels {
+		var reaches []ast.Expr
+		for _, st := range sx.reaches[label] {
+			reaches = append(reaches, astAnds(append(append([]ast.Expr{}, st.hyps...), st.reach)...))
+		}
+		reach := ast.Expr(ast.NewIdent("false"))
+		if len(reaches) > 0 {
+			reach = astOrs(reaches...)
+		}
+		r = append(r, astNot(pv.vcAt(preCond, 0, astNot(reach))))
+		condInfos = append(condInfos, condInfo{trace: "REACHABLE " + label, reach: true})
+	}
+	smtVars = pv.vars
+	return
+}
+
+// goal は状態 st で証明すべき条件 cond をトレースとともに追加する関数
+func (sx *symexec) goal(st sState, cond ast.Expr, what string) {
+	sx.pv.goal(st.pState, cond, what)
+	sx.traces[len(sx.pv.goals)-1] = st.trace
+	sx.hyps[len(sx.pv.goals)-1] = st.hyps
+}
+
+// indexGoal は状態 st で式 exprs を評価するときの文字列の添字が範囲内であることを証明すべき条件として追加する関数。str.go 参照。
+func (sx *symexec) indexGoal(st sState, exprs ...ast.Expr) (err error) {
+	c := indexChecks(sx.pv.types, exprs...)
+	if c == nil {
+		return
+	}
+	c, err = sx.pv.rename(st.pState, c)
+	if err != nil {
+		return
+	}
+	sx.goal(st, c, "index in range")
+	return
+}
+
+// hyp は状態 st に到達したときに成り立つ事実 fact を仮定し、それを加えた状態を返す関数
+func (sx *symexec) hyp(st sState, fact ast.Expr) (r sState) {
+	n := len(sx.pv.hyps)
+	sx.pv.hyp(st.pState, fact)
+	r = st.withHyps(sx.pv.hyps[n:])
+	return
+}
+
+// fork は経路が n 本に分かれたことを数え、上限を超えたときはエラーにする関数
+func (sx *symexec) fork(n int) (err error) {
+	sx.paths += n - 1
+	if sx.paths > maxSymPaths {
+		err = fmt.Errorf("symexec: too many paths (> %d)", maxSymPaths)
+	}
+	return
+}
+
+// scoped はブロックのスコープの中で f を実行する関数。
+// ブロックの中で := 宣言された変数は、f が返す各経路の状態で外側の版に戻す。
+func (sx *symexec) scoped(f func() ([]sState, error)) (outs []sState, err error) {
+	pv := sx.pv
+	pv.pushScope()
+	scope := pv.scopes[len(pv.scopes)-1]
+	outs, err = f()
+	pv.popScope(&pState{})
+	for i := range outs {
+		outs[i].env = copyEnv(outs[i].env)
+		for name, outer := range scope {
+			if outer == nil {
+				delete(outs[i].env, name)
+			} else {
+				outs[i].env[name] = outer
+			}
+		}
+	}
+	return
+}
+
+// block はブロックの文のリストを記号実行する関数
+func (sx *symexec) block(st sState, stmts []ast.Stmt, ex sExits) (outs []sState, err error) {
+	outs, err = sx.scoped(func() (outs []sState, err error) {
+		outs = []sState{st}
+		for _, stmt := range stmts {
+			outs, err = sx.each(outs, stmt, ex)
+			if err != nil {
+				return
+			}
+		}
+		return
+	})
+	return
+}
+
+// each は複数の経路の状態のそれぞれから文を記号実行する関数
+func (sx *symexec) each(states []sState, stmt ast.Stmt, ex sExits) (outs []sState, err error) {
+	for _, st := range states {
+		var rs []sState
+		rs, err = sx.stmt(st, stmt, ex)
+		if err != nil {
+			return
+		}
+		outs = append(outs, rs...)
+	}
+	return
+}
+
+// copyEnv は変数名と版の表を複製する関数
+func copyEnv(env map[string]ast.Expr) (r map[string]ast.Expr) {
+	r = map[string]ast.Expr{}
+	for name, v := range env {
+		r[name] = v
+	}
+	return
+}
+
+// stmt は文を記号実行し、文のあとに続く経路の状態のリストを返す関数。
+// return や break などで抜けた経路や、到達しない経路は返さない。
+func (sx *symexec) stmt(st sState, stmt ast.Stmt, ex sExits) (outs []sState, err error) {
+	switch stmt.(type) {
+	case *ast.IfStmt:
+		outs, err = sx.ifStmt(st, stmt.(*ast.IfStmt), ex)
+	case *ast.SwitchStmt:
+		outs, err = sx.switchStmt(st, stmt.(*ast.SwitchStmt), ex)
+	case *ast.ForStmt:
+		outs, err = sx.forStmt(st, stmt.(*ast.ForStmt), ex)
+	case *ast.BlockStmt:
+		outs, err = sx.block(st, stmt.(*ast.BlockStmt).List, ex)
+	case *ast.BranchStmt:
+		err = sx.branchStmt(st, stmt.(*ast.BranchStmt), ex)
+	default:
+		if label, ok := isReachableStmt(stmt); ok {
+			if _, seen := sx.reaches[label]; !seen {
+				sx.labels = append(sx.labels, label)
+			}
+			sx.reaches[label] = append(sx.reaches[label], st)
+			outs = []sState{st}
+			return
+		}
+		// 分岐のない文は受動形の変換で実行する。
+		// 文の中で加えた仮定は、その後に加えた証明すべき条件とその後の経路でだけ使う。
+		n, h := len(sx.pv.goals), len(sx.pv.hyps)
+		next := st.then(st.pState, stepString(stmt, ""))
+		var r pState
+		r, err = sx.pv.stmt(st.pState.copy(), stmt, pExits{})
+		if err != nil {
+			return
+		}
+		for i := n; i < len(sx.pv.goals); i++ {
+			sx.traces[i] = next.trace
+			sx.hyps[i] = st.withHyps(sx.pv.hyps[h:sx.pv.goals[i].nhyps]).hyps
+		}
+		next.pState = r
+		next = next.withHyps(sx.pv.hyps[h:])
+		outs = live(next)
+	}
+	return
+}
+
+// live は到達する状態だけのリストを作成する関数
+func live(states ...sState) (r []sState) {
+	for _, st := range states {
+		if !isFalseIdent(st.reach) {
+			r = append(r, st)
+		}
+	}
+	return
+}
+
+// stepString はトレースに記録する文の説明を作成する関数。行番号がわかるときは行番号をつける。
+func stepString(stmt ast.Stmt, note string) (r string) {
+	switch stmt.(type) {
+	case *ast.IfStmt:
+		r = "if " + nodeString(stmt.(*ast.IfStmt).Cond)
+	case *ast.SwitchStmt:
+		r = "switch"
+		if tag := stmt.(*ast.SwitchStmt).Tag; tag != nil {
+			r += " " + nodeString(tag)
+		}
+	case *ast.ForStmt:
+		r = "for"
+		if cond := stmt.(*ast.ForStmt).Cond; cond != nil {
+			r += " " + nodeString(cond)
+		}
+	default:
+		r = nodeString(stmt)
+	}
+	if note != "" {
+		r += " (" + note + ")"
+	}
+	if stmt.Pos().IsValid() && fset != nil {
+		r = fmt.Sprintf("%d: %s", fset.Position(stmt.Pos()).Line, r)
+	}
+	return
+}
+
+// branchStmt は break 文および continue 文を記号実行する関数。抜ける先に状態を渡す。
+func (sx *symexec) branchStmt(st sState, s *ast.BranchStmt, ex sExits) (err error) {
+	if s.Label != nil {
+		err = fmt.Errorf("symexec: labeled %s is not supported", s.Tok)
+		return
+	}
+	var exit *[]sState
+	switch s.Tok {
+	case token.BREAK:
+		exit = ex.brk
+	case token.CONTINUE:
+		exit = ex.cont
+	default:
+		err = fmt.Errorf("symexec: %s is not supported", s.Tok)
+		return
+	}
+	if exit == nil {
+		err = fmt.Errorf("symexec: %s is not in a loop", s.Tok)
+		return
+	}
+	*exit = append(*exit, st.then(st.pState, stepString(s, "")))
+	return
+}
+
+// ifStmt は if 文を記号実行する関数。条件が成り立つ経路と成り立たない経路に分ける。
+func (sx *symexec) ifStmt(st sState, s *ast.IfStmt, ex sExits) (outs []sState, err error) {
+	outs, err = sx.scoped(func() (outs []sState, err error) {
+		states := []sState{st}
+		if s.Init != nil {
+			states, err = sx.stmt(st, s.Init, ex)
+			if err != nil {
+				return
+			}
+		}
+		for _, cur := range states {
+			if err = sx.indexGoal(cur, s.Cond); err != nil {
+				return
+			}
+			var cond ast.Expr
+			cond, err = sx.pv.rename(cur.pState, s.Cond)
+			if err != nil {
+				return
+			}
+			if err = sx.fork(2); err != nil {
+				return
+			}
+
+			var rs []sState
+			thenSt := cur.then(sx.pv.assume(cur.pState, cond), stepString(s, "true"))
+			rs, err = sx.block(thenSt, s.Body.List, ex)
+			if err != nil {
+				return
+			}
+			outs = append(outs, rs...)
+
+			elseSt := cur.then(sx.pv.assume(cur.pState, astNot(cond)), stepString(s, "false"))
+			rs = live(elseSt)
+			if s.Else != nil && len(rs) > 0 {
+				rs, err = sx.stmt(elseSt, s.Else, ex)
+				if err != nil {
+					return
+				}
+			}
+			outs = append(outs, rs...)
+		}
+		return
+	})
+	return
+}
+
+// switchStmt は switch 文を記号実行する関数。case 節ごとに経路を分ける。
+// fallthrough で終わる節の経路は次の節の本体に続ける。
+func (sx *symexec) switchStmt(st sState, s *ast.SwitchStmt, ex sExits) (outs []sState, err error) {
+	if _, ok := hasFunCall(s.Tag); ok {
+		err = fmt.Errorf("symexec: Tag of function call is not supported")
+		return
+	}
+	outs, err = sx.scoped(func() (outs []sState, err error) {
+		states := []sState{st}
+		if s.Init != nil {
+			states, err = sx.stmt(st, s.Init, ex)
+			if err != nil {
+				return
+			}
+		}
+		for _, cur := range states {
+			var rs []sState
+			rs, err = sx.switchBody(cur, s, ex)
+			if err != nil {
+				return
+			}
+			outs = append(outs, rs...)
+		}
+		return
+	})
+	return
+}
+
+// switchBody は switch 文の case 節を状態 st から記号実行する関数
+func (sx *symexec) switchBody(st sState, s *ast.SwitchStmt, ex sExits) (outs []sState, err error) {
+	n := len(s.Body.List)
+	if err = sx.fork(n + 1); err != nil {
+		return
+	}
+
+	// 各節に入る状態。rest はそれまでのどの case 節にも当てはまらない状態。
+	entries := make([]sState, n)
+	defaultIdx := -1
+	rest := st
+	for i, stmt := range s.Body.List {
+		cc, ok := stmt.(*ast.CaseClause)
+		if !ok {
+			err = fmt.Errorf("symexec: Body.List[%d] is not CaseClause", i)
+			return
+		}
+		if cc.List == nil {
+			defaultIdx = i
+			continue
+		}
+		if err = sx.indexGoal(rest, caseCond(s.Tag, cc.List)); err != nil {
+			return
+		}
+		var cond ast.Expr
+		cond, err = sx.pv.rename(st.pState, caseCond(s.Tag, cc.List))
+		if err != nil {
+			return
+		}
+		entries[i] = rest.then(sx.pv.assume(rest.pState, cond), stepString(s, "case "+nodeString(cond)))
+		rest = rest.then(sx.pv.assume(rest.pState, astNot(cond)), stepString(s, "not case "+nodeString(cond)))
+	}
+	if defaultIdx >= 0 {
+		entries[defaultIdx] = rest.then(rest.pState, stepString(s, "default"))
+	}
+
+	// switch 文の中の break は switch 文を抜ける
+	var brks, fall []sState
+	for i, stmt := range s.Body.List {
+		cc := stmt.(*ast.CaseClause)
+		stmts := cc.Body
+		ft := isFallthrough(stmts)
+		if ft {
+			if i == n-1 {
+				err = fmt.Errorf("symexec: fallthrough in the last clause")
+				return
+			}
+			stmts = stmts[:len(stmts)-1]
+		}
+		var ends []sState
+		for _, entry := range append(live(entries[i]), fall...) {
+			var rs []sState
+			rs, err = sx.block(entry, stmts, sExits{brk: &brks, cont: ex.cont})
+			if err != nil {
+				return
+			}
+			ends = append(ends, rs...)
+		}
+		if ft {
+			fall = ends
+		} else {
+			fall = nil
+			outs = append(outs, ends...)
+		}
+	}
+	if defaultIdx < 0 {
+		// どの case 節にも当てはまらないときは何もしない
+		outs = append(outs, live(rest)...)
+	}
+	outs = append(outs, brks...)
+	return
+}
+
+// forStmt は for 文を記号実行する関数。
+// ループに入る時点で INV を証明し、ループ内で代入される変数を新しい版の定数に置き換えて INV を仮定する。
+// その状態から条件が成り立つ経路でループ本体を一回実行し、post 文を実行したあとに INV を証明する。
+// ループのあとには、条件が成り立たない経路と break した経路が続く。
+func (sx *symexec) forStmt(st sState, s *ast.ForStmt, ex sExits) (outs []sState, err error) {
+	var asserts map[string]ast.Expr
+	var stmts []ast.Stmt
+	asserts, stmts, err = separateStmts(s.Body.List)
+	if err != nil {
+		return
+	}
+	inv := asserts["INV"]
+	if inv == nil {
+		err = fmt.Errorf("symexec: ForStmt: no INV")
+		return
+	}
+	cond := s.Cond
+	if cond == nil {
+		cond = ast.NewIdent("true")
+	}
+	measure := asserts["DECREASES"]
+	term.loop(measure)
+
+	outs, err = sx.scoped(func() (outs []sState, err error) {
+		states := []sState{st}
+		if s.Init != nil {
+			states, err = sx.stmt(st, s.Init, ex)
+			if err != nil {
+				return
+			}
+		}
+		for _, cur := range states {
+			var rs []sState
+			rs, err = sx.loop(cur, s, stmts, inv, cond, measure)
+			if err != nil {
+				return
+			}
+			outs = append(outs, rs...)
+		}
+		return
+	})
+	return
+}
+
+// loop は状態 st からループに入ったときのループ本体とループを抜けたあとを記号実行する関数
+func (sx *symexec) loop(st sState, s *ast.ForStmt, stmts []ast.Stmt, inv, cond, measure ast.Expr) (outs []sState, err error) {
+	pv := sx.pv
+	if err = sx.fork(2); err != nil {
+		return
+	}
+
+	// ループに入る時点で INV が成り立つ
+	var e ast.Expr
+	e, err = pv.rename(st.pState, inv)
+	if err != nil {
+		return
+	}
+	sx.goal(st, e, "INV on entry")
+
+	// 任意の繰り返しの先頭の状態で INV を仮定する
+	head := st.then(pv.loopHead(st.pState, s), stepString(s, "any iteration"))
+	e, err = pv.rename(head.pState, inv)
+	if err != nil {
+		return
+	}
+	head = sx.hyp(head, e)
+	if err = sx.indexGoal(head, cond); err != nil {
+		return
+	}
+	var c ast.Expr
+	c, err = pv.rename(head.pState, cond)
+	if err != nil {
+		return
+	}
+
+	// 繰り返しの先頭では減少量は 0 以上で、その値を d とする
+	top := head.then(pv.assume(head.pState, c), stepString(s, "true"))
+	var d ast.Expr
+	if measure != nil {
+		d, err = pv.rename(top.pState, measure)
+		if err != nil {
+			return
+		}
+		sx.goal(top, nonNegative(d), "DECREASES non-negative")
+	}
+
+	// ループ本体
+	var brks, conts, ends []sState
+	ends, err = sx.block(top, stmts, sExits{brk: &brks, cont: &conts})
+	if err != nil {
+		return
+	}
+	ends = append(ends, conts...)
+	if s.Post != nil {
+		ends, err = sx.each(ends, s.Post, sExits{})
+		if err != nil {
+			return
+		}
+	}
+	for _, end := range ends {
+		e, err = pv.rename(end.pState, inv)
+		if err != nil {
+			return
+		}
+		sx.goal(end, e, "INV preserved")
+		if measure != nil {
+			// ループ本体を一回実行すると減少量は d より小さくなる
+			e, err = pv.rename(end.pState, measure)
+			if err != nil {
+				return
+			}
+			sx.goal(end, decreased(e, d), "DECREASES")
+		}
+	}
+
+	// ループを抜けたあとの経路
+	exit := head.then(pv.assume(head.pState, astNot(c)), stepString(s, "false"))
+	outs = append(live(exit), brks...)
+	return
+}
+
+// isReachableStmt は文が REACHABLE("ラベル") 文かどうか調べ、そのラベルを取得する関数
+func isReachableStmt(stmt ast.Stmt) (label string, ok bool) {
+	es, isExpr := stmt.(*ast.ExprStmt)
+	if !isExpr {
+		return
+	}
+	ce, isCall := es.X.(*ast.CallExpr)
+	if !isCall {
+		return
+	}
+	if ident, isIdent := ce.Fun.(*ast.Ident); !isIdent || ident.Name != "REACHABLE" {
+		return
+	}
+	ok = true
+	if len(ce.Args) == 1 {
+		if lit, isLit := ce.Args[0].(*ast.BasicLit); isLit && lit.Kind == token.STRING {
+			label = strings.Trim(lit.Value, "\"`")
+		}
+	}
+	if label == "" {
+		label = "(no label)"
+	}
+	return
+}
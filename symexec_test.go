@@ -0,0 +1,55 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// 記号実行は経路ごとに POST の検証条件を作り、その経路のトレースをつける
+func TestSymexecPaths(t *testing.T) {
+	src := `package main
+
+func f(x int) (r int) {
+	PRE("true")
+	if x > 0 {
+		r = 1
+		return
+	}
+	switch {
+	case x == 0:
+		r = 0
+	default:
+		r = 2
+	}
+	POST("%s")
+	return
+}
+`
+	conds := condStrings(t, "symexec", strings.Replace(src, "%s", "r >= 0", 1), "f")
+	traces := []string{
+		"POST on path: 5: if x > 0 (true); 6: r = 1; return",
+		"POST on path: 5: if x > 0 (false); 9: switch (case x == 0); 11: r = 0; return",
+		"POST on path: 5: if x > 0 (false); 9: switch (not case x == 0); 9: switch (default); 13: r = 2; return",
+	}
+	if len(conds) != len(traces) {
+		t.Fatalf("got %d conds, want %d", len(conds), len(traces))
+	}
+	for i, want := range traces {
+		if got := condInfoAt(i).trace; got != want {
+			t.Errorf("trace %d:\ngot  %s\nwant %s", i, got, want)
+		}
+	}
+
+	// 反例は x == 0 の経路の検証条件だけで見つかる
+	expectVerdictWith(t, []string{"symexec"}, strings.Replace(src, "%s", "r >= 0", 1), true, "f")
+	expectVerdictWith(t, []string{"symexec"}, strings.Replace(src, "%s", "r != 0", 1), false, "f")
+	for i, script := range smtScripts(t, "symexec", strings.Replace(src, "%s", "r != 0", 1), "f") {
+		result, _, _, err := runSMTScript(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[bool]string{true: "sat", false: "unsat"}[i == 1]; result != want {
+			t.Errorf("path %d: got %s, want %s", i, result, want)
+		}
+	}
+}
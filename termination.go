@@ -0,0 +1,109 @@
+// termination.go
+// 停止性 (DECREASES) の検証
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// ループや再帰関数の停止性は、DECREASES("n - i") で与える整数の式 (減少量) で示す。
+//
+// ループの DECREASES はループ本体に書く。INV とループの条件が成り立つとき減少量は 0 以上で、
+// ループ本体を一回実行する (post 文を含む) ごとに減少量が真に小さくなることを検証する。
+//
+//	for i := 0; i < n; i++ {
+//		INV("0 <= i && i <= n")
+//		DECREASES("n - i")
+//	}
+//
+// 関数の DECREASES は PRE や POST と並べて書く。PRE が成り立つとき減少量は 0 以上で、
+// 自分自身の再帰呼び出しの実引数での減少量が入口での減少量より真に小さいことを検証する。
+// 入口での減少量は old.go の入口での値を使って表す。
+//
+// DECREASES のないループや再帰呼び出しがある関数、全正当性が検証されていない関数を呼び出す関数は部分正当性となる。
+
+const (
+	// totalCorrectness は停止性まで検証した全正当性
+	totalCorrectness = "total"
+	// partialCorrectness は停止性を検証していない部分正当性
+	partialCorrectness = "partial"
+)
+
+// termination は検証中の関数の停止性の情報
+type termination struct {
+	name    string   // 検証中の関数名 (メソッドのときは 型名.メソッド名)
+	measure ast.Expr // 関数の DECREASES の減少量。ないときは nil
+	entry   ast.Expr // 関数の入口での減少量
+	total   bool     // 停止性を示せたかどうか
+}
+
+// term は検証中の関数の停止性の情報
+var term termination
+
+// beginTermination は関数 name の停止性の検証を始める関数。
+// measure は関数の DECREASES の減少量 (ヒープの参照に直したもの)、vars は関数の変数名の表。
+func beginTermination(vars map[string]ast.Expr, name string, measure ast.Expr) {
+	term = termination{name: name, measure: measure, total: true}
+	if measure != nil {
+		term.entry = elimOld(vars, &ast.CallExpr{Fun: ast.NewIdent("old"), Args: []ast.Expr{measure}})
+	}
+}
+
+// correctness は検証中の関数が全正当性か部分正当性かを表す文字列を返す関数
+func (t termination) correctness() (r string) {
+	r = partialCorrectness
+	if t.total {
+		r = totalCorrectness
+	}
+	return
+}
+
+// call は関数呼び出しの停止性の条件を作成する関数。
+// 自分自身の再帰呼び出しのときは、実引数 args での減少量が入口での減少量より小さいという条件を返す。
+// それ以外の呼び出しでは nil を返す。
+func (t *termination) call(funData Data, args []ast.Expr) (cond ast.Expr, err error) {
+	if funData.Name != t.name {
+		if funData.Correctness != totalCorrectness {
+			t.total = false
+		}
+		return
+	}
+	if t.measure == nil {
+		t.total = false
+		return
+	}
+	params, _, _, _ := funData.getParams()
+	if len(params) != len(args) {
+		err = fmt.Errorf("termination: len(args) != len(params)")
+		return
+	}
+	var m ast.Expr
+	m, err = subst(t.measure, params, args)
+	if err != nil {
+		return
+	}
+	cond = decreased(m, t.entry)
+	return
+}
+
+// loop はループの DECREASES の減少量 measure を受け取り、ないときは部分正当性とする関数
+func (t *termination) loop(measure ast.Expr) {
+	if measure == nil {
+		t.total = false
+	}
+}
+
+// nonNegative は減少量が 0 以上という条件式を作成する関数
+func nonNegative(measure ast.Expr) (r ast.Expr) {
+	r = &ast.BinaryExpr{X: measure, Op: token.GEQ, Y: &ast.BasicLit{Kind: token.INT, Value: "0"}}
+	return
+}
+
+// decreased は減少量が before の値より真に小さくなったという条件式を作成する関数
+func decreased(measure, before ast.Expr) (r ast.Expr) {
+	r = &ast.BinaryExpr{X: measure, Op: token.LSS, Y: before}
+	return
+}
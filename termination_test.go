@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+)
+
+// ループと再帰関数の DECREASES による停止性
+func TestDecreases(t *testing.T) {
+	loop := `
+func sum(n int) (s int) {
+	PRE("n >= 0")
+	s = 0
+	i := 0
+	for i < n {
+		INV("0 <= i && i <= n")
+		DECREASES("%s")
+		i = i + %s
+	}
+	POST("true")
+	return
+}
+`
+	rec := `
+func down(n int) (r int) {
+	PRE("n >= 0")
+	DECREASES("n")
+	if n == 0 {
+		r = 0
+		return
+	}
+	r = down(%s)
+	POST("r == 0")
+	return
+}
+`
+	runVerdictTests(t, []verdictTest{
+		{name: "loop", src: fmt.Sprintf(loop, "n - i", "1"), funcs: []string{"sum"}, ok: true},
+		{name: "loop not decreasing", src: fmt.Sprintf(loop, "n - i", "0"), funcs: []string{"sum"}, ok: false},
+		{name: "loop negative measure", src: fmt.Sprintf(loop, "n - i - 2", "1"), funcs: []string{"sum"}, ok: false},
+		{name: "recursion", src: fmt.Sprintf(rec, "n - 1"), funcs: []string{"down"}, ok: true},
+		{name: "recursion not decreasing", src: fmt.Sprintf(rec, "n"), funcs: []string{"down"}, ok: false},
+	})
+}
+
+// 停止性を示せた関数は全正当性、DECREASES のないループや再帰呼び出しのある関数とそれを呼び出す関数は部分正当性
+func TestCorrectness(t *testing.T) {
+	src := `package main
+
+func total(n int) (r int) {
+	PRE("n >= 0")
+	r = 0
+	for r < n {
+		INV("0 <= r && r <= n")
+		DECREASES("n - r")
+		r = r + 1
+	}
+	POST("r == n")
+	return
+}
+
+func partial(n int) (r int) {
+	PRE("n >= 0")
+	r = 0
+	for r < n {
+		INV("0 <= r && r <= n")
+		r = r + 1
+	}
+	POST("r == n")
+	return
+}
+
+func callsTotal(n int) (r int) {
+	PRE("n >= 0")
+	r = total(n)
+	POST("r == n")
+	return
+}
+
+func callsPartial(n int) (r int) {
+	PRE("n >= 0")
+	r = partial(n)
+	POST("r == n")
+	return
+}
+`
+	for _, vcgen := range vcgens {
+		if err := verifyFuncs(t, vcgen, src, "total", "partial", "callsTotal", "callsPartial"); err != nil {
+			t.Fatalf("%s: %v", vcgen, err)
+		}
+		want := map[string]string{
+			"total":        totalCorrectness,
+			"partial":      partialCorrectness,
+			"callsTotal":   totalCorrectness,
+			"callsPartial": partialCorrectness,
+		}
+		for name, c := range want {
+			if got := funcTab[name].Correctness; got != c {
+				t.Errorf("%s: %s: got %s, want %s", vcgen, name, got, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,393 @@
+// typecheck.go
+// 表明の型検査
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/scanner"
+	"go/token"
+	"go/types"
+	"strings"
+)
+
+// 表明の文字列 (PRE、POST、INV、ASSERT、ASSUME、DECREASES) は、検証の前に go/types で
+// 表明の場所のスコープにおける Golang の式として型検査する。
+// 変数名の誤り、bool でない表明、型の合わない比較などを位置つきのエラーにし、
+// SMT ソルバに不明なソートとして渡らないようにする。
+//
+// 表明の言語には Golang にない次の構文があるので、型検査の前に書き換える。
+//
+//	ForAll(x, T, e)        -> specForAll(func(x T) bool { return e })
+//	Exists(x, T, y, U, e)  -> specForAll(func(x T) bool { return specForAll(func(y U) bool { return e }) })
+//	ForAllIn(i, lo, hi, e) -> specForAllIn(lo, hi, func(i int) bool { return e })
+//	Pattern(t)             -> 限量子の本体の前の _ = t
+//	Let(x, v, e)           -> func() bool { x := v; _ = x; return e }()
+//	Select(a, i)           -> a[i]
+//	a == b                 -> specEqual(a, b)
+//
+// 表明ではスライスや構造体も == で比較できるので、== は型パラメータつきの関数の呼び出しにする。
+
+// specPkg は検証対象のファイルを型検査したパッケージ
+var specPkg *types.Package
+
+// declObjs は型検査で求めた、宣言された名前の Ident とそのオブジェクト (変数、定数など)
+var declObjs map[*ast.Ident]types.Object
+
+// specBuiltins は表明で使う組み込み関数の宣言
+const specBuiltins = `
+func Implies(a, b bool) bool { return !a || b }
+func old[T any](x T) T { return x }
+func Store[T any](a []T, i int, v T) []T { return a }
+func specForAll[T any](f func(T) bool) bool { return true }
+func specForAllIn(lo, hi int, f func(int) bool) bool { return true }
+func specEqual[T any](x, y T) bool { return true }
+func Identical[T any](x, y T) bool { return true }
+func HasKey[K comparable, V any](m map[K]V, k K) bool { return true }
+func Delete[K comparable, V any](m map[K]V, k K) map[K]V { return m }
+`
+
+// specTags は型検査する表明文の名前とその式の型の種類
+var specTags = map[string]types.BasicInfo{
+	"PRE":       types.IsBoolean,
+	"POST":      types.IsBoolean,
+	"INV":       types.IsBoolean,
+	"ASSERT":    types.IsBoolean,
+	"ASSUME":    types.IsBoolean,
+	"DECREASES": types.IsInteger,
+}
+
+// loadTypes は検証対象のファイルを表明の組み込み関数とともに型検査し、specPkg に格納する関数。
+// ファイルの型エラーはここでは無視し、表明の型検査のためのスコープだけを使う。
+// PREDICATE は同名の関数、LEMMA は名前のない関数として宣言し、その本体の位置を型検査のスコープとする。predicate.go 参照。
+func loadTypes(fileNode *ast.File) (err error) {
+	src := "package " + fileNode.Name.Name + "\n" + specBuiltins
+	scopes := make([]int, len(specDefs))
+	for i, def := range specDefs {
+		name := def.name
+		if def.kind == "LEMMA" {
+			name = "_"
+		}
+		src += fmt.Sprintf("func %s%s bool {\n\treturn ", name, def.sig)
+		scopes[i] = len(src)
+		src += "true\n}\n"
+	}
+	var builtins *ast.File
+	builtins, err = parser.ParseFile(fset, "<spec builtins>", src, 0)
+	if err != nil {
+		return
+	}
+	file := fset.File(builtins.Pos())
+	for i, def := range specDefs {
+		def.scope = file.Pos(scopes[i])
+	}
+	tc := types.Config{
+		Importer: importer.ForCompiler(fset, "source", nil),
+		Error:    func(error) {},
+	}
+	info := &types.Info{
+		Types: map[ast.Expr]types.TypeAndValue{},
+		Defs:  map[*ast.Ident]types.Object{},
+	}
+	specPkg, _ = tc.Check(fileNode.Name.Name, fset, []*ast.File{fileNode, builtins}, info)
+	declObjs = info.Defs
+
+	// 型のない定数のうち浮動小数点数の型をもつ数値リテラルを登録する。float.go 参照。
+	recordFloatLits(info)
+	// 浮動小数点数の定数の式を畳み込む
+	foldFloatConsts(fileNode, info)
+	return
+}
+
+// checkSpecs は関数本体の表明文の文字列を型検査する関数。最初にみつかったエラーを返す。
+func checkSpecs(funcDecl *ast.FuncDecl) (err error) {
+	ast.Inspect(funcDecl.Body, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		ce, ok := n.(*ast.CallExpr)
+		if !ok || len(ce.Args) != 1 {
+			return true
+		}
+		ident, ok := ce.Fun.(*ast.Ident)
+		if !ok {
+			return true
+		}
+		want, ok := specTags[ident.Name]
+		if !ok {
+			return true
+		}
+		bl, ok := ce.Args[0].(*ast.BasicLit)
+		if !ok || bl.Kind != token.STRING {
+			return true
+		}
+		var expr ast.Expr
+		expr, err = parseSpec(bl, ident.Name)
+		if err != nil {
+			return false
+		}
+		err = checkSpecExpr(ident.Name, want, bl, expr, bl.Pos())
+		return false
+	})
+	return
+}
+
+// specLit は表明の式をパースした文字列リテラルと、パースした文字列の先頭のリテラルの中での位置
+type specLit struct {
+	lit   *ast.BasicLit
+	shift int
+}
+
+// specLits はパースした表明の式のファイルとその文字列リテラルの表。エラーの位置を求めるのに使う。
+var specLits = map[*token.File]specLit{}
+
+// parseSpec は文字列リテラル bl の表明 tag の式をパースする関数
+func parseSpec(bl *ast.BasicLit, tag string) (r ast.Expr, err error) {
+	r, err = parseSpecAt(bl, tag, 0, bl.Value[1:len(bl.Value)-1])
+	return
+}
+
+// parseSpecAt は文字列リテラル bl の中の shift バイト目からの文字列とみなして表明 tag の src をパースする関数。
+// パースのエラーは文字列リテラルの中の位置のエラーとする。
+func parseSpecAt(bl *ast.BasicLit, tag string, shift int, src string) (r ast.Expr, err error) {
+	base := fset.Base()
+	r, err = parser.ParseExprFrom(fset, "", src, 0)
+	if file := fset.File(token.Pos(base)); file != nil {
+		specLits[file] = specLit{lit: bl, shift: shift}
+	}
+	if list, ok := err.(scanner.ErrorList); ok && len(list) > 0 {
+		err = fmt.Errorf("%s: %s: %s", specPos(bl, shift+list[0].Pos.Offset), tag, list[0].Msg)
+	}
+	return
+}
+
+// specErrPos は位置 pos を "ファイル名:行:桁" の文字列にする関数。
+// パースした表明の式の中の位置のときは、元の文字列リテラルの中の位置とする。
+func specErrPos(pos token.Pos) string {
+	file := fset.File(pos)
+	if sl, ok := specLits[file]; ok {
+		return specPos(sl.lit, sl.shift+file.Offset(pos))
+	}
+	return fset.Position(pos).String()
+}
+
+// checkSpecExpr は文字列リテラル bl をパースした表明 tag の式 expr を位置 scope のスコープで型検査する関数。
+// 式の型が want の種類 (bool または整数) でなければエラーとする。
+func checkSpecExpr(tag string, want types.BasicInfo, bl *ast.BasicLit, expr ast.Expr, scope token.Pos) (err error) {
+	if err = specQuantErr(tag, expr); err != nil {
+		return
+	}
+	var cmps []*ast.BinaryExpr
+	x := specExpr(expr, &cmps)
+	info := &types.Info{Types: map[ast.Expr]types.TypeAndValue{}}
+	err = types.CheckExpr(fset, specPkg, scope, x, info)
+	if err != nil {
+		if te, ok := err.(types.Error); ok {
+			msg := te.Msg
+			if be := specCmpAt(cmps, te.Pos); be != nil && strings.Contains(msg, "specEqual") {
+				msg = fmt.Sprintf("mismatched types in comparison %s", nodeString(be))
+			}
+			err = fmt.Errorf("%s: %s: %s", specErrPos(te.Pos), tag, msg)
+		}
+		return
+	}
+
+	src := bl.Value[1 : len(bl.Value)-1]
+
+	typ := info.Types[x].Type
+	if basic, ok := typ.Underlying().(*types.Basic); !ok || basic.Info()&want == 0 {
+		kind := "boolean"
+		if want == types.IsInteger {
+			kind = "integer"
+		}
+		err = fmt.Errorf("%s: %s: %s is not %s %s expression (type %s)",
+			specPos(bl, 0), tag, src, article(kind), kind, types.Default(typ))
+	}
+	return
+}
+
+// article は名詞 noun につける不定冠詞を返す関数
+func article(noun string) string {
+	if strings.ContainsAny(noun[:1], "aeiou") {
+		return "an"
+	}
+	return "a"
+}
+
+// specPos は文字列リテラル bl の中の offset バイト目の位置を "ファイル名:行:桁" の文字列にする関数
+func specPos(bl *ast.BasicLit, offset int) string {
+	pos := fset.Position(bl.Pos())
+	src := bl.Value[1:]
+	if offset > len(src) {
+		offset = len(src)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	if i := strings.LastIndex(src[:offset], "\n"); i >= 0 {
+		pos.Line += strings.Count(src[:offset], "\n")
+		pos.Column = offset - i
+	} else {
+		pos.Column += 1 + offset
+	}
+	return pos.String()
+}
+
+// specCmpAt は書き換えた比較 cmps のうち、位置 pos を含む最も内側のものを返す関数
+func specCmpAt(cmps []*ast.BinaryExpr, pos token.Pos) (r *ast.BinaryExpr) {
+	for _, be := range cmps {
+		if be.Pos() <= pos && pos < be.End() {
+			if r == nil || r.Pos() <= be.Pos() && be.End() <= r.End() {
+				r = be
+			}
+		}
+	}
+	return
+}
+
+// specExpr は表明の式 expr を型検査できる Golang の式に書き換える関数。
+// 書き換えた比較 (== と !=) を cmps に追加する。
+func specExpr(expr ast.Expr, cmps *[]*ast.BinaryExpr) (r ast.Expr) {
+	r = expr
+	switch expr.(type) {
+	case *ast.ParenExpr:
+		pe := expr.(*ast.ParenExpr)
+		r = &ast.ParenExpr{Lparen: pe.Lparen, X: specExpr(pe.X, cmps), Rparen: pe.Rparen}
+	case *ast.UnaryExpr:
+		ue := expr.(*ast.UnaryExpr)
+		r = &ast.UnaryExpr{OpPos: ue.OpPos, Op: ue.Op, X: specExpr(ue.X, cmps)}
+	case *ast.StarExpr:
+		se := expr.(*ast.StarExpr)
+		r = &ast.StarExpr{Star: se.Star, X: specExpr(se.X, cmps)}
+	case *ast.SelectorExpr:
+		se := expr.(*ast.SelectorExpr)
+		r = &ast.SelectorExpr{X: specExpr(se.X, cmps), Sel: se.Sel}
+	case *ast.IndexExpr:
+		ie := expr.(*ast.IndexExpr)
+		r = &ast.IndexExpr{X: specExpr(ie.X, cmps), Lbrack: ie.Lbrack, Index: specExpr(ie.Index, cmps), Rbrack: ie.Rbrack}
+	case *ast.BinaryExpr:
+		be := expr.(*ast.BinaryExpr)
+		x, y := specExpr(be.X, cmps), specExpr(be.Y, cmps)
+		switch be.Op {
+		case token.EQL, token.NEQ:
+			*cmps = append(*cmps, be)
+			r = &ast.CallExpr{Fun: &ast.Ident{NamePos: be.OpPos, Name: "specEqual"}, Lparen: be.OpPos, Args: []ast.Expr{x, y}, Rparen: be.End() - 1}
+			if be.Op == token.NEQ {
+				r = &ast.UnaryExpr{OpPos: be.OpPos, Op: token.NOT, X: r}
+			}
+		default:
+			r = &ast.BinaryExpr{X: x, OpPos: be.OpPos, Op: be.Op, Y: y}
+		}
+	case *ast.CompositeLit:
+		cl := expr.(*ast.CompositeLit)
+		elts := make([]ast.Expr, len(cl.Elts))
+		for i, elt := range cl.Elts {
+			if kv, ok := elt.(*ast.KeyValueExpr); ok {
+				elts[i] = &ast.KeyValueExpr{Key: kv.Key, Colon: kv.Colon, Value: specExpr(kv.Value, cmps)}
+			} else {
+				elts[i] = specExpr(elt, cmps)
+			}
+		}
+		r = &ast.CompositeLit{Type: cl.Type, Lbrace: cl.Lbrace, Elts: elts, Rbrace: cl.Rbrace}
+	case *ast.CallExpr:
+		ce := expr.(*ast.CallExpr)
+		args := make([]ast.Expr, len(ce.Args))
+		for i, arg := range ce.Args {
+			args[i] = specExpr(arg, cmps)
+		}
+		r = &ast.CallExpr{Fun: ce.Fun, Lparen: ce.Lparen, Args: args, Ellipsis: ce.Ellipsis, Rparen: ce.Rparen}
+		ident, ok := ce.Fun.(*ast.Ident)
+		if !ok {
+			break
+		}
+		switch ident.Name {
+		case "ForAll", "Exists", "ForAllIn", "ExistsIn": // quant.go 参照
+			if q, ok, e := quantOf(r); ok && e == nil {
+				r = specQuant(q, ident, ce)
+			}
+		case "Let": // Let(x, v, e)
+			if len(ce.Args) != 3 {
+				break
+			}
+			name, e := binderIdent("Let", ce.Args[0])
+			if e != nil {
+				break
+			}
+			body := &ast.BlockStmt{List: []ast.Stmt{
+				&ast.AssignStmt{Lhs: []ast.Expr{name}, Tok: token.DEFINE, Rhs: []ast.Expr{args[1]}},
+				&ast.AssignStmt{Lhs: []ast.Expr{ast.NewIdent("_")}, Tok: token.ASSIGN, Rhs: []ast.Expr{name}},
+				&ast.ReturnStmt{Results: []ast.Expr{args[2]}},
+			}}
+			r = &ast.CallExpr{Fun: &ast.FuncLit{Type: specBoolFunc(nil), Body: body}}
+		case "Select": // Select(a, i)
+			if len(ce.Args) != 2 {
+				break
+			}
+			r = &ast.IndexExpr{X: args[0], Lbrack: ce.Lparen, Index: args[1], Rbrack: ce.Rparen}
+		}
+	}
+	return
+}
+
+// specQuant は束縛変数を書き換えた限量子 q を、束縛変数ごとに入れ子にした関数リテラルの呼び出しにする関数。
+// パターンの項は本体の前の _ = t で型検査する。
+//
+//	ForAll(x, T, y, U, Pattern(t), e) -> specForAll(func(x T) bool { return specForAll(func(y U) bool { _ = t; return e }) })
+func specQuant(q quant, ident *ast.Ident, ce *ast.CallExpr) (r ast.Expr) {
+	var stmts []ast.Stmt
+	for _, p := range q.patterns {
+		for _, t := range p {
+			stmts = append(stmts, &ast.AssignStmt{Lhs: []ast.Expr{ast.NewIdent("_")}, Tok: token.ASSIGN, Rhs: []ast.Expr{t}})
+		}
+	}
+	stmts = append(stmts, &ast.ReturnStmt{Results: []ast.Expr{q.body}})
+	for i := len(q.names) - 1; i >= 0; i-- {
+		fl := specFuncLit(q.names[i], q.types[i], stmts)
+		var call *ast.CallExpr
+		if q.isRange() {
+			call = &ast.CallExpr{Fun: &ast.Ident{NamePos: ident.NamePos, Name: "specForAllIn"}, Args: []ast.Expr{q.lo, q.hi, fl}}
+		} else {
+			call = &ast.CallExpr{Fun: &ast.Ident{NamePos: ident.NamePos, Name: "specForAll"}, Args: []ast.Expr{fl}}
+		}
+		call.Lparen, call.Rparen = ce.Lparen, ce.Rparen
+		r = call
+		stmts = []ast.Stmt{&ast.ReturnStmt{Results: []ast.Expr{r}}}
+	}
+	return
+}
+
+// specQuantErr は表明 tag の式 expr の中の限量子の引数の誤りを調べる関数
+func specQuantErr(tag string, expr ast.Expr) (err error) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if e, ok := n.(ast.Expr); ok && err == nil {
+			if _, _, qerr := quantOf(e); qerr != nil {
+				err = fmt.Errorf("%s: %s: %v", specErrPos(e.Pos()), tag, qerr)
+			}
+		}
+		return err == nil
+	})
+	return
+}
+
+// specFuncLit は束縛変数 name (型 typ) をパラメータとし、本体を文のリスト stmts とする関数リテラルを作る関数
+func specFuncLit(name *ast.Ident, typ ast.Expr, stmts []ast.Stmt) *ast.FuncLit {
+	params := &ast.FieldList{List: []*ast.Field{{Names: []*ast.Ident{name}, Type: typ}}}
+	return &ast.FuncLit{
+		Type: specBoolFunc(params),
+		Body: &ast.BlockStmt{List: stmts},
+	}
+}
+
+// specBoolFunc はパラメータ params をとり bool を返す関数型を作る関数
+func specBoolFunc(params *ast.FieldList) *ast.FuncType {
+	if params == nil {
+		params = &ast.FieldList{}
+	}
+	return &ast.FuncType{
+		Params:  params,
+		Results: &ast.FieldList{List: []*ast.Field{{Type: ast.NewIdent("bool")}}},
+	}
+}
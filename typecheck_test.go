@@ -0,0 +1,39 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// 表明の文字列の型検査は、綴りの誤った変数、bool でない表明、型の合わない比較を位置つきのエラーにする
+func TestCheckSpecs(t *testing.T) {
+	tests := []struct {
+		name string
+		spec string
+		want string // エラーに含まれる文字列。空のときはエラーにならない
+	}{
+		{name: "ok", spec: `POST("r == x + 1 && s")`},
+		{name: "misspelled", spec: `POST("rr == x + 1")`, want: "undefined: rr"},
+		{name: "not boolean", spec: `POST("x + 1")`, want: "x + 1 is not a boolean expression (type int)"},
+		{name: "mismatched", spec: `POST("r == s")`, want: "mismatched types in comparison r == s"},
+		{name: "decreases", spec: `DECREASES("s")`, want: "s is not an integer expression (type bool)"},
+		{name: "parse error", spec: `PRE("x >")`, want: "PRE"},
+		{name: "position", spec: `ASSERT("x > 0 && y > 0")`, want: ":4:19: ASSERT: undefined: y"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := "package main\n\nfunc f(x int, s bool) (r int) {\n\t" + tt.spec + "\n\tr = x + 1\n\treturn\n}\n"
+			fileNode := setupSrc(t, src+specStubs)
+			err := checkSpecs(pickupFuncDecl(fileNode, "f"))
+			if tt.want == "" {
+				if err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("got %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
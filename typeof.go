@@ -0,0 +1,217 @@
+// typeof.go
+// 式の型の推定
+
+package main
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// typeOf は変数名とその型 vars のもとで式 expr の型を推定する関数。
+// SMT LIB Language への変換で、フィールドの参照など型によって変換先が変わる式に使う。
+// 型がわからないときは nil を返す。
+func typeOf(vars map[string]ast.Expr, expr ast.Expr) (r ast.Expr) {
+	switch expr.(type) {
+	case *ast.Ident:
+		ident := expr.(*ast.Ident)
+		switch ident.Name {
+		case "true", "false":
+			r = ast.NewIdent("bool")
+		case "nil":
+			// 型が定まらない
+		default:
+			r = vars[ident.Name]
+			if r == nil {
+				// パッケージレベルの定数と変数。const.go 参照。
+				r = pkgType(vars, ident.Name)
+			}
+		}
+	case *ast.BasicLit:
+		switch expr.(*ast.BasicLit).Kind {
+		case token.INT:
+			r = ast.NewIdent("int")
+		case token.STRING:
+			r = ast.NewIdent("string")
+		case token.CHAR:
+			r = ast.NewIdent("rune")
+		case token.FLOAT:
+			r = ast.NewIdent("float64")
+		}
+		if name := floatLits[expr.(*ast.BasicLit)]; name != "" {
+			r = ast.NewIdent(name)
+		}
+	case *ast.ParenExpr:
+		r = typeOf(vars, expr.(*ast.ParenExpr).X)
+	case *ast.SelectorExpr:
+		se := expr.(*ast.SelectorExpr)
+		_, st := structOf(typeOf(vars, se.X))
+		if st != nil {
+			r = fieldType(st, se.Sel.Name)
+		}
+	case *ast.IndexExpr:
+		ie := expr.(*ast.IndexExpr)
+		x := typeOf(vars, ie.X)
+		if at, ok := underlying(x).(*ast.ArrayType); ok {
+			r = at.Elt
+		} else if mt := mapTypeOf(x); mt != nil {
+			r = mt.Value
+		} else if convType(x) == "String" {
+			r = ast.NewIdent("byte")
+		}
+	case *ast.CompositeLit:
+		r = expr.(*ast.CompositeLit).Type
+	case *ast.BinaryExpr:
+		be := expr.(*ast.BinaryExpr)
+		switch be.Op {
+		case token.LAND, token.LOR, token.EQL, token.NEQ, token.LSS, token.GTR, token.LEQ, token.GEQ:
+			r = ast.NewIdent("bool")
+		default:
+			// 1 + x のような型のない定数との演算は他方のオペランドの型とする
+			r = typeOf(vars, be.X)
+			if r == nil || isNumLit(be.X) {
+				if t := typeOf(vars, be.Y); t != nil {
+					r = t
+				}
+			}
+		}
+	case *ast.StarExpr:
+		// *p の型は p の指す先の型
+		r = pointee(typeOf(vars, expr.(*ast.StarExpr).X))
+	case *ast.UnaryExpr:
+		ue := expr.(*ast.UnaryExpr)
+		switch ue.Op {
+		case token.NOT:
+			r = ast.NewIdent("bool")
+		case token.AND:
+			if t := typeOf(vars, ue.X); t != nil {
+				r = &ast.StarExpr{X: t}
+			}
+		default:
+			r = typeOf(vars, ue.X)
+		}
+	case *ast.CallExpr:
+		ce := expr.(*ast.CallExpr)
+		if name, ok := isStringsCall(ce); ok {
+			r = ast.NewIdent(stringsFuncs[name].result)
+			break
+		}
+		if name, ok := isMathCall(ce); ok {
+			r = ast.NewIdent(mathFuncs[name])
+			break
+		}
+		ident, ok := ce.Fun.(*ast.Ident)
+		if !ok {
+			break
+		}
+		switch ident.Name {
+		case "Implies", "ForAll", "Exists", "ForAllIn", "ExistsIn", "Identical", "HasKey":
+			r = ast.NewIdent("bool")
+		case "Let":
+			// Let(x, e, body) の body の型
+			x := ce.Args[0].(*ast.Ident)
+			r = typeOf(bindVar(vars, x.Name, typeOf(vars, ce.Args[1])), ce.Args[2])
+		case "len":
+			r = ast.NewIdent("int")
+		case "int", "byte", "rune", "float64", "float32":
+			r = ast.NewIdent(ident.Name)
+		case "new":
+			r = &ast.StarExpr{X: ce.Args[0]}
+		case "make":
+			r = ce.Args[0]
+		case "Store", "Delete":
+			r = typeOf(vars, ce.Args[0])
+		case "Select":
+			x := typeOf(vars, ce.Args[0])
+			if at, ok := underlying(x).(*ast.ArrayType); ok {
+				r = at.Elt
+			} else if mt := mapTypeOf(x); mt != nil {
+				r = mt.Value
+			}
+		default:
+			if pf := pureTab[ident.Name]; pf != nil {
+				r = pf.result
+			}
+		}
+	}
+	return
+}
+
+// bindVar は変数名とその型の表に変数 name を追加した新しい表を返す関数。元の表は変更しない。
+func bindVar(vars map[string]ast.Expr, name string, typ ast.Expr) (r map[string]ast.Expr) {
+	r = map[string]ast.Expr{}
+	for k, v := range vars {
+		r[k] = v
+	}
+	r[name] = typ
+	return
+}
+
+// underlying はファイルで宣言されている型名をたどって型の定義を取得する関数。
+// 宣言されていない型名 (int など) のときはそのまま返す。
+func underlying(typ ast.Expr) (r ast.Expr) {
+	r = typ
+	for i := 0; i < 100; i++ { // 循環した宣言に対する念のための上限
+		ident, ok := r.(*ast.Ident)
+		if !ok {
+			return
+		}
+		def, ok := lookupType(ident.Name)
+		if !ok {
+			return
+		}
+		r = def
+	}
+	return
+}
+
+// structOf は型が構造体型のとき、その構造体型の名前と定義を取得する関数。
+// type P Point のように別の構造体型から宣言された型は、元の構造体型とする。
+// 構造体型でないとき、および名前のない構造体型のときは st に nil を返す。
+func structOf(typ ast.Expr) (name string, st *ast.StructType) {
+	for i := 0; i < 100; i++ { // 循環した宣言に対する念のための上限
+		ident, ok := typ.(*ast.Ident)
+		if !ok {
+			return
+		}
+		def, ok := lookupType(ident.Name)
+		if !ok {
+			return
+		}
+		if st, ok = def.(*ast.StructType); ok {
+			name = ident.Name
+			return
+		}
+		typ = def
+	}
+	return
+}
+
+// structFields は構造体型のフィールド名とその型のリストを宣言順に取得する関数。
+// 埋め込みフィールドは型名をフィールド名とする。
+func structFields(st *ast.StructType) (names []string, types []ast.Expr) {
+	for _, field := range st.Fields.List {
+		if len(field.Names) == 0 {
+			names = append(names, recvTypeName(field.Type))
+			types = append(types, field.Type)
+			continue
+		}
+		for _, name := range field.Names {
+			names = append(names, name.Name)
+			types = append(types, field.Type)
+		}
+	}
+	return
+}
+
+// fieldType は構造体型のフィールドの型を取得する関数。フィールドがないときは nil を返す。
+func fieldType(st *ast.StructType, field string) (r ast.Expr) {
+	names, types := structFields(st)
+	for i, name := range names {
+		if name == field {
+			r = types[i]
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,36 @@
+// typetab.go
+// ファイルで宣言されている型の表
+
+package main
+
+import (
+	"go/ast"
+	"go/token"
+)
+
+// typeTab は型名とその型の定義の表
+var typeTab map[string]ast.Expr
+
+// loadTypeDecls はファイルのトップレベルで宣言されている型を typeTab に登録する関数
+func loadTypeDecls(fileNode *ast.File) {
+	typeTab = map[string]ast.Expr{}
+	for _, decl := range fileNode.Decls {
+		gd, ok := decl.(*ast.GenDecl)
+		if !ok || gd.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gd.Specs {
+			ts, ok := spec.(*ast.TypeSpec)
+			if !ok {
+				continue
+			}
+			typeTab[ts.Name.Name] = ts.Type
+		}
+	}
+}
+
+// lookupType は型名から型の定義を取得する関数
+func lookupType(name string) (r ast.Expr, ok bool) {
+	r, ok = typeTab[name]
+	return
+}
@@ -0,0 +1,89 @@
+// vacuity.go
+// 表明の空虚さ (vacuity) と矛盾の検査
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+)
+
+// PRE が充足不能なとき (例：x > 0 && x < 0) は、どんな関数本体でも検証できてしまう。
+// このような表明の誤りに気づけるように、検証とは別に次のことを SMT ソルバで調べ、当てはまるときは警告とする。
+//
+//	PRE が充足不能
+//	ループの INV が PRE と同時に充足不能
+//	POST が恒真 (関数本体によらず成り立つ)。ただし POST("true") は除く
+//	PRE とそれより前の受動形の仮定のもとで到達しない if 文や switch 文の分岐 (vcgen.go 参照)
+//
+// 警告は検証結果データの Warnings に格納する。
+
+// warnings は検証中の関数の表明についての警告のリスト
+var warnings []string
+
+// checkVacuity は関数の表明の空虚さと矛盾を調べて warnings に警告を追加する関数。
+// vars は関数の変数名とその型、pre と post は関数の事前・事後条件、stmts は表明文を除いた関数本体の文のリスト。
+func checkVacuity(vars map[string]ast.Expr, pre, post ast.Expr, stmts []ast.Stmt, results []ast.Expr) (err error) {
+	// PRE が充足可能
+	if !satisfiable(vars, pre) {
+		warnings = append(warnings, "PRE is unsatisfiable")
+	}
+
+	// ループの INV が PRE と同時に充足可能
+	for _, stmt := range stmts {
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			s, isFor := n.(*ast.ForStmt)
+			if !isFor {
+				return true
+			}
+			asserts, _, e := separateStmts(s.Body.List)
+			if e == nil && asserts["INV"] != nil && !satisfiable(vars, astAnd(pre, asserts["INV"])) {
+				warnings = append(warnings, fmt.Sprintf("INV of the loop%s is unsatisfiable with PRE", atLine(s.For)))
+			}
+			return true
+		})
+	}
+
+	// POST が恒真でない。POST("true") は実行時エラーなく終わることだけを検証する関数の書き方なので警告しない。
+	if !isTrueIdent(post) && !satisfiable(vars, astNot(post)) {
+		warnings = append(warnings, "POST is trivially true")
+	}
+
+	// 到達しない分岐。有界モデル検査ではループに INV がないので調べない。
+	if conf.BMC > 0 {
+		return
+	}
+	var pv *passive
+	pv, err = passiveGoals(vars, stmts, post, results)
+	if err != nil {
+		return
+	}
+	for _, b := range pv.branches {
+		if isFalseIdent(b.reach) {
+			continue
+		}
+		// PRE と分岐より前の仮定のもとで到達条件が成り立ちうるか
+		reach := astNot(pv.vcAt(pre, b.nhyps, astNot(b.reach)))
+		if !satisfiable(pv.vars, reach) {
+			warnings = append(warnings, fmt.Sprintf("dead branch: %s%s", b.what, atLine(b.pos)))
+		}
+	}
+	return
+}
+
+// satisfiable は条件式 cond が充足可能かどうかを SMT ソルバで調べる関数。
+// ソルバが充足不能と答えたときだけ false を返し、判定できないときは警告しないように true を返す。
+func satisfiable(vars map[string]ast.Expr, cond ast.Expr) (ok bool) {
+	result, _, err := checkCond(vars, cond)
+	ok = err != nil || result != "unsat"
+	return
+}
+
+// atLine は位置 pos の行番号を表す文字列を作成する関数。位置がわからないときは空文字列とする。
+func atLine(pos token.Pos) (r string) {
+	if pos.IsValid() && fset != nil {
+		r = fmt.Sprintf(" at line %d", fset.Position(pos).Line)
+	}
+	return
+}
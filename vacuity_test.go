@@ -0,0 +1,166 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// 到達しない分岐の警告
+
+const stopSrc = `
+func stop() (z int) {
+	PRE("true")
+	for {
+		INV("true")
+	}
+	POST("false")
+	return
+}
+`
+
+func TestDeadBranch(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		funcs []string
+		dead  []string
+	}{
+		{
+			name: "infeasible condition",
+			src: `package main
+
+func h(x int) (r int) {
+	PRE("true")
+	r = 0
+	if x > 0 && x < 0 {
+		r = 1
+	}
+	POST("r == 0")
+	return
+}
+`,
+			funcs: []string{"h"},
+			dead:  []string{"then branch of if x > 0 && x < 0"},
+		},
+		{
+			// 分岐のあとの呼び出しで仮定する POST は分岐の到達可能性に使わない
+			name: "before call",
+			src: `package main
+` + stopSrc + `
+func h(x int) (r int) {
+	PRE("true")
+	if x > 0 {
+		r = 1
+	} else {
+		r = 2
+	}
+	r = stop()
+	POST("true")
+	return
+}
+`,
+			funcs: []string{"stop", "h"},
+		},
+		{
+			// 分岐のあとのループの先頭で仮定する INV は分岐の到達可能性に使わない
+			name: "before loop",
+			src: `package main
+
+func h(x int) (r int) {
+	PRE("true")
+	switch {
+	case x > 0:
+		r = 1
+	default:
+		r = 2
+	}
+	i := 0
+	for i < 0 {
+		INV("i == 0 && x == 100")
+		i = i + 1
+	}
+	POST("true")
+	return
+}
+`,
+			funcs: []string{"h"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verifyFuncs(t, "passive", tt.src, tt.funcs...)
+			var dead []string
+			for _, w := range warnings {
+				if strings.HasPrefix(w, "dead branch: ") {
+					dead = append(dead, w)
+				}
+			}
+			if len(dead) != len(tt.dead) {
+				t.Fatalf("dead branches: got %q, want %q", dead, tt.dead)
+			}
+			for i, want := range tt.dead {
+				if !strings.Contains(dead[i], want) {
+					t.Errorf("dead branch: got %q, want %q", dead[i], want)
+				}
+			}
+		})
+	}
+}
+
+// PRE の充足不能、PRE と同時に充足不能な INV、恒真の POST は警告になり、検証結果データに格納される
+func TestVacuity(t *testing.T) {
+	tests := []struct {
+		name     string
+		pre      string
+		inv      string
+		post     string
+		ng       bool // INV がループに入る時点で成り立たず、検証できない
+		warnings []string
+	}{
+		{name: "none", pre: "n >= 0", inv: "0 <= i && i <= n && r == i", post: "r == n"},
+		{name: "unsatisfiable PRE", pre: "n > 0 && n < 0", inv: "0 <= i && i <= n && r == i", post: "r == n",
+			warnings: []string{"PRE is unsatisfiable", "INV of the loop at line 7 is unsatisfiable with PRE"}},
+		{name: "unsatisfiable INV", pre: "n >= 0", inv: "i < 0 && i >= 0", post: "r == n", ng: true,
+			warnings: []string{"INV of the loop at line 7 is unsatisfiable with PRE"}},
+		{name: "trivial POST", pre: "n >= 0", inv: "0 <= i && i <= n && r == i", post: "r == r || n >= 0",
+			warnings: []string{"POST is trivially true"}},
+		{name: "POST true", pre: "n >= 0", inv: "0 <= i && i <= n && r == i", post: "true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := fmt.Sprintf(`package main
+
+func f(n int) (r int) {
+	PRE("%s")
+	i := 0
+	r = 0
+	for i < n {
+		INV("%s")
+		i = i + 1
+		r = r + 1
+	}
+	POST("%s")
+	return
+}
+`, tt.pre, tt.inv, tt.post)
+			err := verifyFuncs(t, "wp", src, "f")
+			if tt.ng != (err != nil) {
+				t.Fatalf("got %v", err)
+			}
+			got := warnings
+			if !tt.ng && !reflect.DeepEqual(funcTab["f"].Warnings, got) {
+				t.Errorf("Warnings: got %q, want %q", funcTab["f"].Warnings, got)
+			}
+			if len(got) != len(tt.warnings) {
+				t.Fatalf("warnings: got %q, want %q", got, tt.warnings)
+			}
+			for i, want := range tt.warnings {
+				if got[i] != want {
+					t.Errorf("warning: got %q, want %q", got[i], want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,1232 @@
+// vcgen.go
+// 受動形 (passive form) による検証条件の生成
+
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"os"
+	"sort"
+)
+
+// wp.go の最弱事前条件では、if 文ごとに事後条件が両方の分岐に複製され、
+// 代入ごとに式全体を置換で作り直すので、if 文が続くと検証条件が指数的に大きくなる。
+//
+// ここでは Flanagan & Saxe の方法にならって、関数本体を静的単一代入 (SSA) の受動形に変換する。
+// 代入 x = e は新しい版の変数 x@1 の定義になり、プログラムの各地点には到達条件を与える。
+// 合流点では分岐ごとの版を新しい版の変数にまとめ、ループは INV を使って切断する。
+// 定義と到達条件は SMT-LIB の let で共有するので、検証条件の大きさは関数の大きさに比例する。
+//
+// 仮定 (ループの先頭の INV や呼び出し先の POST) と証明すべき条件は、変換した順に入れ子にする。
+// 証明すべき条件は、それより前に加えた仮定だけのもとで証明する。
+// あとで仮定する事実 (例：ループに入ったあとの INV) を使って、その前の条件 (例：ループに入る時点の INV) を証明してはならない。
+//
+//   Let(x@1, e1, Let(reach@1, c, ... Implies(PRE, 条件1 && Implies(仮定1, 条件2 && Implies(仮定2, ...)))))
+
+// pState は受動形への変換中の、プログラムのある地点での状態
+type pState struct {
+	reach ast.Expr            // その地点の到達条件
+	env   map[string]ast.Expr // 変数名とその地点での版の Ident
+}
+
+// copy は環境を複製した状態を返す関数
+func (st pState) copy() (r pState) {
+	r.reach = st.reach
+	r.env = map[string]ast.Expr{}
+	for name, v := range st.env {
+		r.env[name] = v
+	}
+	return
+}
+
+// pExits は break/continue で抜けるときの状態の格納先。nil のときはその文脈では抜けられない。
+type pExits struct {
+	brk  *[]pState
+	cont *[]pState
+}
+
+// pGoal は証明すべき条件
+type pGoal struct {
+	reach ast.Expr     // 到達条件
+	cond  ast.Expr     // 条件式
+	what  string       // 条件の説明
+	loop  *ast.ForStmt // ループの INV の条件のときはそのループ。infer.go 参照。
+	nhyps int          // この条件より前に加えた仮定の数
+}
+
+// passive は受動形への変換の状態
+type passive struct {
+	types    map[string]ast.Expr   // プログラムの変数名とその型
+	vars     map[string]ast.Expr   // SMT の定数として宣言する変数名とその型
+	binds    [][2]ast.Expr         // let で束縛する名前と式の列
+	hyps     []ast.Expr            // 仮定のリスト
+	goals    []pGoal               // 証明すべき条件のリスト
+	count    map[string]int        // 名前ごとの版の番号
+	scopes   []map[string]ast.Expr // ブロックごとに := で宣言した変数の外側の版
+	post     ast.Expr              // 関数の POST
+	results  []ast.Expr            // 名前付き結果パラメータ
+	branches []pBranch             // if 文と switch 文の分岐。vacuity.go 参照。
+}
+
+// pBranch は if 文や switch 文の分岐に入る地点
+type pBranch struct {
+	reach ast.Expr  // 分岐に入る地点の到達条件
+	pos   token.Pos // 分岐の位置
+	what  string    // 分岐の説明
+	nhyps int       // 分岐に入る地点より前に加えた仮定の数
+}
+
+// passiveCond は受動形により関数本体の検証条件を作成する関数。
+// 検証条件は Not をとったものひとつだけを返す。
+// vars は関数の変数名とその型、stmts は表明文を除いた関数本体の文のリスト。
+// smtVars には SMT の定数として宣言すべき変数名とその型が返る。
+func passiveCond(vars map[string]ast.Expr, stmts []ast.Stmt, preCond, postCond ast.Expr, results []ast.Expr) (r []ast.Expr, smtVars map[string]ast.Expr, err error) {
+	var pv *passive
+	pv, err = passiveGoals(vars, stmts, postCond, results)
+	if err != nil {
+		return
+	}
+
+	vc := pv.vc(preCond)
+	if conf.Debug {
+		fmt.Print("#passiveCond: vc: ")
+		format.Node(os.Stdout, token.NewFileSet(), vc)
+		fmt.Println("")
+	}
+
+	r = append(r, astNot(vc))
+	smtVars = pv.vars
+	return
+}
+
+// passiveGoals は関数本体を受動形に変換し、証明すべき条件と仮定を集めた変換の状態を作成する関数
+func passiveGoals(vars map[string]ast.Expr, stmts []ast.Stmt, postCond ast.Expr, results []ast.Expr) (pv *passive, err error) {
+	var st pState
+	pv, st = newPassive(vars, postCond, results)
+	st, err = pv.stmts(st, stmts, pExits{})
+	if err != nil {
+		return
+	}
+
+	// 末尾まで実行したときも POST が成り立つ
+	var post ast.Expr
+	post, err = pv.rename(st, postCond)
+	if err != nil {
+		return
+	}
+	pv.goal(st, post, "POST")
+	return
+}
+
+// newPassive は受動形への変換の状態と、関数の入口の状態を作成する関数
+func newPassive(vars map[string]ast.Expr, postCond ast.Expr, results []ast.Expr) (pv *passive, st pState) {
+	pv = &passive{
+		types:   vars,
+		vars:    map[string]ast.Expr{},
+		count:   map[string]int{},
+		post:    postCond,
+		results: results,
+	}
+
+	// 関数の入口での版は元の変数名そのものとする。PRE はそのまま使える。
+	st = pState{
+		reach: ast.NewIdent("true"),
+		env:   map[string]ast.Expr{},
+	}
+	for name, typ := range vars {
+		pv.vars[name] = typ
+		st.env[name] = ast.NewIdent(name)
+	}
+	return
+}
+
+// vc は変換結果から検証条件を組み立てる関数。
+// 証明すべき条件は、その前に加えた仮定の数ごとにまとめ、後ろの仮定から順に内側に入れ子にする。
+func (pv *passive) vc(preCond ast.Expr) (r ast.Expr) {
+	goals := make([][]ast.Expr, len(pv.hyps)+1)
+	for _, g := range pv.goals {
+		if conf.Debug {
+			fmt.Print("#passive: goal: ", g.what, ": ")
+			format.Node(os.Stdout, token.NewFileSet(), g.cond)
+			fmt.Println("")
+		}
+		if isFalseIdent(g.reach) {
+			// 到達しない地点の条件は証明する必要がない
+			continue
+		}
+		if isTrueIdent(g.reach) {
+			goals[g.nhyps] = append(goals[g.nhyps], g.cond)
+		} else {
+			goals[g.nhyps] = append(goals[g.nhyps], astImplies(g.reach, g.cond))
+		}
+	}
+	for n := len(pv.hyps); n >= 0; n-- {
+		if n < len(pv.hyps) && r != nil {
+			r = astImplies(pv.hyps[n], r)
+		}
+		if len(goals[n]) > 0 && r != nil {
+			r = astAnds(append(goals[n], r)...)
+		} else if len(goals[n]) > 0 {
+			r = astAnds(goals[n]...)
+		}
+	}
+	if r == nil {
+		r = ast.NewIdent("true")
+	}
+	r = pv.vcAt(preCond, 0, r)
+	return
+}
+
+// vcAt は最初の n 個の仮定と PRE のもとで条件 goal が成り立つという検証条件を組み立てる関数
+func (pv *passive) vcAt(preCond ast.Expr, n int, goal ast.Expr) (r ast.Expr) {
+	r = goal
+	if n > 0 {
+		r = astImplies(astAnds(pv.hyps[:n]...), r)
+	}
+	r = astImplies(preCond, r)
+
+	// 定義を内側から順に let で束縛する
+	for i := len(pv.binds) - 1; i >= 0; i-- {
+		r = astLet(pv.binds[i][0], pv.binds[i][1], r)
+	}
+	return
+}
+
+// fresh は名前 base の新しい版の Ident を作成する関数。例：x => x@1
+func (pv *passive) fresh(base string) (r *ast.Ident) {
+	pv.count[base]++
+	r = ast.NewIdent(fmt.Sprintf("%s@%d", base, pv.count[base]))
+	return
+}
+
+// bind は式 expr に名前 base の新しい版の名前をつけて let で束縛する関数
+func (pv *passive) bind(base string, expr ast.Expr) (r *ast.Ident) {
+	r = pv.fresh(base)
+	pv.binds = append(pv.binds, [2]ast.Expr{r, expr})
+	return
+}
+
+// declare は変数 name の新しい版を、値を定めない SMT の定数として宣言する関数
+func (pv *passive) declare(name string) (r *ast.Ident) {
+	r = pv.fresh(name)
+	pv.vars[r.Name] = pv.types[name]
+	return
+}
+
+// goal は状態 st で証明すべき条件 cond を追加する関数。cond は版の名前に置換済みのもの。
+func (pv *passive) goal(st pState, cond ast.Expr, what string) {
+	pv.goals = append(pv.goals, pGoal{reach: st.reach, cond: cond, what: what, nhyps: len(pv.hyps)})
+}
+
+// invGoal はループ loop の INV を状態 st で証明すべき条件として追加する関数
+func (pv *passive) invGoal(st pState, cond ast.Expr, what string, loop *ast.ForStmt) {
+	pv.goals = append(pv.goals, pGoal{reach: st.reach, cond: cond, what: what, loop: loop, nhyps: len(pv.hyps)})
+}
+
+// indexGoal は状態 st で式 exprs を評価するときの文字列の添字が範囲内であることを証明すべき条件として追加する関数。str.go 参照。
+func (pv *passive) indexGoal(st pState, exprs ...ast.Expr) (err error) {
+	c := indexChecks(pv.types, exprs...)
+	if c == nil {
+		return
+	}
+	c, err = pv.rename(st, c)
+	if err != nil {
+		return
+	}
+	pv.goal(st, c, "index in range")
+	return
+}
+
+// hyp は状態 st に到達したときに成り立つ事実 fact を仮定に追加する関数。fact は版の名前に置換済みのもの。
+func (pv *passive) hyp(st pState, fact ast.Expr) {
+	if isFalseIdent(st.reach) {
+		return
+	}
+	if isTrueIdent(st.reach) {
+		pv.hyps = append(pv.hyps, fact)
+	} else {
+		pv.hyps = append(pv.hyps, astImplies(st.reach, fact))
+	}
+}
+
+// assume は状態 st で条件 cond が成り立つ場合の状態を作成する関数
+func (pv *passive) assume(st pState, cond ast.Expr) (r pState) {
+	r = st.copy()
+	if isFalseIdent(st.reach) {
+		return
+	}
+	if isTrueIdent(st.reach) {
+		r.reach = pv.bind("reach", cond)
+	} else {
+		r.reach = pv.bind("reach", astAnd(st.reach, cond))
+	}
+	return
+}
+
+// rename は式 expr の中の変数を状態 st での版に置換する関数
+func (pv *passive) rename(st pState, expr ast.Expr) (r ast.Expr, err error) {
+	var vs, es []ast.Expr
+	for name, v := range st.env {
+		vs = append(vs, ast.NewIdent(name))
+		es = append(es, v)
+	}
+	r, err = subst(expr, vs, es)
+	return
+}
+
+// join は合流点で複数の状態をひとつにまとめる関数。
+// 分岐によって版が異なる変数は新しい版を宣言し、分岐ごとに 到達条件 => 新しい版 == 分岐での版 を仮定する。
+func (pv *passive) join(states ...pState) (r pState) {
+	var live []pState
+	for _, st := range states {
+		if !isFalseIdent(st.reach) {
+			live = append(live, st)
+		}
+	}
+	if len(live) == 0 {
+		// どの分岐からも到達しない
+		r = states[0].copy()
+		r.reach = ast.NewIdent("false")
+		return
+	}
+	if len(live) == 1 {
+		r = live[0]
+		return
+	}
+
+	var reaches []ast.Expr
+	for _, st := range live {
+		reaches = append(reaches, st.reach)
+	}
+	r.reach = pv.bind("reach", astOrs(reaches...))
+
+	// 出力を決定的にするため変数名の順に処理する
+	var names []string
+	for name := range live[0].env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	r.env = map[string]ast.Expr{}
+	for _, name := range names {
+		v := live[0].env[name]
+		same, present := true, true
+		for _, st := range live[1:] {
+			w, ok := st.env[name]
+			if !ok {
+				// 一部の分岐にしかない変数はスコープを抜けているので捨てる
+				present = false
+				break
+			}
+			if !Equals(v, w) {
+				same = false
+			}
+		}
+		if !present {
+			continue
+		}
+		if same {
+			r.env[name] = v
+			continue
+		}
+		x := pv.declare(name)
+		for _, st := range live {
+			pv.hyp(st, astIdentical(x, st.env[name]))
+		}
+		r.env[name] = x
+	}
+	return
+}
+
+// pushScope はブロックのスコープに入る関数
+func (pv *passive) pushScope() {
+	pv.scopes = append(pv.scopes, map[string]ast.Expr{})
+}
+
+// popScope はブロックのスコープを抜ける関数。
+// ブロックの中で := 宣言された変数を外側の版に戻す。
+func (pv *passive) popScope(st *pState) {
+	scope := pv.scopes[len(pv.scopes)-1]
+	pv.scopes = pv.scopes[:len(pv.scopes)-1]
+	if st.env == nil {
+		return
+	}
+	for name, outer := range scope {
+		if outer == nil {
+			delete(st.env, name)
+		} else {
+			st.env[name] = outer
+		}
+	}
+}
+
+// define は変数 name を現在のブロックで宣言する関数。外側の版を覚えておく。
+func (pv *passive) define(st pState, name string) {
+	scope := pv.scopes[len(pv.scopes)-1]
+	if _, ok := scope[name]; ok {
+		// 同じブロックで宣言済みのときは代入と同じ
+		return
+	}
+	scope[name] = st.env[name]
+}
+
+// stmts は文のリストを受動形に変換する関数
+func (pv *passive) stmts(st pState, stmts []ast.Stmt, ex pExits) (r pState, err error) {
+	pv.pushScope()
+	r = st
+	for _, stmt := range stmts {
+		r, err = pv.stmt(r, stmt, ex)
+		if err != nil {
+			break
+		}
+	}
+	pv.popScope(&r)
+	return
+}
+
+// stmt は文を受動形に変換する関数
+func (pv *passive) stmt(st pState, stmt ast.Stmt, ex pExits) (r pState, err error) {
+	if conf.Debug {
+		fmt.Print("#passive: stmt:")
+		format.Node(os.Stdout, token.NewFileSet(), stmt)
+		fmt.Println("")
+	}
+	if err = pv.indexGoal(st, stmtExprs(stmt)...); err != nil {
+		return
+	}
+	switch stmt.(type) {
+	case *ast.AssignStmt:
+		r, err = pv.assign(st, stmt.(*ast.AssignStmt))
+	case *ast.IncDecStmt:
+		r, err = pv.assign(st, incDecAssign(stmt.(*ast.IncDecStmt)))
+	case *ast.IfStmt:
+		r, err = pv.ifStmt(st, stmt.(*ast.IfStmt), ex)
+	case *ast.ForStmt:
+		r, err = pv.forStmt(st, stmt.(*ast.ForStmt), ex)
+	case *ast.SwitchStmt:
+		r, err = pv.switchStmt(st, stmt.(*ast.SwitchStmt), ex)
+	case *ast.BlockStmt:
+		r, err = pv.stmts(st, stmt.(*ast.BlockStmt).List, ex)
+	case *ast.DeclStmt:
+		r, err = pv.declStmt(st, stmt.(*ast.DeclStmt))
+	case *ast.ReturnStmt:
+		r, err = pv.returnStmt(st, stmt.(*ast.ReturnStmt))
+	case *ast.BranchStmt:
+		r, err = pv.branchStmt(st, stmt.(*ast.BranchStmt), ex)
+	case *ast.EmptyStmt:
+		r = st
+	case *ast.ExprStmt:
+		es := stmt.(*ast.ExprStmt)
+		if tag, cond, ok := isAssertStmt(es); ok {
+			r, err = pv.assertStmt(st, tag, cond)
+			break
+		}
+		if _, ok := isReachableStmt(es); ok {
+			// 到達可能性は記号実行でだけ調べる。symexec.go 参照。
+			r = st
+			break
+		}
+		if s, ok := deleteAssign(es); ok {
+			// delete(m, k) は m = Delete(m, k) として扱う。map.go 参照。
+			r, err = pv.assign(st, s)
+			break
+		}
+		ce, ok := es.X.(*ast.CallExpr)
+		if !ok {
+			err = fmt.Errorf("passive: ExprStmt: X is unknown")
+			return
+		}
+		r, err = pv.call(st, ce)
+	default:
+		ast.Print(fset, stmt)
+		err = fmt.Errorf("passive: unknown statement")
+	}
+	return
+}
+
+// assign は代入文を受動形に変換する関数。x = e は新しい版 x@n を e で定義する。
+func (pv *passive) assign(st pState, s *ast.AssignStmt) (r pState, err error) {
+	r = st
+	s, err = normOpAssign(s)
+	if err != nil {
+		return
+	}
+	s, err = normFieldAssign(pv.types, s)
+	if err != nil {
+		return
+	}
+	s = normCommaOk(pv.types, s)
+
+	// 右辺がポインタの確保のとき
+	if len(s.Lhs) == 1 && len(s.Rhs) == 1 {
+		if typ, init, ok := allocOf(s.Rhs[0]); ok {
+			r, err = pv.alloc(st, s, typ, init)
+			return
+		}
+	}
+
+	for i, v := range s.Lhs {
+		if _, ok := v.(*ast.Ident); !ok {
+			err = fmt.Errorf("passive: AssignStmt: Lhs[%d] is not ident", i)
+			return
+		}
+	}
+
+	// 右辺が関数呼び出しひとつのとき
+	if len(s.Rhs) == 1 {
+		if ce, ok := isFunCall(s.Rhs[0]); ok {
+			r, err = pv.callAssign(st, s.Lhs, s.Tok == token.DEFINE, ce)
+			return
+		}
+	}
+	if len(s.Lhs) != len(s.Rhs) {
+		err = fmt.Errorf("passive: AssignStmt: len(Lhs) != len(Rhs)")
+		return
+	}
+
+	// 右辺はすべて代入前の版で評価する
+	es := make([]ast.Expr, len(s.Rhs))
+	for i, e := range s.Rhs {
+		if _, ok := isFunCall(e); ok {
+			err = fmt.Errorf("multi assignment of FunCall is not supported")
+			return
+		}
+		if ce, ok := hasFunCall(e); ok {
+			err = fmt.Errorf("passive: AssignStmt: FunCall %s in an expression is not supported", nodeString(ce))
+			return
+		}
+		es[i], err = pv.rename(st, e)
+		if err != nil {
+			return
+		}
+	}
+
+	for i, v := range s.Lhs {
+		name := v.(*ast.Ident).Name
+		if name == "_" {
+			continue
+		}
+		if s.Tok == token.DEFINE {
+			pv.define(r, name)
+		}
+		r.env[name] = pv.bind(name, es[i])
+	}
+	return
+}
+
+// alloc はポインタの確保 p = &T{...} を受動形に変換する関数。
+// p の新しい版を値を定めない定数とし、それが nil でなく未確保であることを仮定して、確保と初期値の書き込みを定義する。
+func (pv *passive) alloc(st pState, s *ast.AssignStmt, typ, init ast.Expr) (r pState, err error) {
+	r = st
+	ident, ok := s.Lhs[0].(*ast.Ident)
+	if !ok {
+		err = fmt.Errorf("passive: AssignStmt: allocation to non-variable is not supported")
+		return
+	}
+	var h *ast.Ident
+	h, err = heapRef(pv.types, typ)
+	if err != nil {
+		return
+	}
+	init, err = pv.rename(st, init)
+	if err != nil {
+		return
+	}
+	a := st.env[allocName]
+	if pv.types[ident.Name] == nil {
+		pv.types[ident.Name] = &ast.StarExpr{X: typ}
+	}
+	l := pv.declare(ident.Name)
+	pv.hyp(st, astAnd(
+		&ast.BinaryExpr{X: l, Op: token.NEQ, Y: &ast.BasicLit{Kind: token.INT, Value: "0"}},
+		astNot(&ast.IndexExpr{X: a, Index: l})))
+	r.env[allocName] = pv.bind(allocName, astStore(a, l, ast.NewIdent("true")))
+	r.env[h.Name] = pv.bind(h.Name, astStore(st.env[h.Name], l, init))
+	if s.Tok == token.DEFINE {
+		pv.define(r, ident.Name)
+	}
+	r.env[ident.Name] = l
+	return
+}
+
+// heapCall は関数呼び出しによるヒープの変化を受動形に変換する関数。
+// 呼び出し側がヒープを使うときは、呼び出しのあとのヒープを値を定めない新しい版とし、
+// 呼び出し先の MODIFIES 以外の確保済みの場所が変わらないことを仮定する。
+// olds と news には呼び出しの前と後のヒープの変数の版が返る。ヒープを使わないときは nil。
+func (pv *passive) heapCall(st pState, funData Data, args []ast.Expr) (olds, news map[string]ast.Expr, err error) {
+	names := heapVarNames(pv.types)
+	if len(names) == 0 {
+		return
+	}
+	olds = map[string]ast.Expr{}
+	news = map[string]ast.Expr{}
+	for _, name := range names {
+		olds[name] = st.env[name]
+		news[name] = pv.declare(name)
+	}
+	var frame ast.Expr
+	frame, err = funData.heapFrame(pv.types, args, olds, news)
+	if err != nil {
+		return
+	}
+	pv.hyp(st, frame)
+	return
+}
+
+// mapCall は呼び出し先が変更しうるマップの実引数の変数 (changedMapArgs) を、状態 st からの呼び出しのあとの状態 r で
+// 値を定めない新しい版にする関数。args は版の名前に置換する前の実引数。マップの要素数は 0 以上とする。map.go 参照。
+func (pv *passive) mapCall(st, r pState, funData Data, args []ast.Expr) {
+	for _, x := range changedMapArgs(pv.types, funData, args) {
+		if _, ok := r.env[x.Name]; !ok {
+			continue
+		}
+		v := pv.declare(x.Name)
+		if fact := mapLenFact(pv.types[x.Name], v); fact != nil {
+			pv.hyp(st, fact)
+		}
+		r.env[x.Name] = v
+	}
+}
+
+// callAssign は関数の結果を変数に代入する文 x = f(a) を受動形に変換する関数。
+// 呼び出し先の事前条件を証明すべき条件とし、結果を新しい版の定数として事後条件を仮定する。
+func (pv *passive) callAssign(st pState, lhs []ast.Expr, define bool, ce *ast.CallExpr) (r pState, err error) {
+	r = st
+	var funData Data
+	var args []ast.Expr
+	funData, args, err = getCallData(pv.types, ce)
+	if err != nil {
+		return
+	}
+	if err = pv.termCall(st, funData, args); err != nil {
+		return
+	}
+	_, oParams, _, oTypes := funData.getParams()
+	if len(lhs) != len(oParams) {
+		err = fmt.Errorf("passive: len(Lhs) != len(oParams)")
+		return
+	}
+	orig := args
+
+	args, err = pv.renameList(st, args)
+	if err != nil {
+		return
+	}
+
+	// 関数の結果を表す新しい版の定数
+	outs := make([]ast.Expr, len(lhs))
+	for i, v := range lhs {
+		name := v.(*ast.Ident).Name
+		u := pv.fresh(name)
+		pv.vars[u.Name] = oTypes[i]
+		outs[i] = u
+	}
+
+	var olds, news map[string]ast.Expr
+	olds, news, err = pv.heapCall(st, funData, args)
+	if err != nil {
+		return
+	}
+
+	var pre, post ast.Expr
+	pre, post, err = funData.instAsserts(args, outs, olds, news)
+	if err != nil {
+		return
+	}
+	pv.goal(st, pre, "PRE of "+funData.Name)
+	pv.hyp(st, post)
+	if news != nil {
+		pv.hyp(st, allocated(outs, oTypes, news[allocName]))
+	}
+	for name, h := range news {
+		r.env[name] = h
+	}
+	pv.mapCall(st, r, funData, orig)
+
+	for i, v := range lhs {
+		name := v.(*ast.Ident).Name
+		if name == "_" {
+			continue
+		}
+		if define {
+			pv.define(r, name)
+		}
+		r.env[name] = outs[i]
+	}
+	return
+}
+
+// termCall は再帰呼び出しで減少量が小さくなることを証明すべき条件とする関数。termination.go 参照。
+func (pv *passive) termCall(st pState, funData Data, args []ast.Expr) (err error) {
+	var dec ast.Expr
+	dec, err = term.call(funData, args)
+	if err != nil || dec == nil {
+		return
+	}
+	dec, err = pv.rename(st, dec)
+	if err != nil {
+		return
+	}
+	pv.goal(st, dec, "DECREASES of "+funData.Name)
+	return
+}
+
+// call は代入のない関数呼び出し f(a) を受動形に変換する関数
+func (pv *passive) call(st pState, ce *ast.CallExpr) (r pState, err error) {
+	r = st
+	if isIgnoredCall(pv.types, ce) {
+		return
+	}
+
+	var funData Data
+	var args []ast.Expr
+	funData, args, err = getCallData(pv.types, ce)
+	if err != nil {
+		return
+	}
+	if err = pv.termCall(st, funData, args); err != nil {
+		return
+	}
+	orig := args
+	args, err = pv.renameList(st, args)
+	if err != nil {
+		return
+	}
+	var olds, news map[string]ast.Expr
+	olds, news, err = pv.heapCall(st, funData, args)
+	if err != nil {
+		return
+	}
+
+	var pre, post ast.Expr
+	pre, post, err = funData.instAsserts(args, nil, olds, news)
+	if err != nil {
+		return
+	}
+	pv.goal(st, pre, "PRE of "+funData.Name)
+	if news != nil {
+		// ヒープが変わるときは事後条件も仮定する
+		pv.hyp(st, post)
+		for name, h := range news {
+			r.env[name] = h
+		}
+	}
+	pv.mapCall(st, r, funData, orig)
+	return
+}
+
+// renameList は式のリストの中の変数を状態 st での版に置換する関数
+func (pv *passive) renameList(st pState, exprs []ast.Expr) (r []ast.Expr, err error) {
+	for _, e := range exprs {
+		var x ast.Expr
+		x, err = pv.rename(st, e)
+		if err != nil {
+			return
+		}
+		r = append(r, x)
+	}
+	return
+}
+
+// declStmt は変数宣言と定数宣言を受動形に変換する関数。
+// 宣言は宣言される名前への := の代入とし、ゼロ値を式で表せない変数は値を定めない新しい版とする。wp.go の declAssigns 参照。
+func (pv *passive) declStmt(st pState, ds *ast.DeclStmt) (r pState, err error) {
+	r = st
+	var as []*ast.AssignStmt
+	var free []*ast.Ident
+	as, free, err = declAssigns(pv.types, ds)
+	if err != nil {
+		return
+	}
+	for _, name := range free {
+		pv.define(r, name.Name)
+		r.env[name.Name] = pv.declare(name.Name)
+	}
+	for _, s := range as {
+		r, err = pv.assign(r, s)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// returnStmt は return 文を受動形に変換する関数。
+// 戻り値を名前付き結果パラメータに代入したうえで POST を証明すべき条件とし、以降の地点には到達しない。
+func (pv *passive) returnStmt(st pState, s *ast.ReturnStmt) (r pState, err error) {
+	if len(s.Results) > 0 && len(pv.results) > 0 {
+		if len(s.Results) != 1 && len(s.Results) != len(pv.results) {
+			err = fmt.Errorf("passive: len(Results) != len(named results)")
+			return
+		}
+		as := &ast.AssignStmt{
+			Lhs: pv.results,
+			Tok: token.ASSIGN,
+			Rhs: s.Results,
+		}
+		st, err = pv.assign(st, as)
+		if err != nil {
+			return
+		}
+	}
+	var post ast.Expr
+	post, err = pv.rename(st, pv.post)
+	if err != nil {
+		return
+	}
+	pv.goal(st, post, "POST")
+
+	r = st.copy()
+	r.reach = ast.NewIdent("false")
+	return
+}
+
+// assertStmt は文の途中の表明文を受動形に変換する関数。
+// ASSERT(c) は c を証明すべき条件とし、以降の地点では c を仮定する。
+// ASSUME(c) は以降の地点の到達条件に c を加える。それより前の地点の条件には影響しない。
+func (pv *passive) assertStmt(st pState, tag string, cond ast.Expr) (r pState, err error) {
+	r = st
+	if !isMidAssert(tag) {
+		err = fmt.Errorf("passive: %s is not allowed here", tag)
+		return
+	}
+	var c ast.Expr
+	c, err = pv.rename(st, cond)
+	if err != nil {
+		return
+	}
+	if tag == "ASSERT" {
+		pv.goal(st, c, "ASSERT")
+	}
+	r = pv.assume(st, c)
+	return
+}
+
+// branchStmt は break 文および continue 文を受動形に変換する関数。
+// 抜ける先に状態を渡し、以降の地点には到達しない。
+func (pv *passive) branchStmt(st pState, s *ast.BranchStmt, ex pExits) (r pState, err error) {
+	if s.Label != nil {
+		err = fmt.Errorf("passive: labeled %s is not supported", s.Tok)
+		return
+	}
+	var exit *[]pState
+	switch s.Tok {
+	case token.BREAK:
+		exit = ex.brk
+	case token.CONTINUE:
+		exit = ex.cont
+	default:
+		err = fmt.Errorf("passive: %s is not supported", s.Tok)
+		return
+	}
+	if exit == nil {
+		err = fmt.Errorf("passive: %s is not in a loop", s.Tok)
+		return
+	}
+	*exit = append(*exit, st.copy())
+
+	r = st.copy()
+	r.reach = ast.NewIdent("false")
+	return
+}
+
+// ifStmt は if 文を受動形に変換する関数
+func (pv *passive) ifStmt(st pState, s *ast.IfStmt, ex pExits) (r pState, err error) {
+	pv.pushScope()
+	defer pv.popScope(&r)
+
+	if s.Init != nil {
+		st, err = pv.stmt(st, s.Init, ex)
+		if err != nil {
+			return
+		}
+	}
+	if err = pv.indexGoal(st, s.Cond); err != nil {
+		return
+	}
+	var cond ast.Expr
+	cond, err = pv.rename(st, s.Cond)
+	if err != nil {
+		return
+	}
+
+	var thenSt, elseSt pState
+	thenSt = pv.assume(st, cond)
+	nhyps := len(pv.hyps)
+	pv.branches = append(pv.branches, pBranch{reach: thenSt.reach, pos: s.If, what: "then branch of if " + nodeString(s.Cond), nhyps: nhyps})
+	thenSt, err = pv.stmts(thenSt, s.Body.List, ex)
+	if err != nil {
+		return
+	}
+	elseSt = pv.assume(st, astNot(cond))
+	if s.Else != nil {
+		pv.branches = append(pv.branches, pBranch{reach: elseSt.reach, pos: s.If, what: "else branch of if " + nodeString(s.Cond), nhyps: nhyps})
+		elseSt, err = pv.stmt(elseSt, s.Else, ex)
+		if err != nil {
+			return
+		}
+	}
+	r = pv.join(thenSt, elseSt)
+	return
+}
+
+// switchStmt は switch 文を受動形に変換する関数。
+// case 節を上から順に判定し、fallthrough で終わる節は次の節の本体に合流する。
+func (pv *passive) switchStmt(st pState, s *ast.SwitchStmt, ex pExits) (r pState, err error) {
+	if _, ok := hasFunCall(s.Tag); ok {
+		err = fmt.Errorf("passive: Tag of function call is not supported")
+		return
+	}
+
+	pv.pushScope()
+	defer pv.popScope(&r)
+
+	if s.Init != nil {
+		st, err = pv.stmt(st, s.Init, ex)
+		if err != nil {
+			return
+		}
+	}
+
+	// 各節に入る状態。rest はそれまでのどの case 節にも当てはまらない状態。
+	n := len(s.Body.List)
+	entries := make([]pState, n)
+	defaultIdx := -1
+	rest := st
+	for i, stmt := range s.Body.List {
+		cc, ok := stmt.(*ast.CaseClause)
+		if !ok {
+			err = fmt.Errorf("passive: Body.List[%d] is not CaseClause", i)
+			return
+		}
+		if cc.List == nil {
+			defaultIdx = i
+			continue
+		}
+		if err = pv.indexGoal(rest, caseCond(s.Tag, cc.List)); err != nil {
+			return
+		}
+		var cond ast.Expr
+		cond, err = pv.rename(st, caseCond(s.Tag, cc.List))
+		if err != nil {
+			return
+		}
+		entries[i] = pv.assume(rest, cond)
+		rest = pv.assume(rest, astNot(cond))
+		pv.branches = append(pv.branches, pBranch{reach: entries[i].reach, pos: cc.Case, what: "case " + nodeString(caseCond(s.Tag, cc.List)), nhyps: len(pv.hyps)})
+	}
+	if defaultIdx >= 0 {
+		entries[defaultIdx] = rest
+		pv.branches = append(pv.branches, pBranch{reach: rest.reach, pos: s.Body.List[defaultIdx].Pos(), what: "default", nhyps: len(pv.hyps)})
+	}
+
+	// switch 文の中の break は switch 文を抜ける
+	var brks, ends []pState
+	var fall *pState
+	for i, stmt := range s.Body.List {
+		cc := stmt.(*ast.CaseClause)
+		entry := entries[i]
+		if fall != nil {
+			entry = pv.join(entry, *fall)
+			fall = nil
+		}
+		stmts := cc.Body
+		ft := isFallthrough(stmts)
+		if ft {
+			if i == n-1 {
+				err = fmt.Errorf("passive: fallthrough in the last clause")
+				return
+			}
+			stmts = stmts[:len(stmts)-1]
+		}
+		var end pState
+		end, err = pv.stmts(entry, stmts, pExits{brk: &brks, cont: ex.cont})
+		if err != nil {
+			return
+		}
+		if ft {
+			fall = &end
+		} else {
+			ends = append(ends, end)
+		}
+	}
+	if defaultIdx < 0 {
+		// どの case 節にも当てはまらないときは何もしない
+		ends = append(ends, rest)
+	}
+	r = pv.join(append(ends, brks...)...)
+	return
+}
+
+// forStmt は for 文を受動形に変換する関数。
+// ループに入る時点で INV を証明し、ループ内で代入される変数を新しい版の定数に置き換えて INV を仮定する。
+// ループ本体の末尾と continue の時点で post 文を実行したあとに INV を証明する。
+// ループを抜けるのは条件が成り立たないときと break したとき。
+func (pv *passive) forStmt(st pState, s *ast.ForStmt, ex pExits) (r pState, err error) {
+	var asserts map[string]ast.Expr
+	var stmts []ast.Stmt
+	asserts, stmts, err = separateStmts(s.Body.List)
+	if err != nil {
+		return
+	}
+	inv := asserts["INV"]
+	if inv == nil {
+		err = fmt.Errorf("passive: ForStmt: no INV")
+		return
+	}
+	cond := s.Cond
+	if cond == nil {
+		cond = ast.NewIdent("true")
+	}
+	measure := asserts["DECREASES"]
+	term.loop(measure)
+
+	pv.pushScope()
+	defer pv.popScope(&r)
+
+	if s.Init != nil {
+		st, err = pv.stmt(st, s.Init, ex)
+		if err != nil {
+			return
+		}
+	}
+
+	// ループに入る時点で INV が成り立つ
+	var e ast.Expr
+	e, err = pv.rename(st, inv)
+	if err != nil {
+		return
+	}
+	pv.invGoal(st, e, "INV on entry", s)
+
+	// 任意の繰り返しの先頭の状態
+	head := pv.loopHead(st, s)
+	e, err = pv.rename(head, inv)
+	if err != nil {
+		return
+	}
+	pv.hyp(head, e)
+
+	if err = pv.indexGoal(head, cond); err != nil {
+		return
+	}
+	var c ast.Expr
+	c, err = pv.rename(head, cond)
+	if err != nil {
+		return
+	}
+
+	// 繰り返しの先頭では減少量は 0 以上で、その値を d とする
+	top := pv.assume(head, c)
+	var d ast.Expr
+	if measure != nil {
+		d, err = pv.rename(top, measure)
+		if err != nil {
+			return
+		}
+		pv.goal(top, nonNegative(d), "DECREASES non-negative")
+	}
+
+	// ループ本体
+	var brks, conts []pState
+	var body pState
+	body, err = pv.stmts(top, stmts, pExits{brk: &brks, cont: &conts})
+	if err != nil {
+		return
+	}
+	end := pv.join(append([]pState{body}, conts...)...)
+	if s.Post != nil {
+		end, err = pv.stmt(end, s.Post, ex)
+		if err != nil {
+			return
+		}
+	}
+	e, err = pv.rename(end, inv)
+	if err != nil {
+		return
+	}
+	pv.invGoal(end, e, "INV preserved", s)
+	if measure != nil {
+		// ループ本体を一回実行すると減少量は d より小さくなる
+		e, err = pv.rename(end, measure)
+		if err != nil {
+			return
+		}
+		pv.goal(end, decreased(e, d), "DECREASES")
+	}
+
+	// ループを抜けたあとの状態
+	exit := pv.assume(head, astNot(c))
+	r = pv.join(append([]pState{exit}, brks...)...)
+	return
+}
+
+// loopHead はループ s に状態 st から入ったときの、任意の繰り返しの先頭の状態を作成する関数。
+// ループ内で代入される変数は値を定めない新しい版にする。
+// ポインタの確保や関数呼び出しがあるときはヒープも変わりうる。
+func (pv *passive) loopHead(st pState, s *ast.ForStmt) (head pState) {
+	head = st.copy()
+	names := assignedVars(s.Body, s.Post)
+	if pv.touchesHeap(s.Body, s.Post) {
+		names = append(names, heapVarNames(pv.types)...)
+	}
+	for _, name := range names {
+		if _, ok := head.env[name]; ok {
+			head.env[name] = pv.declare(name)
+		}
+	}
+	return
+}
+
+// assignedVars は文の中で代入される変数名のリストを取得する関数。
+// フィールドや配列の要素への代入と delete(m, k) は、その変数全体への代入とみなす。
+// 文の中のブロックで宣言された変数への代入は、外側の同名の変数への代入ではないので含めない。
+func assignedVars(stmts ...ast.Stmt) (r []string) {
+	seen := map[string]bool{}
+	add := func(local map[string]bool, expr ast.Expr) {
+		for {
+			switch expr.(type) {
+			case *ast.SelectorExpr:
+				expr = expr.(*ast.SelectorExpr).X
+				continue
+			case *ast.IndexExpr:
+				expr = expr.(*ast.IndexExpr).X
+				continue
+			case *ast.ParenExpr:
+				expr = expr.(*ast.ParenExpr).X
+				continue
+			}
+			break
+		}
+		if ident, ok := expr.(*ast.Ident); ok && !local[ident.Name] && !seen[ident.Name] {
+			seen[ident.Name] = true
+			r = append(r, ident.Name)
+		}
+	}
+	// nest は外側のスコープ local で宣言された名前を引き継ぐ内側のスコープを作成する
+	nest := func(local map[string]bool) (inner map[string]bool) {
+		inner = map[string]bool{}
+		for name := range local {
+			inner[name] = true
+		}
+		return
+	}
+	var walk func(local map[string]bool, stmt ast.Stmt)
+	walk = func(local map[string]bool, stmt ast.Stmt) {
+		switch stmt.(type) {
+		case *ast.AssignStmt:
+			s := stmt.(*ast.AssignStmt)
+			for _, v := range s.Lhs {
+				if ident, ok := v.(*ast.Ident); ok && s.Tok == token.DEFINE {
+					local[ident.Name] = true
+					continue
+				}
+				add(local, v)
+			}
+		case *ast.IncDecStmt:
+			add(local, stmt.(*ast.IncDecStmt).X)
+		case *ast.ExprStmt:
+			if s, ok := deleteAssign(stmt.(*ast.ExprStmt)); ok {
+				add(local, s.Lhs[0])
+			}
+		case *ast.DeclStmt:
+			if gd, ok := stmt.(*ast.DeclStmt).Decl.(*ast.GenDecl); ok {
+				for _, spec := range gd.Specs {
+					if vs, ok := spec.(*ast.ValueSpec); ok {
+						for _, name := range vs.Names {
+							local[name.Name] = true
+						}
+					}
+				}
+			}
+		case *ast.BlockStmt:
+			inner := nest(local)
+			for _, s := range stmt.(*ast.BlockStmt).List {
+				walk(inner, s)
+			}
+		case *ast.CaseClause:
+			inner := nest(local)
+			for _, s := range stmt.(*ast.CaseClause).Body {
+				walk(inner, s)
+			}
+		case *ast.IfStmt:
+			s := stmt.(*ast.IfStmt)
+			inner := nest(local)
+			if s.Init != nil {
+				walk(inner, s.Init)
+			}
+			walk(inner, s.Body)
+			if s.Else != nil {
+				walk(inner, s.Else)
+			}
+		case *ast.SwitchStmt:
+			s := stmt.(*ast.SwitchStmt)
+			inner := nest(local)
+			if s.Init != nil {
+				walk(inner, s.Init)
+			}
+			walk(inner, s.Body)
+		case *ast.ForStmt:
+			s := stmt.(*ast.ForStmt)
+			inner := nest(local)
+			if s.Init != nil {
+				walk(inner, s.Init)
+			}
+			walk(inner, s.Body)
+			if s.Post != nil {
+				walk(inner, s.Post)
+			}
+		case *ast.LabeledStmt:
+			walk(local, stmt.(*ast.LabeledStmt).Stmt)
+		}
+	}
+	for _, stmt := range stmts {
+		if stmt == nil {
+			continue
+		}
+		walk(map[string]bool{}, stmt)
+	}
+	sort.Strings(r)
+	return
+}
+
+// touchesHeap は文の中にヒープを変えうるポインタの確保か関数呼び出しがあるか調べる関数
+func (pv *passive) touchesHeap(stmts ...ast.Stmt) (ok bool) {
+	for _, stmt := range stmts {
+		if stmt == nil {
+			continue
+		}
+		ast.Inspect(stmt, func(n ast.Node) bool {
+			switch n.(type) {
+			case *ast.AssignStmt:
+				for _, e := range n.(*ast.AssignStmt).Rhs {
+					if _, _, alloc := allocOf(e); alloc {
+						ok = true
+					}
+				}
+			case *ast.CallExpr:
+				// 検証済みの関数の呼び出し
+				if _, _, err := getCallData(pv.types, n.(*ast.CallExpr)); err == nil {
+					ok = true
+				}
+			}
+			return !ok
+		})
+	}
+	return
+}
+
+// isTrueIdent は式が true かどうか調べる関数
+func isTrueIdent(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == "true"
+}
+
+// isFalseIdent は式が false かどうか調べる関数
+func isFalseIdent(expr ast.Expr) bool {
+	ident, ok := expr.(*ast.Ident)
+	return ok && ident.Name == "false"
+}
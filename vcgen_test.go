@@ -0,0 +1,249 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+// 受動形の検証条件で、あとで仮定する事実を使ってその前の条件を証明しないこと
+
+func TestPassiveHypOrder(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		funcs []string
+		ok    bool
+	}{
+		{
+			// n < 0 のときループに入る時点の INV が成り立たない。
+			// ループの先頭で仮定する INV でそれを証明してはならない。
+			name: "INV on entry",
+			src: `package main
+
+func f(n int) (r int) {
+	PRE("true")
+	i := 0
+	r = 0
+	for i < n {
+		INV("0 <= i && i <= n && r == i")
+		i = i + 1
+		r = r + 1
+	}
+	POST("r == n")
+	return
+}
+`,
+			funcs: []string{"f"},
+			ok:    false,
+		},
+		{
+			name: "INV on entry with PRE",
+			src: `package main
+
+func f(n int) (r int) {
+	PRE("n >= 0")
+	i := 0
+	r = 0
+	for i < n {
+		INV("0 <= i && i <= n && r == i")
+		i = i + 1
+		r = r + 1
+	}
+	POST("r == n")
+	return
+}
+`,
+			funcs: []string{"f"},
+			ok:    true,
+		},
+		{
+			// 呼び出し先の PRE を呼び出し先の POST で証明してはならない
+			name: "callee PRE",
+			src: `package main
+
+func g(y int) (z int) {
+	PRE("y > 0")
+	z = y
+	POST("y > 0 && z == y")
+	return
+}
+
+func h(x int) (r int) {
+	PRE("true")
+	r = g(x)
+	POST("r == x")
+	return
+}
+`,
+			funcs: []string{"g", "h"},
+			ok:    false,
+		},
+		{
+			name: "callee PRE with PRE",
+			src: `package main
+
+func g(y int) (z int) {
+	PRE("y > 0")
+	z = y
+	POST("y > 0 && z == y")
+	return
+}
+
+func h(x int) (r int) {
+	PRE("x > 0")
+	r = g(x)
+	POST("r == x")
+	return
+}
+`,
+			funcs: []string{"g", "h"},
+			ok:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expectVerdict(t, tt.src, tt.ok, tt.funcs...)
+		})
+	}
+}
+
+// 受動形の検証条件の大きさは if 文の数に比例する
+func TestPassiveLinearSize(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("package main\n\nfunc f(x int) (r int) {\n\tPRE(\"true\")\n\tr = x\n")
+	for i := 0; i < 12; i++ {
+		sb.WriteString("\tif r > 0 {\n\t\tr = r - 1\n\t} else {\n\t\tr = r + 1\n\t}\n")
+	}
+	sb.WriteString("\tPOST(\"r >= -12\")\n\treturn\n}\n")
+	conds := condStrings(t, "passive", sb.String(), "f")
+	if len(conds) != 1 {
+		t.Fatalf("got %d conds", len(conds))
+	}
+	if n := len(conds[0]); n > 5000 {
+		t.Errorf("VC is too large: %d bytes", n)
+	}
+}
+
+// 記号実行の REACHABLE 文は、その経路でその文より前に加えた仮定だけを使う
+func TestSymexecReachable(t *testing.T) {
+	tests := []struct {
+		name  string
+		src   string
+		funcs []string
+		ok    bool
+	}{
+		{
+			// 呼び出し先の POST が false でも、呼び出しの前の REACHABLE 文には到達する
+			name: "before call",
+			src: `package main
+
+func stop() (z int) {
+	PRE("true")
+	for {
+		INV("true")
+	}
+	POST("false")
+	return
+}
+
+func h(x int) (r int) {
+	PRE("true")
+	REACHABLE("start")
+	r = stop()
+	POST("true")
+	return
+}
+`,
+			funcs: []string{"stop", "h"},
+			ok:    true,
+		},
+		{
+			name: "after call",
+			src: `package main
+
+func stop() (z int) {
+	PRE("true")
+	for {
+		INV("true")
+	}
+	POST("false")
+	return
+}
+
+func h(x int) (r int) {
+	PRE("true")
+	r = stop()
+	REACHABLE("end")
+	POST("true")
+	return
+}
+`,
+			funcs: []string{"stop", "h"},
+			ok:    false,
+		},
+		{
+			name: "infeasible path",
+			src: `package main
+
+func h(x int) (r int) {
+	PRE("true")
+	r = 0
+	if x > 0 && x < 0 {
+		REACHABLE("never")
+	}
+	POST("true")
+	return
+}
+`,
+			funcs: []string{"h"},
+			ok:    false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyFuncs(t, "symexec", tt.src, tt.funcs...)
+			if tt.ok && err != nil {
+				t.Errorf("want reachable, got %v", err)
+			}
+			if !tt.ok && (err == nil || !strings.Contains(err.Error(), "unreachable")) {
+				t.Errorf("want unreachable, got %v", err)
+			}
+		})
+	}
+}
+
+// 受動形では代入ごとに新しい版の変数を let で束縛し、分岐の合流では版を選ぶ変数を宣言する
+func TestPassiveSSA(t *testing.T) {
+	src := `package main
+
+func f(x int) (r int) {
+	PRE("x >= 0")
+	r = x + 1
+	r = r + 1
+	if r > 2 {
+		r = r - 1
+	}
+	POST("r >= 1")
+	return
+}
+`
+	scripts := smtScripts(t, "passive", src, "f")
+	if len(scripts) != 1 {
+		t.Fatalf("got %d scripts", len(scripts))
+	}
+	for _, want := range []string{
+		"(let ((r@1 (+ x 1)))",
+		"(let ((r@2 (+ r@1 1)))",
+		"(let ((reach@1 (> r@2 2)))",
+		"(let ((r@3 (- r@2 1)))",
+		"(declare-const r@4 Int)",
+		"(=> reach@1 (= r@4 r@3))",
+	} {
+		if !strings.Contains(scripts[0], want) {
+			t.Errorf("%q is not in\n%s", want, scripts[0])
+		}
+	}
+	expectVerdictWith(t, []string{"passive"}, src, true, "f")
+	expectVerdictWith(t, []string{"passive"}, strings.Replace(src, "r >= 1", "r >= 2", 1), true, "f")
+	expectVerdictWith(t, []string{"passive"}, strings.Replace(src, "r >= 1", "r >= 3", 1), false, "f")
+}
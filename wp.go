@@ -4,18 +4,18 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"go/ast"
 	"go/format"
 	"go/parser"
 	"go/token"
-	"math/rand"
 	"os"
-	"time"
 )
 
 // getCondTobeVerified は指定された関数定義より、検証すべき条件式のリストと変数名のリストを取得する関数。
-func getCondTobeVerified(f *ast.FuncDecl) (r []ast.Expr, vars map[string]ast.Expr, preCond, postCond ast.Expr, err error) {
+// modifies は関数の MODIFIES の場所の式を引数とする呼び出しの式で、MODIFIES がないときは nil。
+func getCondTobeVerified(f *ast.FuncDecl) (r []ast.Expr, vars map[string]ast.Expr, err error) {
 
 	if len(f.Body.List) < 2 {
 		// 関数定義に文がないときはエラー
@@ -23,6 +23,8 @@ func getCondTobeVerified(f *ast.FuncDecl) (r []ast.Expr, vars map[string]ast.Exp
 		return
 	}
 
+	condInfos = nil
+
 	// 事前条件 preCond と事後条件 postCond の抽出。それ以外は stmts に格納
 	var asserts map[string]ast.Expr
 	var stmts []ast.Stmt
@@ -30,8 +32,10 @@ func getCondTobeVerified(f *ast.FuncDecl) (r []ast.Expr, vars map[string]ast.Exp
 	if err != nil {
 		return
 	}
-	preCond = asserts["PRE"]
-	postCond = asserts["POST"]
+	preCond := asserts["PRE"]
+	postCond := asserts["POST"]
+	modifies := asserts["MODIFIES"]
+	measure := asserts["DECREASES"]
 
 	if preCond == nil {
 		err = fmt.Errorf("wpFunc: no PRE")
@@ -46,9 +50,94 @@ func getCondTobeVerified(f *ast.FuncDecl) (r []ast.Expr, vars map[string]ast.Exp
 	// 事後条件をもとにすべての文から最弱事前条件を求める
 	var wp ast.Expr
 	var acc []ast.Expr
-	vars = getFuncVars(f.Type)
+	vars = getFuncVars(f.Recv, f.Type)
+
+	// ポインタの参照をヒープの配列の参照に直す。heap.go 参照。
+	var pre, post ast.Expr
+	pre, post, stmts, err = heapifyFunc(vars, preCond, postCond, modifies, getResultIdents(f.Type), stmts)
+	if err != nil {
+		return
+	}
+
+	if measure != nil {
+		if measure, err = heapify(vars, measure); err != nil {
+			return
+		}
+	}
+
+	// 停止性の検証を始める。termination.go 参照。
+	beginTermination(vars, funcDeclName(f), measure)
+
+	// マップのパラメータの要素数は 0 以上。map.go 参照。
+	if facts := mapParamFacts(f.Type); len(facts) > 0 {
+		pre = astAnds(append([]ast.Expr{pre}, facts...)...)
+	}
+
+	// old(e) を関数の入口での値に直す。old.go 参照。
+	pre, post = elimOld(vars, pre), elimOld(vars, post)
+	elimOldStmts(vars, stmts)
+	nodes := []ast.Node{post}
+	for _, stmt := range stmts {
+		nodes = append(nodes, stmt)
+	}
+	if term.entry != nil {
+		nodes = append(nodes, term.entry)
+	}
+	pre = snapshotOld(vars, pre, nodes...)
+
+	// INV のないループの不変条件を推論する。infer.go 参照。
+	err = inferInvariants(vars, pre, post, stmts, getResultIdents(f.Type), f.Body)
+	if err != nil {
+		return
+	}
+
+	// 表明の空虚さと矛盾を調べる。vacuity.go 参照。
+	warnings = nil
+	err = checkVacuity(vars, pre, post, stmts, getResultIdents(f.Type))
+	if err != nil {
+		return
+	}
+
+	// PRE が成り立つとき関数の減少量は 0 以上
+	if measure != nil {
+		r = append(r, astNot(astImplies(pre, nonNegative(measure))))
+	}
+
+	// 再帰する純粋関数では再帰呼び出しで減少量が小さくなる。pure.go 参照。
+	if pf := pureTab[funcDeclName(f)]; pf != nil {
+		var conds []ast.Expr
+		conds, err = pf.termConds(pre)
+		if err != nil {
+			return
+		}
+		r = append(r, conds...)
+	}
+
+	if conf.VCGen == "passive" && conf.BMC == 0 {
+		// 受動形により検証条件を作成する。vcgen.go 参照。
+		var conds []ast.Expr
+		conds, vars, err = passiveCond(vars, stmts, pre, post, getResultIdents(f.Type))
+		r = append(conds, r...)
+		return
+	}
+
+	if conf.VCGen == "symexec" && conf.BMC == 0 {
+		// 記号実行により経路ごとの検証条件を作成する。symexec.go 参照。
+		var conds []ast.Expr
+		conds, vars, err = symexecCond(vars, stmts, pre, post, getResultIdents(f.Type))
+		r = append(conds, r...)
+		return
+	}
+
+	// 関数本体の出口ごとの事後条件。
+	// 末尾まで実行したときも return したときも POST が成り立つ必要がある。
+	q := PostConds{
+		Normal:  post,
+		Return:  post,
+		Results: getResultIdents(f.Type),
+	}
 
-	wp, err = wpStmts(&acc, vars, stmts, postCond)
+	wp, err = wpStmts(&acc, vars, stmts, q)
 	if err != nil {
 		return
 	}
@@ -61,7 +150,7 @@ func getCondTobeVerified(f *ast.FuncDecl) (r []ast.Expr, vars map[string]ast.Exp
 		fmt.Println("")
 	}
 
-	r = append(r, astNot(astImplies(preCond, wp)))
+	r = append([]ast.Expr{astNot(astImplies(pre, wp))}, r...)
 
 	// ループに関する追加条件をNotして追加
 	for _, cond := range acc {
@@ -77,6 +166,10 @@ func separateStmts(stmts []ast.Stmt) (asserts map[string]ast.Expr, stmts2 []ast.
 	for _, stmt := range stmts {
 		// 文が PRE文もしくはPOST文かをチェックする
 		tag, cond, ok := isAssertStmt(stmt)
+		if ok && isMidAssert(tag) {
+			// ASSERT/ASSUME は文の途中の表明なので文として残す
+			ok = false
+		}
 		if ok {
 			if asserts[tag] != nil {
 				// 同じ表明文が二度出現するときはエラー
@@ -93,7 +186,35 @@ func separateStmts(stmts []ast.Stmt) (asserts map[string]ast.Expr, stmts2 []ast.
 	return
 }
 
-// isAssertStmt は文が表明文(PRE/POST/INV)かチェックする関数
+// isMidAssert は表明文が関数本体の途中に書く ASSERT もしくは ASSUME かどうか調べる関数
+func isMidAssert(tag string) bool {
+	return tag == "ASSERT" || tag == "ASSUME"
+}
+
+// collectMidAsserts は関数本体の ASSERT と ASSUME の条件式の文字列を出現順に取得する関数
+func collectMidAsserts(body *ast.BlockStmt) (asserts, assumes []string) {
+	ast.Inspect(body, func(n ast.Node) bool {
+		es, ok := n.(*ast.ExprStmt)
+		if !ok {
+			return true
+		}
+		tag, cond, ok := isAssertStmt(es)
+		if !ok || !isMidAssert(tag) {
+			return false
+		}
+		if tag == "ASSERT" {
+			asserts = append(asserts, nodeString(cond))
+		} else {
+			assumes = append(assumes, nodeString(cond))
+		}
+		return false
+	})
+	return
+}
+
+// isAssertStmt は文が表明文(PRE/POST/INV/MODIFIES/ASSERT/ASSUME/DECREASES)かチェックする関数。
+// MODIFIES のときは場所の式を引数とする MODIFIES(...) の呼び出しの式を cond に返す。
+// ヒープの変換済みの表明文は文字列ではなく式を引数にもつ。heap.go 参照。
 func isAssertStmt(stmt ast.Stmt) (tag string, cond ast.Expr, ok bool) {
 	var es *ast.ExprStmt
 	es, ok = stmt.(*ast.ExprStmt)
@@ -115,9 +236,26 @@ func isAssertStmt(stmt ast.Stmt) (tag string, cond ast.Expr, ok bool) {
 	ok = false
 
 	switch ident.Name {
-	case "PRE", "POST", "INV":
+	case "PRE", "POST", "INV", "ASSERT", "ASSUME", "DECREASES":
 		tag = ident.Name
 		cond, ok = isStrLit(ce.Args[0])
+		if !ok {
+			if _, isLit := ce.Args[0].(*ast.BasicLit); !isLit {
+				cond, ok = ce.Args[0], true
+			}
+		}
+	case "MODIFIES":
+		tag = ident.Name
+		bl, isLit := ce.Args[0].(*ast.BasicLit)
+		if !isLit || bl.Kind != token.STRING {
+			return
+		}
+		mods, err := parseModifies(bl.Value[1 : len(bl.Value)-1])
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return
+		}
+		cond, ok = &ast.CallExpr{Fun: ast.NewIdent("MODIFIES"), Args: mods}, true
 	}
 	return
 }
@@ -145,13 +283,32 @@ func isStrLit(expr ast.Expr) (r ast.Expr, ok bool) {
 	return
 }
 
+// PostConds は文の出口ごとの事後条件。
+// 文は通常終了のほかに break、continue、return で抜けることがあるので、
+// それぞれの出口について事後条件を持つ。nil の出口はその文脈では抜けられないことを表す。
+type PostConds struct {
+	Normal   ast.Expr   // 通常終了したときの事後条件
+	Break    ast.Expr   // break で抜けたときの事後条件
+	Continue ast.Expr   // continue で抜けたときの事後条件
+	Return   ast.Expr   // return で抜けたときの事後条件 (関数の POST)
+	Results  []ast.Expr // return で戻り値を束縛する名前付き結果パラメータ
+}
+
+// withNormal は通常終了の事後条件だけを差し替えた PostConds を返す関数
+func (q PostConds) withNormal(normal ast.Expr) (r PostConds) {
+	r = q
+	r.Normal = normal
+	return
+}
+
 // wpStmts は文のリストから最弱事前条件と関数リストと追加検証条件式を作成する関数。
-func wpStmts(acc *[]ast.Expr, vars map[string]ast.Expr, stmts []ast.Stmt, postCond ast.Expr) (pre ast.Expr, err error) {
-	pre = postCond
+func wpStmts(acc *[]ast.Expr, vars map[string]ast.Expr, stmts []ast.Stmt, q PostConds) (pre ast.Expr, err error) {
+	pre = q.Normal
 
-	// 後ろから見ていく
+	// 後ろから見ていく。
+	// 後続の文の最弱事前条件が直前の文の通常終了時の事後条件になる。
 	for i := len(stmts) - 1; i >= 0; i-- {
-		pre, err = wpStmt(acc, vars, stmts[i], pre)
+		pre, err = wpStmt(acc, vars, stmts[i], q.withNormal(pre))
 		if err != nil {
 			break
 		}
@@ -160,7 +317,7 @@ func wpStmts(acc *[]ast.Expr, vars map[string]ast.Expr, stmts []ast.Stmt, postCo
 }
 
 // wpStmts は文から最弱事前条件と関数リストと追加検証条件式を作成する関数。
-func wpStmt(acc *[]ast.Expr, vars map[string]ast.Expr, stmt ast.Stmt, postCond ast.Expr) (pre ast.Expr, err error) {
+func wpStmt(acc *[]ast.Expr, vars map[string]ast.Expr, stmt ast.Stmt, q PostConds) (pre ast.Expr, err error) {
 	if conf.Debug {
 		fmt.Print("#wpStmt: stmt:")
 		format.Node(os.Stdout, token.NewFileSet(), stmt)
@@ -168,25 +325,46 @@ func wpStmt(acc *[]ast.Expr, vars map[string]ast.Expr, stmt ast.Stmt, postCond a
 	}
 	switch stmt.(type) {
 	case *ast.AssignStmt:
-		pre, err = wpAssignStmt(acc, vars, stmt.(*ast.AssignStmt), postCond)
+		pre, err = wpAssignStmt(acc, vars, stmt.(*ast.AssignStmt), q.Normal)
+	case *ast.IncDecStmt:
+		pre, err = wpIncDecStmt(acc, vars, stmt.(*ast.IncDecStmt), q.Normal)
 	case *ast.IfStmt:
-		pre, err = wpIfStmt(acc, vars, stmt.(*ast.IfStmt), postCond)
+		pre, err = wpIfStmt(acc, vars, stmt.(*ast.IfStmt), q)
 	case *ast.ForStmt:
-		pre, err = wpForStmt(acc, vars, stmt.(*ast.ForStmt), postCond)
+		pre, err = wpForStmt(acc, vars, stmt.(*ast.ForStmt), q)
+	case *ast.SwitchStmt:
+		pre, err = wpSwitchStmt(acc, vars, stmt.(*ast.SwitchStmt), q)
 	case *ast.BlockStmt:
 		s := stmt.(*ast.BlockStmt)
-		pre, err = wpStmts(acc, vars, s.List, postCond)
+		pre, err = wpBlock(acc, vars, s.List, q)
 	case *ast.DeclStmt:
-		pre, err = wpDeclStmt(acc, vars, stmt.(*ast.DeclStmt), postCond)
+		pre, err = wpDeclStmt(acc, vars, stmt.(*ast.DeclStmt), q.Normal)
 	case *ast.ReturnStmt:
-		// 受容するがスルーするもの
-		pre = postCond
+		pre, err = wpReturnStmt(acc, vars, stmt.(*ast.ReturnStmt), q)
+	case *ast.BranchStmt:
+		pre, err = wpBranchStmt(stmt.(*ast.BranchStmt), q)
+	case *ast.EmptyStmt:
+		pre = q.Normal
 	case *ast.ExprStmt:
 		es := stmt.(*ast.ExprStmt)
+		if tag, cond, ok := isAssertStmt(es); ok {
+			pre, err = wpAssertStmt(tag, cond, q.Normal)
+			break
+		}
+		if _, ok := isReachableStmt(es); ok {
+			// 到達可能性は記号実行でだけ調べる。symexec.go 参照。
+			pre = q.Normal
+			break
+		}
+		if s, ok := deleteAssign(es); ok {
+			// delete(m, k) は m = Delete(m, k) として扱う。map.go 参照。
+			pre, err = wpAssignStmt(acc, vars, s, q.Normal)
+			break
+		}
 		switch es.X.(type) {
 		case *ast.CallExpr:
 			ce := es.X.(*ast.CallExpr)
-			pre, err = wpFunCall2(ce, postCond)
+			pre, err = wpFunCall2(vars, ce, q.Normal)
 		default:
 			err = fmt.Errorf("wpStmt: ExprStmt: X is unknown")
 		}
@@ -194,6 +372,10 @@ func wpStmt(acc *[]ast.Expr, vars map[string]ast.Expr, stmt ast.Stmt, postCond a
 		ast.Print(fset, stmt)
 		err = fmt.Errorf("wp: unknown statement")
 	}
+	if c := indexChecks(vars, stmtExprs(stmt)...); c != nil && err == nil {
+		// 文字列の添字は文を実行する前の状態で範囲内である。str.go 参照。
+		pre = astAnd(c, pre)
+	}
 	return
 }
 
@@ -233,11 +415,26 @@ func wpAssignStmt(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.AssignStmt,
 		return
 	}
 
-	// ケース２：左辺の個数が1 かつ IndexExpr である
-	if len(s.Lhs) == 1 {
-		_, ok := s.Lhs[0].(*ast.IndexExpr)
-		if ok {
-			err = fmt.Errorf("wp: AssignStmt: IndexExpr is not implemented")
+	// x += e のような演算代入は x = x + e に直して扱う
+	s, err = normOpAssign(s)
+	if err != nil {
+		return
+	}
+
+	// ケース５：左辺の個数が1 かつ構造体のフィールドであるとき→ 変数全体への代入に直す
+	// ケース２：左辺の個数が1 かつ IndexExpr であるとき→ 配列全体への Store の代入に直す
+	s, err = normFieldAssign(vars, s)
+	if err != nil {
+		return
+	}
+
+	// ケース７：v, ok = m[k] のとき→ v, ok = m[k], HasKey(m, k) に直す
+	s = normCommaOk(vars, s)
+
+	// ケース６：右辺がポインタの確保 &T{...} もしくは new(T) のとき
+	if len(s.Lhs) == 1 && len(s.Rhs) == 1 {
+		if typ, init, ok := allocOf(s.Rhs[0]); ok {
+			pre, err = wpAlloc(vars, s.Lhs[0], typ, init, postCond)
 			return
 		}
 	}
@@ -255,11 +452,11 @@ func wpAssignStmt(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.AssignStmt,
 
 	// ケース３：右辺の個数が1 かつ CallExpr のとき→ FunCall の処理
 	if len(s.Rhs) == 1 {
-		ce, ok := s.Rhs[0].(*ast.CallExpr)
+		ce, ok := isFunCall(s.Rhs[0])
 		if ok {
 			//err = fmt.Errorf("Assignment of FunCall is not implimented yet")
 			//return
-			pre, err = wpFunCall(s.Lhs, ce, postCond)
+			pre, err = wpFunCall(vars, s.Lhs, ce, postCond)
 			if conf.Debug {
 				fmt.Print("#wpStmt: Assignment: pre:")
 				format.Node(os.Stdout, token.NewFileSet(), pre)
@@ -271,11 +468,14 @@ func wpAssignStmt(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.AssignStmt,
 
 	// ケース４：右辺がすべて CallExpr 以外のとき
 	for i := 0; i < len(s.Rhs); i++ {
-		_, ok := s.Rhs[i].(*ast.CallExpr)
-		if ok { // 関数呼び出しが入るときはエラー
+		if _, ok := isFunCall(s.Rhs[i]); ok { // 関数呼び出しが入るときはエラー
 			err = fmt.Errorf("multi assignment of FunCall is not supported")
 			return
 		}
+		if ce, ok := hasFunCall(s.Rhs[i]); ok { // 式の中の関数呼び出しは一度だけ評価する必要がある
+			err = fmt.Errorf("wp: AssignStmt: FunCall %s in an expression is not supported", nodeString(ce))
+			return
+		}
 	}
 
 	if conf.Debug {
@@ -306,67 +506,669 @@ func wpAssignStmt(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.AssignStmt,
 	return
 }
 
-// wpDeclStmt は if 文の事前条件を抽出する関数
+// wpAlloc はポインタの確保 p = &T{...} の事前条件を抽出する関数。
+// 未確保の任意の位置 l について、l を確保して初期値を書き込み p = l としたときに事後条件が成り立つ。
+//
+//	ForAll l.(l != nil && !alloc$[l] => postCond[p, alloc$, heap$T := l, Store(alloc$, l, true), Store(heap$T, l, init)])
+func wpAlloc(vars map[string]ast.Expr, lhs, typ, init ast.Expr, postCond ast.Expr) (pre ast.Expr, err error) {
+	if _, ok := lhs.(*ast.Ident); !ok {
+		err = fmt.Errorf("wp: AssignStmt: allocation to non-variable is not supported")
+		return
+	}
+	var h *ast.Ident
+	h, err = heapRef(vars, typ)
+	if err != nil {
+		return
+	}
+	a := ast.NewIdent(allocName)
+	l := FreshIdents(1)[0]
+	pre, err = subst(postCond,
+		[]ast.Expr{lhs, a, h},
+		[]ast.Expr{l, astStore(a, l, ast.NewIdent("true")), astStore(h, l, init)})
+	if err != nil {
+		return
+	}
+	fresh := astAnd(
+		&ast.BinaryExpr{X: l, Op: token.NEQ, Y: &ast.BasicLit{Kind: token.INT, Value: "0"}},
+		astNot(&ast.IndexExpr{X: a, Index: l}))
+	pre = astForAll(l, ast.NewIdent("int"), astImplies(fresh, pre))
+	return
+}
+
+// opAssignTab は演算代入の演算子と二項演算子の対応表
+var opAssignTab = map[token.Token]token.Token{
+	token.ADD_ASSIGN: token.ADD,
+	token.SUB_ASSIGN: token.SUB,
+	token.MUL_ASSIGN: token.MUL,
+	token.QUO_ASSIGN: token.QUO,
+	token.REM_ASSIGN: token.REM,
+}
+
+// normOpAssign は x += e のような演算代入を x = x + e の形の代入文に直す関数。
+// 演算代入でないときはそのまま返す。
+func normOpAssign(s *ast.AssignStmt) (r *ast.AssignStmt, err error) {
+	r = s
+	op, ok := opAssignTab[s.Tok]
+	if !ok {
+		return
+	}
+	if len(s.Lhs) != 1 || len(s.Rhs) != 1 {
+		err = fmt.Errorf("wp: AssignStmt: %s with multiple operands", s.Tok)
+		return
+	}
+	r = &ast.AssignStmt{
+		Lhs: s.Lhs,
+		Tok: token.ASSIGN,
+		Rhs: []ast.Expr{&ast.BinaryExpr{X: s.Lhs[0], Op: op, Y: s.Rhs[0]}},
+	}
+	return
+}
+
+// normFieldAssign は構造体のフィールドへの代入 p.x = e を、変数全体への代入
+// p = Point{x: e, y: p.y} に直す関数。p.q.x = e のような入れ子のフィールドも同様。
+// 配列の要素への代入 a[i] = e は a = Store(a, i, e) に直す。
+// 左辺がフィールドでも配列の要素でもないときはそのまま返す。
+func normFieldAssign(vars map[string]ast.Expr, s *ast.AssignStmt) (r *ast.AssignStmt, err error) {
+	r = s
+	if len(s.Lhs) != 1 {
+		return
+	}
+	switch s.Lhs[0].(type) {
+	case *ast.SelectorExpr, *ast.IndexExpr:
+	default:
+		return
+	}
+	if len(s.Rhs) != 1 {
+		err = fmt.Errorf("wp: AssignStmt: len(Rhs) != len(Lhs)")
+		return
+	}
+	if _, ok := hasFunCall(s.Rhs[0]); ok {
+		err = fmt.Errorf("wp: AssignStmt: assignment of FunCall to field is not supported")
+		return
+	}
+	var v, e ast.Expr
+	v, e, err = fieldAssign(vars, s.Lhs[0], s.Rhs[0])
+	if err != nil {
+		return
+	}
+	r = &ast.AssignStmt{
+		Lhs: []ast.Expr{v},
+		Tok: token.ASSIGN,
+		Rhs: []ast.Expr{e},
+	}
+	return
+}
+
+// fieldAssign は左辺 lhs への式 e の代入を、変数 v への式 r の代入に直す関数
+func fieldAssign(vars map[string]ast.Expr, lhs, e ast.Expr) (v, r ast.Expr, err error) {
+	switch lhs.(type) {
+	case *ast.Ident:
+		v, r = lhs, e
+	case *ast.ParenExpr:
+		v, r, err = fieldAssign(vars, lhs.(*ast.ParenExpr).X, e)
+	case *ast.SelectorExpr:
+		se := lhs.(*ast.SelectorExpr)
+		name, st := structOf(typeOf(vars, se.X))
+		if st == nil {
+			err = fmt.Errorf("wp: AssignStmt: %s is not a field of struct", se.Sel.Name)
+			return
+		}
+		if fieldType(st, se.Sel.Name) == nil {
+			err = fmt.Errorf("wp: AssignStmt: unknown field %s of %s", se.Sel.Name, name)
+			return
+		}
+		// 代入するフィールド以外は元の値のままの構造体の値
+		cl := &ast.CompositeLit{Type: ast.NewIdent(name)}
+		fields, _ := structFields(st)
+		for _, field := range fields {
+			var val ast.Expr = &ast.SelectorExpr{X: se.X, Sel: ast.NewIdent(field)}
+			if field == se.Sel.Name {
+				val = e
+			}
+			cl.Elts = append(cl.Elts, &ast.KeyValueExpr{Key: ast.NewIdent(field), Value: val})
+		}
+		v, r, err = fieldAssign(vars, se.X, cl)
+	case *ast.IndexExpr:
+		ie := lhs.(*ast.IndexExpr)
+		v, r, err = fieldAssign(vars, ie.X, astStore(ie.X, ie.Index, e))
+	default:
+		err = fmt.Errorf("wp: AssignStmt: Lhs is not ident nor field")
+	}
+	return
+}
+
+// incDecAssign は x++ および x-- を x = x + 1 および x = x - 1 の代入文に直す関数
+func incDecAssign(s *ast.IncDecStmt) (r *ast.AssignStmt) {
+	op := token.ADD
+	if s.Tok == token.DEC {
+		op = token.SUB
+	}
+	r = &ast.AssignStmt{
+		Lhs: []ast.Expr{s.X},
+		Tok: token.ASSIGN,
+		Rhs: []ast.Expr{&ast.BinaryExpr{X: s.X, Op: op, Y: &ast.BasicLit{Kind: token.INT, Value: "1"}}},
+	}
+	return
+}
+
+// wpIncDecStmt は x++ および x-- の事前条件を抽出する関数。
+// x = x + 1 および x = x - 1 として扱う。
+func wpIncDecStmt(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.IncDecStmt, postCond ast.Expr) (pre ast.Expr, err error) {
+	pre, err = wpAssignStmt(acc, vars, incDecAssign(s), postCond)
+	return
+}
+
+// wpReturnStmt は return 文の事前条件を抽出する関数。
+// 戻り値を名前付き結果パラメータに代入してから return 時の事後条件を検証するものとして扱う。
+// return 文より後ろの文は実行されないので、通常終了の事後条件は使わない。
+func wpReturnStmt(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.ReturnStmt, q PostConds) (pre ast.Expr, err error) {
+	if q.Return == nil {
+		err = fmt.Errorf("wpReturnStmt: return is not allowed here")
+		return
+	}
+
+	// 戻り値の指定がないとき、あるいは結果パラメータに名前がなく POST から参照できないときは
+	// そのまま return 時の事後条件となる。
+	if len(s.Results) == 0 || len(q.Results) == 0 {
+		pre = q.Return
+		return
+	}
+
+	// return e1, e2 は r1, r2 = e1, e2 として扱う。
+	// return f(x) のような多値を返す関数呼び出しも wpAssignStmt で処理される。
+	if len(s.Results) != 1 && len(s.Results) != len(q.Results) {
+		err = fmt.Errorf("wpReturnStmt: len(Results) != len(named results)")
+		return
+	}
+	as := &ast.AssignStmt{
+		Lhs: q.Results,
+		Tok: token.ASSIGN,
+		Rhs: s.Results,
+	}
+	pre, err = wpAssignStmt(acc, vars, as, q.Return)
+	return
+}
+
+// wpAssertStmt は文の途中の表明文の事前条件を抽出する関数。
+// ASSERT(c) は c を証明すべき条件として c && Q、ASSUME(c) は c を仮定して c => Q とする。
+func wpAssertStmt(tag string, cond, postCond ast.Expr) (pre ast.Expr, err error) {
+	switch tag {
+	case "ASSERT":
+		pre = astAnd(cond, postCond)
+	case "ASSUME":
+		pre = astImplies(cond, postCond)
+	default:
+		err = fmt.Errorf("wp: %s is not allowed here", tag)
+	}
+	return
+}
+
+// wpBranchStmt は break 文および continue 文の事前条件を抽出する関数。
+// それぞれの出口の事後条件がそのまま事前条件となる。
+func wpBranchStmt(s *ast.BranchStmt, q PostConds) (pre ast.Expr, err error) {
+	if s.Label != nil {
+		err = fmt.Errorf("wpBranchStmt: labeled %s is not supported", s.Tok)
+		return
+	}
+	switch s.Tok {
+	case token.BREAK:
+		pre = q.Break
+	case token.CONTINUE:
+		pre = q.Continue
+	default:
+		err = fmt.Errorf("wpBranchStmt: %s is not supported", s.Tok)
+		return
+	}
+	if pre == nil {
+		err = fmt.Errorf("wpBranchStmt: %s is not in a loop", s.Tok)
+	}
+	return
+}
+
+// wpDeclStmt は変数宣言と定数宣言の事前条件を抽出する関数。
+// 宣言は宣言される名前への := の代入として扱う。
 func wpDeclStmt(acc *[]ast.Expr, vars map[string]ast.Expr, ds *ast.DeclStmt, postCond ast.Expr) (pre ast.Expr, err error) {
-	// 変数宣言は変数名と型名を取得する。
+	var as []*ast.AssignStmt
+	var free []*ast.Ident
+	as, free, err = declAssigns(vars, ds)
+	if err != nil {
+		return
+	}
 
+	// 値を定めない変数は全称量化する。ForAll u.(postCond[x:=u])
+	// 外側の同名の変数とは別の変数になる。
+	pre = postCond
+	for _, x := range free {
+		u := FreshIdents(1)[0]
+		pre, err = subst(pre, []ast.Expr{x}, []ast.Expr{u})
+		if err != nil {
+			return
+		}
+		pre = astForAll(u, vars[x.Name], pre)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		pre, err = wpAssignStmt(acc, vars, as[i], pre)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// declAssigns は変数宣言と定数宣言を、宣言される名前への := の代入文のリストに直す関数。
+// 宣言される名前の型は vars に登録する。型を省略したときは型検査の結果 (typecheck.go 参照) か初期値から求める。
+// 初期値のない変数は Golang と同じく型のゼロ値とする。ゼロ値を式で表せない型 (スライスなど) の変数は
+// 代入にせず free に返し、値を定めない変数とする。
+//
+//	var x, y int        -> x, y := 0, 0
+//	var s = "a"         -> s := "a"
+//	var a, b = f()      -> a, b := f()
+//	const c = 1 << 3    -> c := 8
+func declAssigns(vars map[string]ast.Expr, ds *ast.DeclStmt) (r []*ast.AssignStmt, free []*ast.Ident, err error) {
 	gd, ok := ds.Decl.(*ast.GenDecl)
 	if !ok {
 		err = fmt.Errorf("wpDeclStmt: unknown Decl")
 		return
 	}
-	if gd.Tok != token.VAR {
-		err = fmt.Errorf("wpDeclStmt: not var")
+	if gd.Tok != token.VAR && gd.Tok != token.CONST {
+		// 関数の中の type 宣言は型の表に登録しない
+		err = fmt.Errorf("wpDeclStmt: %s is not supported", gd.Tok)
 		return
 	}
 
-	vs, ok := gd.Specs[0].(*ast.ValueSpec)
-	if !ok {
-		err = fmt.Errorf("wpDeclStmt: Specs[0] is not ValueSpec")
+	for _, spec := range gd.Specs {
+		vs, ok := spec.(*ast.ValueSpec)
+		if !ok {
+			err = fmt.Errorf("wpDeclStmt: Spec is not ValueSpec")
+			return
+		}
+		if len(vs.Values) != 0 && len(vs.Values) != len(vs.Names) && (len(vs.Values) != 1 || gd.Tok != token.VAR) {
+			err = fmt.Errorf("wpDeclStmt: len(Names) != len(Values)")
+			return
+		}
+
+		s := &ast.AssignStmt{Tok: token.DEFINE}
+		for i, name := range vs.Names {
+			typ := vs.Type
+			if typ == nil {
+				if obj := declObjs[name]; obj != nil {
+					typ = typeExpr(obj.Type())
+				} else if len(vs.Values) == len(vs.Names) {
+					typ = typeOf(vars, vs.Values[i])
+				}
+			}
+			if name.Name != "_" {
+				vars[name.Name] = typ
+			}
+
+			switch {
+			case gd.Tok == token.CONST:
+				// iota を使う定数や式を省略した定数も、型検査で求めた値にする。const.go 参照。
+				value := localConstExpr(name, typ)
+				if value == nil && len(vs.Values) == len(vs.Names) {
+					value = vs.Values[i]
+				}
+				if value == nil {
+					err = fmt.Errorf("wpDeclStmt: value of const %s is unknown", name.Name)
+					return
+				}
+				s.Lhs = append(s.Lhs, name)
+				s.Rhs = append(s.Rhs, value)
+			case len(vs.Values) > 0:
+				s.Lhs = append(s.Lhs, name)
+				s.Rhs = vs.Values
+			case name.Name == "_":
+			default:
+				if value := zeroExpr(typ); value != nil {
+					s.Lhs = append(s.Lhs, name)
+					s.Rhs = append(s.Rhs, value)
+				} else {
+					free = append(free, name)
+				}
+			}
+		}
+		if len(s.Lhs) > 0 {
+			r = append(r, s)
+		}
+	}
+	return
+}
+
+// wpIfStmt は if 文の事前条件を抽出する関数。
+// else if の連鎖はひとつの場合分けとして平坦に組み立てる。
+//
+//	cond1 && then1 || !cond1 && cond2 && then2 || ... || !cond1 && ... && !condN && else
+//
+// else 節がないときは、どの条件も成り立たなければ何もせずに通常終了する。
+func wpIfStmt(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.IfStmt, q PostConds) (pre ast.Expr, err error) {
+	var names, tmps []ast.Expr
+	names, tmps, q, err = hideInitVars(s.Init, q)
+	if err != nil {
 		return
 	}
 
-	/*
-		if len(vs.Names) != 1 {
-			err = fmt.Errorf("wpStmt: ValueSpec: len(Names) != 1")
+	var conds, thenConds []ast.Expr
+	elseCond := q.Normal
+	for cur := s; ; {
+		var thenCond ast.Expr
+		thenCond, err = wpBlock(acc, vars, cur.Body.List, q)
+		if err != nil {
 			return
 		}
-	*/
+		conds = append(conds, cur.Cond)
+		thenConds = append(thenConds, thenCond)
+
+		// 初期化文のない else if は連鎖に含める。
+		// 初期化文のある else if は入れ子の if 文として扱う。
+		next, ok := cur.Else.(*ast.IfStmt)
+		if ok && next.Init == nil {
+			cur = next
+			continue
+		}
+		if cur.Else != nil {
+			elseCond, err = wpStmt(acc, vars, cur.Else, q)
+			if err != nil {
+				return
+			}
+		}
+		break
+	}
+	pre = astCases(conds, thenConds, elseCond)
+	if c := indexChecks(vars, astOrs(conds...)); c != nil {
+		// 条件は上から順に評価されるので、c1 || c2 || ... の添字の条件とする
+		pre = astAnd(c, pre)
+	}
+
+	pre, err = wpInitStmt(acc, vars, s.Init, pre, names, tmps)
+	return
+}
+
+// wpBlock は内側のブロックの文のリスト stmts の事前条件を抽出する関数。
+// ブロックの中で宣言される変数のスコープはブロックの内側に限られる (wpScope 参照)。
+func wpBlock(acc *[]ast.Expr, vars map[string]ast.Expr, stmts []ast.Stmt, q PostConds) (pre ast.Expr, err error) {
+	pre, err = wpScope(acc, vars, blockDecls(stmts), q, func(q PostConds) (ast.Expr, error) {
+		return wpStmts(acc, vars, stmts, q)
+	})
+	return
+}
 
-	for _, name := range vs.Names {
-		vars[name.Name] = vs.Type
+// blockDecls は文のリスト stmts で var、const、:= によって宣言される変数名のリストを取得する関数
+func blockDecls(stmts []ast.Stmt) (names []ast.Expr) {
+	seen := map[string]bool{}
+	add := func(ident *ast.Ident) {
+		if ident.Name != "_" && !seen[ident.Name] {
+			seen[ident.Name] = true
+			names = append(names, ast.NewIdent(ident.Name))
+		}
 	}
+	for _, stmt := range stmts {
+		switch stmt.(type) {
+		case *ast.AssignStmt:
+			as := stmt.(*ast.AssignStmt)
+			if as.Tok != token.DEFINE {
+				continue
+			}
+			for _, v := range as.Lhs {
+				if ident, ok := v.(*ast.Ident); ok {
+					add(ident)
+				}
+			}
+		case *ast.DeclStmt:
+			gd, ok := stmt.(*ast.DeclStmt).Decl.(*ast.GenDecl)
+			if !ok {
+				continue
+			}
+			for _, spec := range gd.Specs {
+				if vs, ok := spec.(*ast.ValueSpec); ok {
+					for _, name := range vs.Names {
+						add(name)
+					}
+				}
+			}
+		}
+	}
+	return
+}
 
-	pre = postCond
+// wpScope は内側のスコープで変数 names を宣言する文の事前条件を f で抽出する関数。
+// 内側で宣言された変数は外側の同名の変数を隠すので、出口ごとの事後条件の中の外側の変数を一時的な変数に
+// 置き換えてから f で事前条件を求め、求めた事前条件の中で元に戻す。
+// 事前条件に残る同名の変数は、初期値の式の中などで参照される外側の変数である。
+// f の中で追加されたループの検証条件に残る一時的な変数も全称量化する。
+//
+//	x = 3; { var x = 7; x = x + 1 }; r = x
+//	=> { var x = 7; x = x + 1 } の事後条件 r == 8 は x$1 == 8 とし、事前条件の x$1 を x に戻す
+func wpScope(acc *[]ast.Expr, vars map[string]ast.Expr, names []ast.Expr, q PostConds, f func(PostConds) (ast.Expr, error)) (pre ast.Expr, err error) {
+	if len(names) == 0 {
+		pre, err = f(q)
+		return
+	}
+	// 外側の変数の型
+	types := make([]ast.Expr, len(names))
+	for i, x := range names {
+		types[i] = vars[x.(*ast.Ident).Name]
+	}
+	tmps := FreshIdents(len(names))
+	q, err = q.subst(names, tmps)
+	if err != nil {
+		return
+	}
+	// return で戻り値を代入する外側の結果パラメータも置き換える
+	results := append([]ast.Expr{}, q.Results...)
+	for i, v := range results {
+		for j, x := range names {
+			if Equals(v, x) {
+				results[i] = tmps[j]
+			}
+		}
+	}
+	q.Results = results
 
+	n := len(*acc)
+	pre, err = f(q)
+	if err != nil {
+		return
+	}
+	for i := n; i < len(*acc); i++ {
+		for j, tmp := range tmps {
+			if usesIdent((*acc)[i], tmp.(*ast.Ident).Name) {
+				if types[j] == nil {
+					types[j] = vars[names[j].(*ast.Ident).Name]
+				}
+				(*acc)[i] = astForAll(tmp, types[j], (*acc)[i])
+			}
+		}
+	}
+	pre, err = subst(pre, tmps, names)
 	return
 }
 
-// wpIfStmt は if 文の事前条件を抽出する関数
-func wpIfStmt(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.IfStmt, postCond ast.Expr) (pre ast.Expr, err error) {
-	cond := s.Cond
-	var thenCond, elseCond ast.Expr
-	thenCond, err = wpStmts(acc, vars, s.Body.List, postCond)
+// hideInitVars は if/switch 文の初期化文で := 宣言される変数を、
+// 出口ごとの事後条件の中で一時的な変数に置き換える関数。
+// 初期化文で宣言された変数のスコープは文の内側に限られるので、
+// 文の後ろで参照される同名の外側の変数に初期化文の代入が及ばないようにする。
+func hideInitVars(init ast.Stmt, q PostConds) (names, tmps []ast.Expr, r PostConds, err error) {
+	r = q
+	as, ok := init.(*ast.AssignStmt)
+	if !ok || as.Tok != token.DEFINE {
+		return
+	}
+	for _, v := range as.Lhs {
+		if ident, ok := v.(*ast.Ident); ok && ident.Name != "_" {
+			names = append(names, ident)
+		}
+	}
+	tmps = FreshIdents(len(names))
+	r, err = q.subst(names, tmps)
+	return
+}
+
+// wpInitStmt は if/switch 文の初期化文の事前条件を抽出する関数。
+// 初期化文の代入を適用したあとに、hideInitVars で置き換えた外側の変数を元に戻す。
+func wpInitStmt(acc *[]ast.Expr, vars map[string]ast.Expr, init ast.Stmt, postCond ast.Expr, names, tmps []ast.Expr) (pre ast.Expr, err error) {
+	pre = postCond
+	if init == nil {
+		return
+	}
+	pre, err = wpStmt(acc, vars, init, PostConds{Normal: pre})
 	if err != nil {
 		return
 	}
-	elseCond, err = wpStmt(acc, vars, s.Else, postCond)
+	pre, err = subst(pre, tmps, names)
+	return
+}
+
+// subst は出口ごとの事後条件のすべての中に出現する vs を es で置換する関数
+func (q PostConds) subst(vs []ast.Expr, es []ast.Expr) (r PostConds, err error) {
+	r = q
+	for _, p := range []*ast.Expr{&r.Normal, &r.Break, &r.Continue, &r.Return} {
+		if *p == nil {
+			continue
+		}
+		*p, err = subst(*p, vs, es)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// wpSwitchStmt は switch 文の事前条件を抽出する関数。
+// case 節を上から順に判定する if-else の連鎖とみなし、wpIfStmt と同じく平坦な場合分けとして組み立てる。
+// default 節はその位置にかかわらず、どの case 節にも当てはまらないときに実行される。
+func wpSwitchStmt(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.SwitchStmt, q PostConds) (pre ast.Expr, err error) {
+	if _, ok := hasFunCall(s.Tag); ok {
+		// タグの式は一度だけ評価されるので、関数呼び出しを含むときは各 case 節に複製できない
+		err = fmt.Errorf("wpSwitchStmt: Tag of function call is not supported")
+		return
+	}
+
+	var names, tmps []ast.Expr
+	names, tmps, q, err = hideInitVars(s.Init, q)
 	if err != nil {
 		return
 	}
-	// cond && thenCond || !cond && elseCond
-	pre = astOr(astAnd(cond, thenCond), astAnd(astNot(cond), elseCond))
+
+	// switch 文の中の break は switch 文を抜ける
+	bodyQ := q
+	bodyQ.Break = q.Normal
+
+	// 各節の本体の最弱事前条件を後ろから求める。
+	// fallthrough で終わる節は、通常終了のかわりに次の節の本体に続く。
+	n := len(s.Body.List)
+	bodyPres := make([]ast.Expr, n)
+	defaultIdx := -1
+	for i := n - 1; i >= 0; i-- {
+		cc, ok := s.Body.List[i].(*ast.CaseClause)
+		if !ok {
+			err = fmt.Errorf("wpSwitchStmt: Body.List[%d] is not CaseClause", i)
+			return
+		}
+		if cc.List == nil {
+			defaultIdx = i
+		}
+
+		stmts := cc.Body
+		next := q.Normal
+		if isFallthrough(stmts) {
+			if i == n-1 {
+				err = fmt.Errorf("wpSwitchStmt: fallthrough in the last clause")
+				return
+			}
+			stmts = stmts[:len(stmts)-1]
+			next = bodyPres[i+1]
+		}
+		bodyPres[i], err = wpBlock(acc, vars, stmts, bodyQ.withNormal(next))
+		if err != nil {
+			return
+		}
+	}
+
+	// どの case 節にも当てはまらないときは default 節、default 節がなければ何もしない
+	elsePre := q.Normal
+	if defaultIdx >= 0 {
+		elsePre = bodyPres[defaultIdx]
+	}
+
+	// case 節を上から順に判定する場合分けを組み立てる。
+	// cond1 && body1 || !cond1 && cond2 && body2 || ... || !cond1 && ... && !condN && default
+	var conds, pres []ast.Expr
+	for i, stmt := range s.Body.List {
+		cc := stmt.(*ast.CaseClause)
+		if cc.List == nil {
+			continue
+		}
+		conds = append(conds, caseCond(s.Tag, cc.List))
+		pres = append(pres, bodyPres[i])
+	}
+	pre = astCases(conds, pres, elsePre)
+	if len(conds) > 0 {
+		if c := indexChecks(vars, astOrs(conds...)); c != nil {
+			pre = astAnd(c, pre)
+		}
+	}
+
+	pre, err = wpInitStmt(acc, vars, s.Init, pre, names, tmps)
 	return
 }
 
-// wpForStmt は for 文の事前条件を抽出する関数
-func wpForStmt(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.ForStmt, postCond ast.Expr) (pre ast.Expr, err error) {
+// caseCond は case 節に当てはまる条件式を作成する関数。
+// タグがあるときは tag == v1 || tag == v2 || ...、タグがないときは v1 || v2 || ... となる。
+func caseCond(tag ast.Expr, list []ast.Expr) (r ast.Expr) {
+	for _, v := range list {
+		cond := v
+		if tag != nil {
+			cond = &ast.BinaryExpr{
+				X:  tag,
+				Op: token.EQL,
+				Y:  v,
+			}
+		}
+		if r == nil {
+			r = cond
+		} else {
+			r = astOr(r, cond)
+		}
+	}
+	return
+}
+
+// isFallthrough は文のリストが fallthrough 文で終わるかどうか調べる関数
+func isFallthrough(stmts []ast.Stmt) (ok bool) {
+	if len(stmts) == 0 {
+		return
+	}
+	bs, isBranch := stmts[len(stmts)-1].(*ast.BranchStmt)
+	ok = isBranch && bs.Tok == token.FALLTHROUGH
+	return
+}
+
+// wpForStmt は for 文の事前条件を抽出する関数。
+// 初期化文で := 宣言される変数のスコープは for 文の内側に限られる (wpScope 参照)。
+func wpForStmt(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.ForStmt, q PostConds) (pre ast.Expr, err error) {
+	var names []ast.Expr
+	if s.Init != nil {
+		names = blockDecls([]ast.Stmt{s.Init})
+	}
+	pre, err = wpScope(acc, vars, names, q, func(q PostConds) (ast.Expr, error) {
+		return wpLoop(acc, vars, s, q)
+	})
+	return
+}
+
+// wpLoop は for 文の初期化文とループの事前条件を抽出する関数
+func wpLoop(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.ForStmt, q PostConds) (pre ast.Expr, err error) {
 	var asserts map[string]ast.Expr
 	var stmts []ast.Stmt
 	asserts, stmts, err = separateStmts(s.Body.List)
 	if err != nil {
 		return
 	}
+	if conf.BMC > 0 {
+		// 有界モデル検査ではループを展開する。bmc.go 参照。
+		pre, err = wpForUnroll(acc, vars, s, stmts, q)
+		return
+	}
 	// INV文を取得
 	inv := asserts["INV"]
 	if inv == nil {
@@ -374,93 +1176,141 @@ func wpForStmt(acc *[]ast.Expr, vars map[string]ast.Expr, s *ast.ForStmt, postCo
 		return
 	}
 
-	// {inv} while s.Cond stmts {postCond}
-	// inv && s.Cond ==> wp(stmts, inv)
-	// inv && !s.Cond ==> postCond
+	// 条件のない for 文は無限ループ
+	cond := s.Cond
+	if cond == nil {
+		cond = ast.NewIdent("true")
+	}
+
+	// DECREASES があるときは、繰り返しの先頭の減少量を新規変数 d で表し、
+	// ループ本体を実行したあとに減少量が d より小さくなることを inv に加えて示す。
+	measure := asserts["DECREASES"]
+	term.loop(measure)
+	next := inv
+	var d ast.Expr
+	if measure != nil {
+		d = FreshIdents(1)[0]
+		next = astAnd(inv, decreased(measure, d))
+	}
+
+	// {inv} for init; cond; post { stmts } {Q}
+	// inv && cond ==> wp(stmts, inv)
+	// inv && !cond ==> Q
+	// ループ本体の出口ごとの事後条件は次のとおり。
+	//   通常終了・continue : post 文を実行したあとに inv が成り立つ
+	//   break             : ループの後続の文の事前条件 Q が成り立つ
+	//   return            : 関数の POST が成り立つ (外側のものをそのまま使う)
+	if s.Post != nil {
+		next, err = wpStmt(acc, vars, s.Post, PostConds{Normal: next})
+		if err != nil {
+			return
+		}
+	}
+	bodyQ := q.withNormal(next)
+	bodyQ.Continue = next
+	bodyQ.Break = q.Normal
 
-	pre, err = wpStmts(acc, vars, stmts, inv)
+	pre, err = wpBlock(acc, vars, stmts, bodyQ)
 	if err != nil {
 		return
 	}
 
-	// inv && s.Cond ==> pre
-	*acc = append(*acc, astImplies(astAnd(inv, s.Cond), pre))
-	// inv && !s.Cond ==> postCond
-	*acc = append(*acc, astImplies(astAnd(inv, astNot(s.Cond)), postCond))
+	if measure != nil {
+		// inv && cond ==> measure >= 0
+		*acc = append(*acc, astImplies(astAnd(inv, cond), nonNegative(measure)))
+		// ForAll d.(inv && cond && d == measure ==> pre)
+		eq := &ast.BinaryExpr{X: d, Op: token.EQL, Y: measure}
+		*acc = append(*acc, astForAll(d, ast.NewIdent("int"), astImplies(astAnds(inv, cond, eq), pre)))
+	} else {
+		// inv && cond ==> pre
+		*acc = append(*acc, astImplies(astAnd(inv, cond), pre))
+	}
+	// inv && !cond ==> Q
+	*acc = append(*acc, astImplies(astAnd(inv, astNot(cond)), q.Normal))
+	// inv ==> 条件の文字列の添字が範囲内
+	if c := indexChecks(vars, cond); c != nil {
+		*acc = append(*acc, astImplies(inv, c))
+	}
 
 	pre = inv
+
+	// 初期化文を実行したあとに inv が成り立つ
+	if s.Init != nil {
+		pre, err = wpStmt(acc, vars, s.Init, PostConds{Normal: inv})
+	}
 	return
 }
 
 // wpFunCall は関数の結果を変数に代入する文の事前条件を抽出する関数。x = f(a)。
-func wpFunCall(vars []ast.Expr, ce *ast.CallExpr, postCond ast.Expr) (preCond ast.Expr, err error) {
+// types は変数名とその型で、メソッド呼び出しのレシーバの型を調べるのに使う。
+func wpFunCall(types map[string]ast.Expr, vars []ast.Expr, ce *ast.CallExpr, postCond ast.Expr) (preCond ast.Expr, err error) {
 	if conf.Debug {
 		fmt.Println("#wpFunCall:", ce)
 	}
 
-	funIdent, ok := ce.Fun.(*ast.Ident)
-	if !ok { // 関数名の Ident を取得できないとき
-		err = fmt.Errorf("wpFunCall: Fun is not Ident")
-		return
-	}
-
 	// 関数の名前から、既知の関数データを取得。
 	var funData Data
-	funData, err = getFuncData(funIdent.Name)
+	var args []ast.Expr
+	funData, args, err = getCallData(types, ce)
 	if err != nil {
 		return
 	}
 
-	// 関数の入出力パラメータを取得
-	iParams, oParams, _, oTypes := funData.getParams()
-
-	// 関数の事前・事後条件を取得
-	pre, post := funData.getAsserts()
-
-	if conf.Debug {
-		fmt.Print("#wpFuncCall: pre:")
-		format.Node(os.Stdout, token.NewFileSet(), pre)
-		fmt.Println("")
-		fmt.Print("#wpFuncCall: post:")
-		format.Node(os.Stdout, token.NewFileSet(), post)
-		fmt.Println("")
+	// 再帰呼び出しでは減少量が小さくなる必要がある。termination.go 参照。
+	var dec ast.Expr
+	dec, err = term.call(funData, args)
+	if err != nil {
+		return
 	}
 
+	// 関数の出力パラメータを取得
+	_, oParams, _, oTypes := funData.getParams()
+
 	// 左辺の vars の個数と関数の出力パラメータの oParams の数が同じでないときはエラー
 	if len(vars) != len(oParams) {
 		err = fmt.Errorf("wpFunCall: len(vars) != len(oParams)")
 		return
 	}
 
-	// 関数の入力パラメータ iParams と引数パラメータ ce.Args の数が同じでないときはエラー
-	if len(iParams) != len(ce.Args) {
-		err = fmt.Errorf("wpFunCall: len(iParams) != len(ce.Args)")
-		return
-	}
+	// 関数の出力パラメータと同じ個数の新規変数リストを作成
+	us := FreshIdents(len(oParams))
 
-	// 関数の事前条件 pre 内の入力パラメータを引数リストで置換
-	pre, err = subst(pre, iParams, ce.Args)
+	// 呼び出し側がヒープを使うときは、呼び出しのあとのヒープも新規変数で表す
+	heaps, hs, news := newHeaps(types)
+
+	// 関数の事前・事後条件の入力パラメータを引数リストで、出力パラメータを us で置換
+	var pre, post ast.Expr
+	pre, post, err = funData.instAsserts(args, us, heapIdents(heaps), news)
 	if err != nil {
 		return
 	}
+	if len(heaps) > 0 {
+		var frame ast.Expr
+		frame, err = funData.heapFrame(types, args, heapIdents(heaps), news)
+		if err != nil {
+			return
+		}
+		post = astAnds(post, frame, allocated(us, oTypes, news[allocName]))
+	}
 
-	// 関数の出力パラメータと同じ個数の新規変数リストを作成
-	us := RandomIdents(len(oParams))
-
-	// 関数の事後条件 post 内の oParams を us で置換
-	post, err = subst(post, oParams, us)
-	if err != nil {
-		return
+	if conf.Debug {
+		fmt.Print("#wpFuncCall: pre:")
+		format.Node(os.Stdout, token.NewFileSet(), pre)
+		fmt.Println("")
+		fmt.Print("#wpFuncCall: post:")
+		format.Node(os.Stdout, token.NewFileSet(), post)
+		fmt.Println("")
 	}
 
-	// 関数の事後条件 post 内の iParams を ce.Args で置換
-	post, err = subst(post, iParams, ce.Args)
+	// 事後条件 postCond 内の vars を us で、ヒープの変数を hs で置換
+	vs, es := withHeap(vars, us, news)
+	postCond, err = subst(postCond, vs, es)
 	if err != nil {
 		return
 	}
 
-	// 事後条件 postCond 内の vars を us で置換
-	postCond, err = subst(postCond, vars, us)
+	// 呼び出し先が変更しうるマップの実引数の変数は値を定めない。map.go 参照。
+	postCond, err = wpMapCall(types, funData, args, vars, postCond)
 	if err != nil {
 		return
 	}
@@ -472,9 +1322,15 @@ func wpFunCall(vars []ast.Expr, ce *ast.CallExpr, postCond ast.Expr) (preCond as
 	for i, u := range us {
 		postCond = astForAll(u, oTypes[i], postCond)
 	}
+	for i, h := range hs {
+		postCond = astForAll(h, types[heaps[i]], postCond)
+	}
 
 	// pre and ForAll us.(post => postCond)
 	preCond = astAnd(pre, postCond)
+	if dec != nil {
+		preCond = astAnd(dec, preCond)
+	}
 
 	if conf.Debug {
 		fmt.Print("#wpFuncCall: return: preCond:")
@@ -484,39 +1340,179 @@ func wpFunCall(vars []ast.Expr, ce *ast.CallExpr, postCond ast.Expr) (preCond as
 	return
 }
 
-// wpFunCall2 は代入のない関数呼び出しの事前条件を抽出する関数。f(a)。
-func wpFunCall2(ce *ast.CallExpr, postCond ast.Expr) (preCond ast.Expr, err error) {
-	if conf.Debug {
-		fmt.Println("#wpFunCall2:", ce)
+// wpMapCall は呼び出し先が変更しうるマップの実引数の変数 (changedMapArgs) を、呼び出しのあとの条件 postCond の中で
+// 新規変数にして全称量化する関数。マップの要素数は 0 以上とする。結果を代入する変数 lhs は除く。
+//
+//	ForAll m'.(len(m') >= 0 => postCond[m:=m'])
+func wpMapCall(types map[string]ast.Expr, funData Data, args, lhs []ast.Expr, postCond ast.Expr) (r ast.Expr, err error) {
+	r = postCond
+	for _, x := range changedMapArgs(types, funData, args) {
+		assigned := false
+		for _, v := range lhs {
+			if ident, ok := v.(*ast.Ident); ok && ident.Name == x.Name {
+				assigned = true
+			}
+		}
+		if assigned {
+			continue
+		}
+		m := FreshIdents(1)[0]
+		r, err = subst(r, []ast.Expr{x}, []ast.Expr{m})
+		if err != nil {
+			return
+		}
+		if fact := mapLenFact(types[x.Name], m); fact != nil {
+			r = astImplies(fact, r)
+		}
+		r = astForAll(m, types[x.Name], r)
+	}
+	return
+}
+
+// newHeaps は変数名の表 types のヒープの変数名のリストと、それぞれの新規変数のリストと表を作成する関数。
+// ヒープを使わないときは空のリストと表を返す。
+func newHeaps(types map[string]ast.Expr) (heaps []string, hs []ast.Expr, news map[string]ast.Expr) {
+	heaps = heapVarNames(types)
+	hs = FreshIdents(len(heaps))
+	news = map[string]ast.Expr{}
+	for i, name := range heaps {
+		news[name] = hs[i]
+	}
+	return
+}
+
+// getCallData は関数呼び出し ce の呼び出し先の関数の検証結果データと、
+// 入力パラメータに対応する実引数のリストを取得する関数。
+// x.M(a) のようなメソッド呼び出しでは、変数 x の型 (types) から "型名.メソッド名" のデータを取得し、
+// レシーバ x を実引数の先頭に加える。
+func getCallData(types map[string]ast.Expr, ce *ast.CallExpr) (funData Data, args []ast.Expr, err error) {
+	args = ce.Args
+	switch ce.Fun.(type) {
+	case *ast.Ident:
+		funData, err = getFuncData(ce.Fun.(*ast.Ident).Name)
+	case *ast.SelectorExpr:
+		se := ce.Fun.(*ast.SelectorExpr)
+		x, ok := se.X.(*ast.Ident)
+		if !ok || types[x.Name] == nil { // レシーバの型がわからないとき
+			err = fmt.Errorf("getCallData: unknown receiver of %s", se.Sel.Name)
+			return
+		}
+		funData, err = getFuncData(recvTypeName(types[x.Name]) + "." + se.Sel.Name)
+		if err != nil {
+			return
+		}
+		if len(funData.Recv) > 0 {
+			args = append([]ast.Expr{se.X}, ce.Args...)
+		}
+	default: // 関数名を取得できないとき
+		err = fmt.Errorf("getCallData: Fun is not Ident")
 	}
+	return
+}
 
-	funIdent, ok := ce.Fun.(*ast.Ident)
-	if !ok { // 関数名の Ident を取得できないとき
-		err = fmt.Errorf("wpFunCall2: Fun is not Ident")
+// isFunCall は式が関数呼び出しかどうか調べる関数。
+// 代入の変換で作られる配列の Store(a, i, e) やマップの HasKey(m, k) などや純粋関数の呼び出し、make(map[K]V)、
+// 文字列の len(s) や strings.Contains(s, t)、数値の型の変換 int(c)、math.IsNaN(x) などは関数呼び出しではなく式として扱う。
+func isFunCall(expr ast.Expr) (ce *ast.CallExpr, ok bool) {
+	ce, ok = expr.(*ast.CallExpr)
+	if !ok {
+		return
+	}
+	if isPkgFuncCall(ce) {
+		ok = false
 		return
 	}
+	if ident, isIdent := ce.Fun.(*ast.Ident); isIdent {
+		switch ident.Name {
+		case "Store", "Select", "HasKey", "Delete", "len", "make", "int", "byte", "rune", "float64", "float32":
+			ok = false
+		default:
+			ok = !isPureName(ident.Name)
+		}
+	}
+	return
+}
 
-	// もしも無視可能な関数のときはすぐに終了
-	// 無視可能な関数は PRE = POST = true となる。
+// hasFunCall は式 expr の中のどこかに関数呼び出しがあるかどうか調べ、最初の呼び出しを取得する関数。
+// 関数呼び出しの判定は isFunCall と同じ。expr が nil のときは ok は false。
+func hasFunCall(expr ast.Expr) (ce *ast.CallExpr, ok bool) {
+	if expr == nil {
+		return
+	}
+	ast.Inspect(expr, func(n ast.Node) bool {
+		if e, isExpr := n.(ast.Expr); isExpr && !ok {
+			ce, ok = isFunCall(e)
+		}
+		return !ok
+	})
+	return
+}
+
+// isIgnoredCall は関数呼び出し ce が無視可能な関数の呼び出しかどうか調べる関数。
+// fmt.Println のようなパッケージの関数も関数名で判定する。メソッド呼び出しは対象外。
+// 副作用のない純粋関数の呼び出しも無視できる。
+func isIgnoredCall(types map[string]ast.Expr, ce *ast.CallExpr) (ok bool) {
+	if _, ok = isPureCall(ce); ok {
+		return
+	}
+	var name string
+	switch ce.Fun.(type) {
+	case *ast.Ident:
+		name = ce.Fun.(*ast.Ident).Name
+	case *ast.SelectorExpr:
+		se := ce.Fun.(*ast.SelectorExpr)
+		x, isIdent := se.X.(*ast.Ident)
+		if !isIdent || types[x.Name] != nil {
+			return
+		}
+		name = se.Sel.Name
+	}
 	for _, ignoreFunName := range conf.IgnoreFuncs {
-		if ignoreFunName == funIdent.Name {
-			preCond = postCond
+		if ignoreFunName == name {
+			ok = true
 			return
 		}
 	}
+	return
+}
+
+// wpFunCall2 は代入のない関数呼び出しの事前条件を抽出する関数。f(a)。
+func wpFunCall2(types map[string]ast.Expr, ce *ast.CallExpr, postCond ast.Expr) (preCond ast.Expr, err error) {
+	if conf.Debug {
+		fmt.Println("#wpFunCall2:", ce)
+	}
+
+	// もしも無視可能な関数のときはすぐに終了
+	// 無視可能な関数は PRE = POST = true となる。
+	if isIgnoredCall(types, ce) {
+		preCond = postCond
+		return
+	}
 
 	// 関数の名前から、既知の関数データを取得。
 	var funData Data
-	funData, err = getFuncData(funIdent.Name)
+	var args []ast.Expr
+	funData, args, err = getCallData(types, ce)
+	if err != nil {
+		return
+	}
+
+	// 再帰呼び出しでは減少量が小さくなる必要がある。termination.go 参照。
+	var dec ast.Expr
+	dec, err = term.call(funData, args)
 	if err != nil {
 		return
 	}
 
-	// 関数の入出力パラメータを取得
-	iParams, _, _, _ := funData.getParams()
+	// 呼び出し側がヒープを使うときは、呼び出しのあとのヒープを新規変数で表す
+	heaps, hs, news := newHeaps(types)
 
-	// 関数の事前・事後条件を取得
-	pre, post := funData.getAsserts()
+	// 関数の事前・事後条件の入力パラメータを引数リストで置換
+	var pre, post ast.Expr
+	pre, post, err = funData.instAsserts(args, nil, heapIdents(heaps), news)
+	if err != nil {
+		return
+	}
 
 	if conf.Debug {
 		fmt.Print("#wpFuncCall2: pre:")
@@ -527,20 +1523,34 @@ func wpFunCall2(ce *ast.CallExpr, postCond ast.Expr) (preCond ast.Expr, err erro
 		fmt.Println("")
 	}
 
-	// 関数の入力パラメータ iParams と引数パラメータ ce.Args の数が同じでないときはエラー
-	if len(iParams) != len(ce.Args) {
-		err = fmt.Errorf("wpFunCall2: len(iParams) != len(ce.Args)")
-		return
+	// ヒープが変わるときは ForAll hs.(post and frame => postCond[heaps:=hs])
+	if len(heaps) > 0 {
+		var frame ast.Expr
+		frame, err = funData.heapFrame(types, args, heapIdents(heaps), news)
+		if err != nil {
+			return
+		}
+		postCond, err = substHeap(postCond, news)
+		if err != nil {
+			return
+		}
+		postCond = astImplies(astAnd(post, frame), postCond)
+		for i, h := range hs {
+			postCond = astForAll(h, types[heaps[i]], postCond)
+		}
 	}
 
-	// 関数の事前条件 pre 内の入力パラメータを引数リストで置換
-	pre, err = subst(pre, iParams, ce.Args)
+	// 呼び出し先が変更しうるマップの実引数の変数は値を定めない。map.go 参照。
+	postCond, err = wpMapCall(types, funData, args, nil, postCond)
 	if err != nil {
 		return
 	}
 
 	// pre[iParams:=ce.Args] and postCond
 	preCond = astAnd(pre, postCond)
+	if dec != nil {
+		preCond = astAnd(dec, preCond)
+	}
 
 	if conf.Debug {
 		fmt.Print("#wpFuncCall2: return: preCond:")
@@ -570,6 +1580,44 @@ func astAnd(expr1, expr2 ast.Expr) (r ast.Expr) {
 	return
 }
 
+// astCases は上から順に判定する場合分けの条件式の AST を作成する関数。
+// conds[i] が最初に成り立つ条件のときは pres[i]、どの条件も成り立たないときは elsePre が成り立つことを表す。
+// 入れ子にせずに平坦な選言として作成する。
+//
+//	c1 && p1 || !c1 && c2 && p2 || ... || !c1 && ... && !cN && elsePre
+func astCases(conds, pres []ast.Expr, elsePre ast.Expr) (r ast.Expr) {
+	var negs []ast.Expr
+	for i, cond := range conds {
+		term := astAnds(append(negs, cond, pres[i])...)
+		if r == nil {
+			r = term
+		} else {
+			r = astOr(r, term)
+		}
+		negs = append(negs, astNot(cond))
+	}
+	r = astOr(r, astAnds(append(negs, elsePre)...))
+	return
+}
+
+// astAnds は複数の条件式の And の AST を作成する関数
+func astAnds(exprs ...ast.Expr) (r ast.Expr) {
+	r = exprs[0]
+	for _, expr := range exprs[1:] {
+		r = astAnd(r, expr)
+	}
+	return
+}
+
+// astOrs は複数の条件式の Or の AST を作成する関数
+func astOrs(exprs ...ast.Expr) (r ast.Expr) {
+	r = exprs[0]
+	for _, expr := range exprs[1:] {
+		r = astOr(r, expr)
+	}
+	return
+}
+
 // astNot は条件式の Not の AST を作成する関数
 func astNot(expr ast.Expr) (r ast.Expr) {
 	r = &ast.UnaryExpr{
@@ -591,6 +1639,20 @@ func astImplies(expr1, expr2 ast.Expr) (r ast.Expr) {
 	return
 }
 
+// astIdentical は x と y が同じ値であることを表す式の AST を作成する関数。
+// 変数の値の受け渡しに使う。浮動小数点数の NaN どうしも同じとする。float.go 参照。
+// 例：Identical(x@2, x@1)
+func astIdentical(x, y ast.Expr) (r ast.Expr) {
+	r = &ast.CallExpr{
+		Fun: ast.NewIdent("Identical"),
+		Args: []ast.Expr{
+			x,
+			y,
+		},
+	}
+	return
+}
+
 // astForAll は束縛条件式　forall の AST を作成する関数。
 // 例：ForAll(x, int, Implies(x>0, x>=0))
 func astForAll(x, t, expr ast.Expr) (r ast.Expr) {
@@ -619,6 +1681,34 @@ func astExists(x, t, expr ast.Expr) (r ast.Expr) {
 	return
 }
 
+// astLet は式 expr を名前 x に束縛した式 body の AST を作成する関数。
+// 例：Let(x, y+1, x*x)
+func astLet(x, expr, body ast.Expr) (r ast.Expr) {
+	r = &ast.CallExpr{
+		Fun: ast.NewIdent("Let"),
+		Args: []ast.Expr{
+			x,
+			expr,
+			body,
+		},
+	}
+	return
+}
+
+// astStore は配列 a の i 番目を e にした配列の AST を作成する関数。
+// 例：Store(a, i, e)
+func astStore(a, i, e ast.Expr) (r ast.Expr) {
+	r = &ast.CallExpr{
+		Fun: ast.NewIdent("Store"),
+		Args: []ast.Expr{
+			a,
+			i,
+			e,
+		},
+	}
+	return
+}
+
 // astStr は文字列の AST を作成する関数
 func astStr(str string) (r ast.Expr) {
 	r = &ast.BasicLit{
@@ -628,9 +1718,16 @@ func astStr(str string) (r ast.Expr) {
 	return
 }
 
-// getFuncVars は関数宣言の型から使用される変数名とその型を調べる関数
-func getFuncVars(ft *ast.FuncType) (vars map[string]ast.Expr) {
+// getFuncVars は関数宣言のレシーバと型から使用される変数名とその型を調べる関数
+func getFuncVars(recv *ast.FieldList, ft *ast.FuncType) (vars map[string]ast.Expr) {
 	vars = map[string]ast.Expr{}
+	if recv != nil {
+		for _, field := range recv.List {
+			for _, name := range field.Names {
+				vars[name.Name] = field.Type
+			}
+		}
+	}
 	for _, field := range ft.Params.List {
 		/*
 			typ, ok := field.Type.(*ast.Ident)
@@ -656,40 +1753,75 @@ func getFuncVars(ft *ast.FuncType) (vars map[string]ast.Expr) {
 	return
 }
 
+// getRecvParam はメソッド宣言のレシーバを取得する関数。
+// 型は *Point のようなポインタ型もそのまま文字列にする。名前のないレシーバは仕様から参照できないので含めない。
+func getRecvParam(recv *ast.FieldList) (r [][2]string) {
+	r = [][2]string{}
+	if recv == nil {
+		return
+	}
+	for _, field := range recv.List {
+		typ := typeString(field.Type)
+		for _, name := range field.Names {
+			r = append(r, [2]string{name.Name, typ})
+		}
+	}
+	return
+}
+
 // getIOParams は関数宣言で使用される入出力パラメータを取得する関数
 func getIOParams(ft *ast.FuncType) (inputs, outputs [][2]string) {
 	inputs = [][2]string{}
 	outputs = [][2]string{}
 	for _, field := range ft.Params.List {
-		typ, ok := field.Type.(*ast.Ident)
-		if !ok {
-			// filed.Type が Ident でないときは次へ
-			continue
-		}
+		typ := typeString(field.Type)
 		for _, name := range field.Names {
-			inputs = append(inputs, [2]string{name.Name, typ.Name})
+			inputs = append(inputs, [2]string{name.Name, typ})
 		}
 	}
 	if ft.Results != nil {
 		for _, field := range ft.Results.List {
-			typ, ok := field.Type.(*ast.Ident)
-			if !ok {
-				// filed.Type が Ident でないときは次へ
-				continue
-			}
+			typ := typeString(field.Type)
 			for _, name := range field.Names {
-				outputs = append(outputs, [2]string{name.Name, typ.Name})
+				outputs = append(outputs, [2]string{name.Name, typ})
 			}
 		}
 	}
 	return
 }
 
-// RandomIdents はランダムな名前を持つ Ident のリストを作る関数
-func RandomIdents(n int) (r []ast.Expr) {
-	rand.Seed(time.Now().UnixNano())
+// typeString は型の AST を文字列に変換する関数。例：[]Point
+func typeString(typ ast.Expr) string {
+	buf := new(bytes.Buffer)
+	format.Node(buf, token.NewFileSet(), typ)
+	return buf.String()
+}
+
+// getResultIdents は関数宣言の名前付き結果パラメータの Ident のリストを取得する関数。
+// 結果パラメータに名前がないときは空のリストを返す。
+func getResultIdents(ft *ast.FuncType) (r []ast.Expr) {
+	if ft.Results == nil {
+		return
+	}
+	for _, field := range ft.Results.List {
+		for _, name := range field.Names {
+			r = append(r, ast.NewIdent(name.Name))
+		}
+	}
+	return
+}
+
+// freshPrefix は FreshIdents が作る名前の接頭辞。Go の識別子には $ を使えないので、プログラムの変数の名前と重ならない。
+const freshPrefix = "u$"
+
+// freshCount は FreshIdents が作った名前の数
+var freshCount int
+
+// FreshIdents は他と重ならない名前 u$1, u$2, ... を持つ Ident のリストを作る関数
+func FreshIdents(n int) (r []ast.Expr) {
 	for i := 0; i < n; i++ {
-		r = append(r, ast.NewIdent(fmt.Sprintf("u%05d", rand.Intn(10000))))
+		freshCount++
+		r = append(r, ast.NewIdent(fmt.Sprintf("%s%d", freshPrefix, freshCount)))
 	}
 	return
 }
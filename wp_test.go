@@ -0,0 +1,315 @@
+package main
+
+import (
+	"fmt"
+	"go/ast"
+	"go/token"
+	"strings"
+	"testing"
+)
+
+// 一時的な変数の名前は重ならず、プログラムの変数の名前にもならない
+func TestFreshIdents(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		for _, e := range FreshIdents(3) {
+			name := e.(*ast.Ident).Name
+			if seen[name] {
+				t.Fatalf("duplicate name %s", name)
+			}
+			seen[name] = true
+			if token.IsIdentifier(name) {
+				t.Fatalf("%s can be a Go identifier", name)
+			}
+		}
+	}
+}
+
+// switch 文の case 節、複数の値、default、fallthrough、タグのない switch 文
+func TestSwitchStmt(t *testing.T) {
+	exprSwitch := `
+func f(x int) (r int) {
+	PRE("true")
+	r = 0
+	switch x {
+	case 0, 1:
+		r = -2
+	case 2:
+		r = 2
+		fallthrough
+	case 3:
+		r = r + 1
+	default:
+		r = -1
+	}
+	POST("%s")
+	return
+}
+`
+	tagless := `
+func f(x int) (r int) {
+	PRE("true")
+	switch {
+	case x < 0:
+		r = -1
+	case x == 0:
+		r = 0
+	default:
+		r = 1
+	}
+	POST("%s")
+	return
+}
+`
+	noDefault := `
+func f(x int) (r int) {
+	PRE("true")
+	r = 3
+	switch x + 1 {
+	case 1:
+		r = 0
+	case 2:
+		if r > 0 {
+			break
+		}
+		r = 2
+	}
+	POST("%s")
+	return
+}
+`
+	runVerdictTests(t, []verdictTest{
+		{name: "expression switch", src: fmt.Sprintf(exprSwitch, "(x == 0 || x == 1) == (r == -2) && (x == 2) == (r == 3) && (x == 3) == (r == 1) && (x < 0 || x > 3) == (r == -1)"), funcs: []string{"f"}, ok: true},
+		{name: "fallthrough NG", src: fmt.Sprintf(exprSwitch, "x != 2 || r == 2"), funcs: []string{"f"}, ok: false},
+		{name: "tagless", src: fmt.Sprintf(tagless, "(x < 0) == (r == -1) && (x > 0) == (r == 1)"), funcs: []string{"f"}, ok: true},
+		{name: "tagless NG", src: fmt.Sprintf(tagless, "r >= 0"), funcs: []string{"f"}, ok: false},
+		{name: "no default", src: fmt.Sprintf(noDefault, "(x == 0) == (r == 0) && (x != 0) == (r == 3)"), funcs: []string{"f"}, ok: true},
+		{name: "no default NG", src: fmt.Sprintf(noDefault, "x != 1 || r == 2"), funcs: []string{"f"}, ok: false},
+	})
+}
+
+// 一度だけ評価される式の中の関数呼び出しは扱えない
+func TestNestedFunCall(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "switch tag",
+			body: `switch f(x) + 1 {
+	case 1:
+		r = 1
+	default:
+		r = 0
+	}`,
+			want: "Tag of function call",
+		},
+		{
+			name: "assignment",
+			body: `r = f(x) + 1`,
+			want: "in an expression",
+		},
+		{
+			name: "multi assignment",
+			body: `r, x = x, f(x)`,
+			want: "multi assignment of FunCall",
+		},
+	}
+	for _, tt := range tests {
+		src := `package main
+
+func f(y int) (z int) {
+	PRE("true")
+	z = y
+	POST("z == y")
+	return
+}
+
+func g(x int) (r int) {
+	PRE("true")
+	` + tt.body + `
+	POST("true")
+	return
+}
+`
+		for _, vcgen := range vcgens {
+			t.Run(tt.name+"/"+vcgen, func(t *testing.T) {
+				err := verifyFuncs(t, vcgen, src, "f", "g")
+				if err == nil || !strings.Contains(err.Error(), tt.want) {
+					t.Errorf("want error %q, got %v", tt.want, err)
+				}
+			})
+		}
+	}
+}
+
+// break、continue、途中の return のあとの制御の流れ
+func TestControlFlow(t *testing.T) {
+	earlyReturn := `
+func f(x int) (r int) {
+	PRE("true")
+	if x < 0 {
+		r = -x
+		return
+	}
+	r = x
+	POST("%s")
+	return
+}
+`
+	breakLoop := `
+func f(n int) (r int) {
+	PRE("n >= 0")
+	r = 0
+	for r < n+5 {
+		INV("0 <= r && r <= n")
+		if r == n {
+			break
+		}
+		r = r + 1
+	}
+	POST("%s")
+	return
+}
+`
+	continueLoop := `
+func f(n int) (r int) {
+	PRE("n >= 0")
+	r = 0
+	i := 0
+	for i < n {
+		INV("0 <= i && i <= n && 0 <= r && r <= i")
+		i = i + 1
+		if i%%2 == 0 {
+			continue
+		}
+		r = r + 1
+	}
+	POST("%s")
+	return
+}
+`
+	returnInLoop := `
+func f(n int) (r int) {
+	PRE("n >= 1")
+	i := 0
+	for i < n {
+		INV("0 <= i && i <= n-1")
+		if i == n-1 {
+			r = i
+			return
+		}
+		i = i + 1
+	}
+	r = -1
+	POST("%s")
+	return
+}
+`
+	runVerdictTests(t, []verdictTest{
+		{name: "early return", src: fmt.Sprintf(earlyReturn, "r >= 0"), funcs: []string{"f"}, ok: true},
+		{name: "early return NG", src: fmt.Sprintf(earlyReturn, "r == x"), funcs: []string{"f"}, ok: false},
+		{name: "break", src: fmt.Sprintf(breakLoop, "r == n"), funcs: []string{"f"}, ok: true},
+		{name: "break NG", src: fmt.Sprintf(breakLoop, "r == n + 1"), funcs: []string{"f"}, ok: false},
+		{name: "continue", src: fmt.Sprintf(continueLoop, "r <= n"), funcs: []string{"f"}, ok: true},
+		{name: "continue NG", src: fmt.Sprintf(continueLoop, "r == n"), funcs: []string{"f"}, ok: false},
+		{name: "return in loop", src: fmt.Sprintf(returnInLoop, "r == n - 1"), funcs: []string{"f"}, ok: true},
+		{name: "return in loop NG", src: fmt.Sprintf(returnInLoop, "r == n"), funcs: []string{"f"}, ok: false},
+	})
+}
+
+// if 文の初期化文、else 節のない if 文、else if の連鎖
+func TestIfStmt(t *testing.T) {
+	callee := `
+func g(y int) (z int) {
+	PRE("true")
+	z = y - 1
+	POST("z == y - 1")
+	return
+}
+`
+	ifInit := callee + `
+func f(x int) (r int) {
+	PRE("true")
+	r = 0
+	if v := g(x); v > 0 {
+		r = v
+	}
+	POST("%s")
+	return
+}
+`
+	elseIf := `
+func f(x int) (r int) {
+	PRE("true")
+	if x < 0 {
+		r = -1
+	} else if x == 0 {
+		r = 0
+	} else if x == 1 {
+		r = 1
+	} else {
+		r = 2
+	}
+	POST("%s")
+	return
+}
+`
+	runVerdictTests(t, []verdictTest{
+		{name: "init and no else", src: fmt.Sprintf(ifInit, "x > 1 && r == x - 1 || x <= 1 && r == 0"), funcs: []string{"g", "f"}, ok: true},
+		{name: "init and no else NG", src: fmt.Sprintf(ifInit, "r == x - 1"), funcs: []string{"g", "f"}, ok: false},
+		{name: "else if", src: fmt.Sprintf(elseIf, "r >= -1 && r <= 2 && (x == 1) == (r == 1)"), funcs: []string{"f"}, ok: true},
+		{name: "else if NG", src: fmt.Sprintf(elseIf, "r == x"), funcs: []string{"f"}, ok: false},
+	})
+}
+
+// else if の連鎖の最弱事前条件は入れ子にならず、分岐ごとの項の || になる
+func TestElseIfFlat(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("package main\n\nfunc f(x int) (r int) {\n\tPRE(\"true\")\n\tif x == 0 {\n\t\tr = 0\n")
+	for i := 1; i < 10; i++ {
+		fmt.Fprintf(&sb, "\t} else if x == %d {\n\t\tr = %d\n", i, i)
+	}
+	sb.WriteString("\t} else {\n\t\tr = -1\n\t}\n\tPOST(\"r >= -1\")\n\treturn\n}\n")
+	conds := condStrings(t, "wp", sb.String(), "f")
+	if len(conds) != 1 {
+		t.Fatalf("got %d conds", len(conds))
+	}
+	if n := strings.Count(conds[0], " || "); n != 10 {
+		t.Errorf("got %d disjuncts, want 11: %s", n+1, conds[0])
+	}
+	if strings.Contains(conds[0], "&& (") || strings.Contains(conds[0], "|| (") {
+		t.Errorf("VC is nested: %s", conds[0])
+	}
+}
+
+// 関数本体の途中の ASSERT は証明すべき条件、ASSUME は仮定とし、どちらも検証結果データに記録する
+func TestAssertAssume(t *testing.T) {
+	src := `
+func f(x int) (r int) {
+	PRE("x >= 0")
+	r = x + 1
+	ASSERT("%s")
+	ASSUME("%s")
+	POST("%s")
+	return
+}
+`
+	runVerdictTests(t, []verdictTest{
+		{name: "ASSERT", src: fmt.Sprintf(src, "r > x", "true", "r >= 1"), funcs: []string{"f"}, ok: true},
+		{name: "ASSERT NG", src: fmt.Sprintf(src, "r > 1", "true", "r >= 1"), funcs: []string{"f"}, ok: false},
+		{name: "ASSUME", src: fmt.Sprintf(src, "true", "x == 2", "r == 3"), funcs: []string{"f"}, ok: true},
+		{name: "ASSUME NG", src: fmt.Sprintf(src, "true", "x <= 2", "r == 3"), funcs: []string{"f"}, ok: false},
+		// ASSERT はそれより後の ASSUME を使わずに証明する
+		{name: "ASSERT before ASSUME", src: fmt.Sprintf(src, "x == 2", "x == 2", "true"), funcs: []string{"f"}, ok: false},
+	})
+
+	if err := verifyFuncs(t, "wp", "package main\n"+fmt.Sprintf(src, "r > x", "x == 2", "r == 3"), "f"); err != nil {
+		t.Fatal(err)
+	}
+	data := funcTab["f"]
+	if len(data.Asserts) != 1 || data.Asserts[0] != "r > x" || len(data.Assumes) != 1 || data.Assumes[0] != "x == 2" {
+		t.Errorf("Asserts: %q, Assumes: %q", data.Asserts, data.Assumes)
+	}
+}